@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var accessService = &services.AccessService{}
+
+func handleUserGroups(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		groups, err := accessService.ListUserGroups()
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения списка групп пользователей", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+
+	case http.MethodPost:
+		var request struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		group, err := accessService.CreateUserGroup(request.Name, request.Description)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка создания группы пользователей", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(group)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// handleUserGroupByName обслуживает /api/user-groups/<имя>[/members[/<пользователь>]]
+func handleUserGroupByName(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 || pathParts[3] == "" {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+	groupName := pathParts[3]
+
+	if len(pathParts) >= 5 && pathParts[4] == "members" {
+		username := ""
+		if len(pathParts) >= 6 {
+			username = pathParts[5]
+		}
+		handleUserGroupMembers(w, r, groupName, username)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		group, err := accessService.GetUserGroup(groupName)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения группы пользователей", err)
+			return
+		}
+
+		members, err := accessService.ListUserGroupMembers(groupName)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения состава группы пользователей", err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"group":   group,
+			"members": members,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		if err := accessService.DeleteUserGroup(groupName); err != nil {
+			writeServiceError(w, r, "Ошибка удаления группы пользователей", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Группа пользователей успешно удалена")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func handleUserGroupMembers(w http.ResponseWriter, r *http.Request, groupName, username string) {
+	switch r.Method {
+	case http.MethodGet:
+		members, err := accessService.ListUserGroupMembers(groupName)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения состава группы пользователей", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(members)
+
+	case http.MethodPost:
+		var request struct {
+			Username string `json:"username"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		if err := accessService.AddUserToGroup(groupName, request.Username); err != nil {
+			writeServiceError(w, r, "Ошибка добавления пользователя в группу", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		response := map[string]string{"message": tr(r, "Пользователь успешно добавлен в группу")}
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		if username == "" {
+			writeBadRequest(w, r, "Необходимо указать пользователя")
+			return
+		}
+
+		if err := accessService.RemoveUserFromGroup(groupName, username); err != nil {
+			writeServiceError(w, r, "Ошибка исключения пользователя из группы", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Пользователь успешно исключен из группы")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func handlePermissions(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		subjectType, subject := "", ""
+		switch {
+		case query.Get("user") != "":
+			subjectType, subject = services.SubjectUser, query.Get("user")
+		case query.Get("group") != "":
+			subjectType, subject = services.SubjectGroup, query.Get("group")
+		}
+
+		permissions, err := accessService.ListPermissions(subjectType, subject)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения списка прав", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(permissions)
+
+	case http.MethodPost:
+		var request struct {
+			SubjectType string `json:"subject_type"`
+			Subject     string `json:"subject"`
+			Format      string `json:"format"`
+			Pattern     string `json:"pattern"`
+			Action      string `json:"action"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		if request.Format == "" {
+			request.Format = "*"
+		}
+
+		permission, err := accessService.GrantPermission(request.SubjectType, request.Subject, request.Format, request.Pattern, request.Action)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка назначения права", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(permission)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// handlePermissionByID обслуживает DELETE /api/permissions/<id>
+func handlePermissionByID(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+
+	id, err := strconv.Atoi(pathParts[3])
+	if err != nil {
+		writeBadRequest(w, r, "Неверный идентификатор права")
+		return
+	}
+
+	if err := accessService.RevokePermission(id); err != nil {
+		writeServiceError(w, r, "Ошибка отзыва права", err)
+		return
+	}
+
+	response := map[string]string{"message": tr(r, "Право успешно отозвано")}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
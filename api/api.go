@@ -4,12 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/i18n"
 	"github.com/Viste/larets/models"
 	"github.com/Viste/larets/services"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
@@ -17,32 +16,54 @@ var (
 	dockerService = &services.DockerService{}
 	gitService    = &services.GitService{}
 	helmService   = &services.HelmService{}
+	groupService  = &services.GroupService{}
 )
 
 func RunAPIServer() {
-	log.Printf("Запуск API сервера на порту :%s", config.Config.ServerPort)
-	http.HandleFunc("/api/health", handleHealth)
+	i18n.Logf("Запуск API сервера на порту :%s", config.Config.ServerPort)
+	handle("/api/health", "", handleHealth)
+
+	handle("/api/users", "", withAuth(handleUsers))
+	handle("/api/users/", "", withAuth(handleUserByName))
+	handle("/api/user-groups", "", withAuth(handleUserGroups))
+	handle("/api/user-groups/", "", withAuth(handleUserGroupByName))
+	handle("/api/permissions", "", withAuth(handlePermissions))
+	handle("/api/permissions/", "", withAuth(handlePermissionByID))
+	handle("/api/schedules", "", withAuth(handleSchedules))
+	handle("/api/schedules/", "", withAuth(handleScheduleByID))
+	handle("/api/tasks", "", withAuth(handleTasks))
+	handle("/api/tasks/", "", withAuth(handleTaskByID))
+	handle("/api/cleanup-policies", "", withAuth(handleCleanupPolicies))
+	handle("/api/cleanup-policies/", "", withAuth(handleCleanupPolicyByID))
+	handle("/api/gc", "", withAuth(handleGC))
+	handle("/api/verify", "", withAuth(handleVerify))
+	handle("/api/downloads", "", withAuth(handleDownloads))
+
+	if config.Config.EnableMetrics {
+		http.HandleFunc("/metrics", withAuth(handleMetrics))
+	}
 
 	if config.Config.EnableDocker {
-		http.HandleFunc("/api/docker/repositories", handleDockerRepositories)
-		http.HandleFunc("/api/docker/repositories/", handleDockerRepositoryByName)
-		http.HandleFunc("/api/docker/images", handleDockerImages)
-		http.HandleFunc("/v2/", handleDockerRegistryAPI)
+		handle("/api/docker/repositories", services.FormatDocker, withAuth(handleDockerRepositories))
+		handle("/api/docker/repositories/", services.FormatDocker, withAuth(handleDockerRepositoryByName))
+		handle("/api/docker/images", services.FormatDocker, withAuth(handleDockerImages))
+		handle("/v2/token", services.FormatDocker, handleRegistryToken)
+		handle("/v2/", services.FormatDocker, withRegistryAuth(handleDockerRegistryAPI))
 	}
 
 	if config.Config.EnableGit {
-		http.HandleFunc("/api/git/repositories", handleGitRepositories)
-		http.HandleFunc("/api/git/repositories/", handleGitRepositoryByName)
-		http.HandleFunc("/api/git/sync/", handleGitSync)
-		http.HandleFunc("/git/", handleGitProtocol)
+		handle("/api/git/repositories", services.FormatGit, withAuth(handleGitRepositories))
+		handle("/api/git/repositories/", services.FormatGit, withAuth(handleGitRepositoryByName))
+		handle("/api/git/sync/", services.FormatGit, withAuth(handleGitSync))
+		handle("/git/", services.FormatGit, withAuth(handleGitProtocol))
 	}
 
 	if config.Config.EnableHelm {
-		http.HandleFunc("/api/helm/repositories", handleHelmRepositories)
-		http.HandleFunc("/api/helm/repositories/", handleHelmRepositoryByName)
-		http.HandleFunc("/api/helm/charts", handleHelmCharts)
-		http.HandleFunc("/api/helm/sync/", handleHelmSync)
-		http.HandleFunc("/helm/", handleHelmAccess)
+		handle("/api/helm/repositories", services.FormatHelm, withAuth(handleHelmRepositories))
+		handle("/api/helm/repositories/", services.FormatHelm, withAuth(handleHelmRepositoryByName))
+		handle("/api/helm/charts", services.FormatHelm, withAuth(handleHelmCharts))
+		handle("/api/helm/sync/", services.FormatHelm, withAuth(handleHelmSync))
+		handle("/helm/", services.FormatHelm, withAuth(handleHelmAccess))
 	}
 
 	listenAddr := fmt.Sprintf(":%s", config.Config.ServerPort)
@@ -51,7 +72,7 @@ func RunAPIServer() {
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
@@ -73,9 +94,9 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 func handleDockerRepositories(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		repos, err := dockerService.ListRepositories()
+		repos, err := dockerService.ListRepositories(r.Context())
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения списка репозиториев: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка получения списка репозиториев", err)
 			return
 		}
 
@@ -84,46 +105,59 @@ func handleDockerRepositories(w http.ResponseWriter, r *http.Request) {
 
 	case http.MethodPost:
 		var request struct {
-			Name        string                `json:"name"`
-			Description string                `json:"description"`
-			Type        models.RepositoryType `json:"type"`
-			URL         string                `json:"url,omitempty"`
+			Name          string                     `json:"name"`
+			Description   string                     `json:"description"`
+			Type          models.RepositoryType      `json:"type"`
+			URL           string                     `json:"url,omitempty"`
+			Username      string                     `json:"username,omitempty"`
+			Password      string                     `json:"password,omitempty"`
+			Members       []services.GroupMemberSpec `json:"members,omitempty"`
+			AnonymousRead bool                       `json:"anonymous_read,omitempty"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, "Ошибка декодирования запроса", http.StatusBadRequest)
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
 			return
 		}
 
-		err := dockerService.CreateRepository(request.Name, request.Description, request.Type, request.URL)
+		err := dockerService.CreateRepository(r.Context(), request.Name, request.Description, request.Type, request.URL, request.Username, request.Password, request.AnonymousRead, request.Members)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка создания репозитория: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка создания репозитория", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		response := map[string]string{"message": "Репозиторий успешно создан"}
+		response := map[string]string{"message": tr(r, "Репозиторий успешно создан")}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 func handleDockerRepositoryByName(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Неверный URL", http.StatusBadRequest)
+	if len(pathParts) < 5 || pathParts[4] == "" {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+	repoName := pathParts[4]
+
+	if len(pathParts) >= 6 && pathParts[5] == "members" {
+		memberName := ""
+		if len(pathParts) >= 7 {
+			memberName = pathParts[6]
+		}
+		handleGroupMembers(w, r, services.FormatDocker, repoName, memberName)
 		return
 	}
-	repoName := pathParts[3]
 
 	switch r.Method {
 	case http.MethodGet:
-		repo, err := dockerService.GetRepository(repoName)
+		repo, err := dockerService.GetRepository(r.Context(), repoName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения информации о репозитории: %v", err), http.StatusNotFound)
+			writeServiceError(w, r, "Ошибка получения информации о репозитории", err)
 			return
 		}
 
@@ -131,11 +165,13 @@ func handleDockerRepositoryByName(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(repo)
 
 	case http.MethodDelete:
-		// TODO: удаление репозитория
-		http.Error(w, "Метод пока не реализован", http.StatusNotImplemented)
+		handleRepositoryDelete(w, r, repoName, dockerService.DeleteRepository)
+
+	case http.MethodPatch:
+		handleRepositoryUpdate(w, r, repoName, withoutTask(dockerService.UpdateRepository))
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
@@ -147,9 +183,9 @@ func handleDockerImages(w http.ResponseWriter, r *http.Request) {
 		searchQuery := query.Get("q")
 
 		if searchQuery != "" {
-			images, err := dockerService.SearchImages(searchQuery)
+			images, err := dockerService.SearchImages(r.Context(), searchQuery)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Ошибка поиска образов: %v", err), http.StatusInternalServerError)
+				writeServiceError(w, r, "Ошибка поиска образов", err)
 				return
 			}
 
@@ -159,9 +195,9 @@ func handleDockerImages(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if repoName != "" {
-			images, err := dockerService.ListImages(repoName)
+			images, err := dockerService.ListImages(r.Context(), repoName)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Ошибка получения списка образов: %v", err), http.StatusInternalServerError)
+				writeServiceError(w, r, "Ошибка получения списка образов", err)
 				return
 			}
 
@@ -170,7 +206,7 @@ func handleDockerImages(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		http.Error(w, "Необходимо указать параметр repository или q", http.StatusBadRequest)
+		writeBadRequest(w, r, "Необходимо указать параметр repository или q")
 
 	case http.MethodPost:
 		repoName := r.URL.Query().Get("repository")
@@ -178,39 +214,33 @@ func handleDockerImages(w http.ResponseWriter, r *http.Request) {
 		tag := r.URL.Query().Get("tag")
 
 		if repoName == "" || imageName == "" || tag == "" {
-			http.Error(w, "Необходимо указать параметры repository, name и tag", http.StatusBadRequest)
+			writeBadRequest(w, r, "Необходимо указать параметры repository, name и tag")
 			return
 		}
 
-		err := dockerService.StoreImage(repoName, imageName, tag, r.Body)
+		err := dockerService.StoreImage(r.Context(), repoName, imageName, tag, r.Body)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка сохранения образа: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка сохранения образа", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		response := map[string]string{"message": "Образ успешно сохранен"}
+		response := map[string]string{"message": tr(r, "Образ успешно сохранен")}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
-func handleDockerRegistryAPI(w http.ResponseWriter, r *http.Request) {
-	// TODO: Docker Registry API v2
-	// аутентификация, манифесты, слои и.т.д
-	http.Error(w, "Docker Registry API v2 пока не реализован", http.StatusNotImplemented)
-}
-
 // Git API Handlers
 func handleGitRepositories(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		repos, err := gitService.ListRepositories()
+		repos, err := gitService.ListRepositories(r.Context())
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения списка репозиториев: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка получения списка репозиториев", err)
 			return
 		}
 
@@ -219,15 +249,17 @@ func handleGitRepositories(w http.ResponseWriter, r *http.Request) {
 
 	case http.MethodPost:
 		var request struct {
-			Name        string                `json:"name"`
-			Description string                `json:"description"`
-			Type        models.RepositoryType `json:"type"`
-			URL         string                `json:"url,omitempty"`
-			Branch      string                `json:"branch,omitempty"`
+			Name          string                     `json:"name"`
+			Description   string                     `json:"description"`
+			Type          models.RepositoryType      `json:"type"`
+			URL           string                     `json:"url,omitempty"`
+			Branch        string                     `json:"branch,omitempty"`
+			Members       []services.GroupMemberSpec `json:"members,omitempty"`
+			AnonymousRead bool                       `json:"anonymous_read,omitempty"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, "Ошибка декодирования запроса", http.StatusBadRequest)
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
 			return
 		}
 
@@ -235,35 +267,49 @@ func handleGitRepositories(w http.ResponseWriter, r *http.Request) {
 			request.Branch = "master"
 		}
 
-		err := gitService.CreateRepository(request.Name, request.Description, request.Type, request.URL, request.Branch)
+		task, err := gitService.CreateRepository(r.Context(), request.Name, request.Description, request.Type, request.URL, request.Branch, request.AnonymousRead, request.Members)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка создания репозитория: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка создания репозитория", err)
+			return
+		}
+
+		if task != nil {
+			writeTaskAccepted(w, r, "Репозиторий создан, клонирование выполняется в фоновой задаче", task)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		response := map[string]string{"message": "Репозиторий успешно создан"}
+		response := map[string]string{"message": tr(r, "Репозиторий успешно создан")}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 func handleGitRepositoryByName(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Неверный URL", http.StatusBadRequest)
+	if len(pathParts) < 5 || pathParts[4] == "" {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+	repoName := pathParts[4]
+
+	if len(pathParts) >= 6 && pathParts[5] == "members" {
+		memberName := ""
+		if len(pathParts) >= 7 {
+			memberName = pathParts[6]
+		}
+		handleGroupMembers(w, r, services.FormatGit, repoName, memberName)
 		return
 	}
-	repoName := pathParts[3]
 
 	switch r.Method {
 	case http.MethodGet:
-		repoInfo, err := gitService.GetRepoInfo(repoName)
+		repoInfo, err := gitService.GetRepoInfo(r.Context(), repoName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения информации о репозитории: %v", err), http.StatusNotFound)
+			writeServiceError(w, r, "Ошибка получения информации о репозитории", err)
 			return
 		}
 
@@ -271,51 +317,45 @@ func handleGitRepositoryByName(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(repoInfo)
 
 	case http.MethodDelete:
-		// TODO: удаление репозитория
-		http.Error(w, "Метод пока не реализован", http.StatusNotImplemented)
+		handleRepositoryDelete(w, r, repoName, gitService.DeleteRepository)
+
+	case http.MethodPatch:
+		handleRepositoryUpdate(w, r, repoName, gitService.UpdateRepository)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 func handleGitSync(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Неверный URL", http.StatusBadRequest)
+	if len(pathParts) < 5 || pathParts[4] == "" {
+		writeBadRequest(w, r, "Неверный URL")
 		return
 	}
-	repoName := pathParts[3]
+	repoName := pathParts[4]
 
-	err := gitService.SyncRepository(repoName)
+	task, err := gitService.SyncRepository(r.Context(), repoName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ошибка синхронизации репозитория: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, r, "Ошибка синхронизации репозитория", err)
 		return
 	}
 
-	response := map[string]string{"message": "Репозиторий успешно синхронизирован"}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func handleGitProtocol(w http.ResponseWriter, r *http.Request) {
-	// TODO: Git HTTP protocol
-	// обработка запросов git-upload-pack, git-receive-pack и.т.д
-	http.Error(w, "Git HTTP protocol пока не реализован", http.StatusNotImplemented)
+	writeTaskAccepted(w, r, "Синхронизация поставлена в очередь", task)
 }
 
 // Helm API Handlers
 func handleHelmRepositories(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		repos, err := helmService.ListRepositories()
+		repos, err := helmService.ListRepositories(r.Context())
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения списка репозиториев: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка получения списка репозиториев", err)
 			return
 		}
 
@@ -324,46 +364,62 @@ func handleHelmRepositories(w http.ResponseWriter, r *http.Request) {
 
 	case http.MethodPost:
 		var request struct {
-			Name        string                `json:"name"`
-			Description string                `json:"description"`
-			Type        models.RepositoryType `json:"type"`
-			URL         string                `json:"url,omitempty"`
+			Name          string                     `json:"name"`
+			Description   string                     `json:"description"`
+			Type          models.RepositoryType      `json:"type"`
+			URL           string                     `json:"url,omitempty"`
+			Members       []services.GroupMemberSpec `json:"members,omitempty"`
+			AnonymousRead bool                       `json:"anonymous_read,omitempty"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, "Ошибка декодирования запроса", http.StatusBadRequest)
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
 			return
 		}
 
-		err := helmService.CreateRepository(request.Name, request.Description, request.Type, request.URL)
+		task, err := helmService.CreateRepository(r.Context(), request.Name, request.Description, request.Type, request.URL, request.AnonymousRead, request.Members)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка создания репозитория: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка создания репозитория", err)
+			return
+		}
+
+		if task != nil {
+			writeTaskAccepted(w, r, "Репозиторий создан, индекс загружается в фоновой задаче", task)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		response := map[string]string{"message": "Репозиторий успешно создан"}
+		response := map[string]string{"message": tr(r, "Репозиторий успешно создан")}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 func handleHelmRepositoryByName(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Неверный URL", http.StatusBadRequest)
+	if len(pathParts) < 5 || pathParts[4] == "" {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+	repoName := pathParts[4]
+
+	if len(pathParts) >= 6 && pathParts[5] == "members" {
+		memberName := ""
+		if len(pathParts) >= 7 {
+			memberName = pathParts[6]
+		}
+		handleGroupMembers(w, r, services.FormatHelm, repoName, memberName)
 		return
 	}
-	repoName := pathParts[3]
 
 	switch r.Method {
 	case http.MethodGet:
-		repo, err := helmService.GetRepository(repoName)
+		repo, err := helmService.GetRepository(r.Context(), repoName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения информации о репозитории: %v", err), http.StatusNotFound)
+			writeServiceError(w, r, "Ошибка получения информации о репозитории", err)
 			return
 		}
 
@@ -371,11 +427,13 @@ func handleHelmRepositoryByName(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(repo)
 
 	case http.MethodDelete:
-		// TODO: удаление репозитория
-		http.Error(w, "Метод пока не реализован", http.StatusNotImplemented)
+		handleRepositoryDelete(w, r, repoName, helmService.DeleteRepository)
+
+	case http.MethodPatch:
+		handleRepositoryUpdate(w, r, repoName, helmService.UpdateRepository)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
@@ -386,13 +444,13 @@ func handleHelmCharts(w http.ResponseWriter, r *http.Request) {
 		repoName := r.URL.Query().Get("repository")
 
 		if repoName == "" {
-			http.Error(w, "Необходимо указать параметр repository", http.StatusBadRequest)
+			writeBadRequest(w, r, "Необходимо указать параметр repository")
 			return
 		}
 
-		charts, err := helmService.ListCharts(repoName)
+		charts, err := helmService.ListCharts(r.Context(), repoName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка получения списка чартов: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка получения списка чартов", err)
 			return
 		}
 
@@ -404,110 +462,118 @@ func handleHelmCharts(w http.ResponseWriter, r *http.Request) {
 		filename := r.URL.Query().Get("filename")
 
 		if repoName == "" || filename == "" {
-			http.Error(w, "Необходимо указать параметры repository и filename", http.StatusBadRequest)
+			writeBadRequest(w, r, "Необходимо указать параметры repository и filename")
 			return
 		}
 
 		if !strings.HasSuffix(filename, ".tgz") {
-			http.Error(w, "Файл должен иметь расширение .tgz", http.StatusBadRequest)
+			writeBadRequest(w, r, "Файл должен иметь расширение .tgz")
 			return
 		}
 
-		err := helmService.UploadChart(repoName, r.Body, filename)
+		err := helmService.UploadChart(r.Context(), repoName, r.Body, filename)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Ошибка загрузки чарта: %v", err), http.StatusInternalServerError)
+			writeServiceError(w, r, "Ошибка загрузки чарта", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		response := map[string]string{"message": "Чарт успешно загружен"}
+		response := map[string]string{"message": tr(r, "Чарт успешно загружен")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		repoName := r.URL.Query().Get("repository")
+		chartName := r.URL.Query().Get("name")
+		version := r.URL.Query().Get("version")
+
+		if repoName == "" || chartName == "" || version == "" {
+			writeBadRequest(w, r, "Необходимо указать параметры repository, name и version")
+			return
+		}
+
+		err := helmService.DeleteChart(r.Context(), repoName, chartName, version)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка удаления чарта", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Чарт успешно удален")}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 
 	default:
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 func handleHelmSync(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Неверный URL", http.StatusBadRequest)
+	if len(pathParts) < 5 || pathParts[4] == "" {
+		writeBadRequest(w, r, "Неверный URL")
 		return
 	}
-	repoName := pathParts[3]
+	repoName := pathParts[4]
 
-	err := helmService.SyncRepository(repoName)
+	task, err := helmService.SyncRepository(r.Context(), repoName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ошибка синхронизации репозитория: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, r, "Ошибка синхронизации репозитория", err)
 		return
 	}
 
-	response := map[string]string{"message": "Репозиторий успешно синхронизирован"}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeTaskAccepted(w, r, "Синхронизация поставлена в очередь", task)
 }
 
 func handleHelmAccess(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
-		http.Error(w, "Неверный URL", http.StatusBadRequest)
+		writeBadRequest(w, r, "Неверный URL")
 		return
 	}
 
 	repoName := pathParts[2]
-	repo, err := helmService.GetRepository(repoName)
+	repo, err := helmService.GetRepository(r.Context(), repoName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Репозиторий не найден: %v", err), http.StatusNotFound)
+		writeServiceError(w, r, "Репозиторий не найден", err)
 		return
 	}
 
 	if len(pathParts) == 4 && pathParts[3] == "index.yaml" {
-		indexPath := filepath.Join(repo.StoragePath, repo.IndexPath)
-		http.ServeFile(w, r, indexPath)
+		index, err := helmService.GetIndex(r.Context(), repo.Name)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения индекса репозитория", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Write(index)
 		return
 	}
 
 	if len(pathParts) >= 5 && pathParts[3] == "charts" {
 		chartFileName := pathParts[4]
 
-		chartPath := filepath.Join(repo.StoragePath, "charts", chartFileName)
-		if _, err := os.Stat(chartPath); os.IsNotExist(err) {
-			if repo.Type == models.TypeProxy {
-				chartNameVersion := strings.TrimSuffix(chartFileName, ".tgz")
-				parts := strings.Split(chartNameVersion, "-")
-				if len(parts) < 2 {
-					http.Error(w, "Неверное имя файла чарта", http.StatusBadRequest)
-					return
-				}
-
-				version := parts[len(parts)-1]
-				name := strings.Join(parts[:len(parts)-1], "-")
-
-				chartPath, err = helmService.FetchChartFromProxy(repoName, name, version)
-				if err != nil {
-					http.Error(w, fmt.Sprintf("Ошибка получения чарта: %v", err), http.StatusInternalServerError)
-					return
-				}
-			} else {
-				http.Error(w, "Чарт не найден", http.StatusNotFound)
-				return
-			}
+		chart, err := helmService.GetChartFile(r.Context(), repo.Name, chartFileName)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения чарта", err)
+			return
 		}
 
-		http.ServeFile(w, r, chartPath)
+		if err := serveObject(w, r, chart.Key, chartFileName); err != nil {
+			writeServiceError(w, r, "Ошибка чтения чарта", err)
+		}
 		return
 	}
 
-	http.Error(w, "Неверный путь", http.StatusBadRequest)
+	writeBadRequest(w, r, "Неверный путь")
 }
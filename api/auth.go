@@ -0,0 +1,332 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var authService = &services.AuthService{}
+
+// currentUser возвращает пользователя, прошедшего аутентификацию, или nil
+func currentUser(r *http.Request) *models.User {
+	return services.UserFromContext(r.Context())
+}
+
+// authenticateRequest проверяет заголовок Authorization: Basic (пароль или персональный токен)
+// либо Bearer с персональным токеном. Без заголовка возвращает nil без ошибки.
+func authenticateRequest(r *http.Request) (*models.User, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		return authService.Authenticate(username, password)
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return authService.AuthenticateToken(strings.TrimSpace(token))
+	}
+	return nil, services.ErrInvalidCredentials
+}
+
+// withAuth определяет пользователя запроса, если включен ENABLE_AUTH. Запрос без
+// заголовка Authorization выполняется анонимно, права на репозитории проверяют сервисы.
+// Анонимно разрешено только чтение, остальные запросы без учетных данных получают 401.
+func withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.Config.EnableAuth {
+			next(w, r)
+			return
+		}
+
+		user, err := authenticateRequest(r)
+		if err != nil {
+			if !errors.Is(err, services.ErrInvalidCredentials) {
+				i18n.Logf("Ошибка аутентификации: %v", err)
+			}
+			writeUnauthorized(w, r)
+			return
+		}
+		if user == nil {
+			if !isReadRequest(r) {
+				writeUnauthorized(w, r)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		next(w, r.WithContext(services.WithUser(r.Context(), user)))
+	}
+}
+
+// isReadRequest сообщает, что запрос только читает данные. git fetch и clone передают
+// список нужных объектов в POST запросе git-upload-pack.
+func isReadRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return strings.HasPrefix(r.URL.Path, "/git/") && strings.HasSuffix(r.URL.Path, "/git-upload-pack")
+	}
+	return false
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/v2/") {
+		writeRegistryUnauthorized(w, r, "", "требуется аутентификация")
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="Larets"`)
+	writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Требуется аутентификация", nil)
+}
+
+// requireAdmin проверяет, что запрос выполняет администратор, и отвечает ошибкой, если нет
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if isAdmin(r) {
+		return true
+	}
+	if currentUser(r) == nil {
+		writeUnauthorized(w, r)
+		return false
+	}
+	writeError(w, r, http.StatusForbidden, codeForbidden, "Недостаточно прав", nil)
+	return false
+}
+
+// isAdmin сообщает, что запрос выполняет администратор. При выключенной аутентификации
+// управление пользователями доступно всем, как и остальные API.
+func isAdmin(r *http.Request) bool {
+	if !config.Config.EnableAuth {
+		return true
+	}
+	user := currentUser(r)
+	return user != nil && user.IsAdmin
+}
+
+// canManageUser разрешает пользователю управлять своей учетной записью и токенами
+func canManageUser(r *http.Request, username string) bool {
+	if isAdmin(r) {
+		return true
+	}
+	user := currentUser(r)
+	return user != nil && user.Username == username
+}
+
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		users, err := authService.ListUsers()
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения списка пользователей", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+
+	case http.MethodPost:
+		var request struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Email    string `json:"email,omitempty"`
+			IsAdmin  bool   `json:"is_admin"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		user, err := authService.CreateUser(request.Username, request.Password, request.Email, request.IsAdmin)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка создания пользователя", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(user)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// handleUserByName обслуживает /api/users/<имя>[/tokens[/<id>]], вместо имени можно указать me
+func handleUserByName(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 || pathParts[3] == "" {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+
+	username := pathParts[3]
+	if username == "me" {
+		user := currentUser(r)
+		if user == nil {
+			if config.Config.EnableAuth {
+				writeUnauthorized(w, r)
+				return
+			}
+			writeError(w, r, http.StatusNotFound, codeNotFound, "Аутентификация выключена", nil)
+			return
+		}
+		username = user.Username
+	}
+
+	if !canManageUser(r, username) {
+		if currentUser(r) == nil {
+			writeUnauthorized(w, r)
+			return
+		}
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Недостаточно прав", nil)
+		return
+	}
+
+	if len(pathParts) >= 5 && pathParts[4] == "tokens" {
+		tokenID := ""
+		if len(pathParts) >= 6 {
+			tokenID = pathParts[5]
+		}
+		handleUserTokens(w, r, username, tokenID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := authService.GetUser(username)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения пользователя", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+
+	case http.MethodPatch:
+		var request struct {
+			Password string `json:"password,omitempty"`
+			Email    string `json:"email,omitempty"`
+			IsAdmin  *bool  `json:"is_admin,omitempty"`
+			Active   *bool  `json:"active,omitempty"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		if (request.IsAdmin != nil || request.Active != nil) && !isAdmin(r) {
+			writeError(w, r, http.StatusForbidden, codeForbidden, "Недостаточно прав", nil)
+			return
+		}
+
+		user, err := authService.UpdateUser(username, request.Password, request.Email, request.IsAdmin, request.Active)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка обновления пользователя", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+
+		if err := authService.DeleteUser(username); err != nil {
+			writeServiceError(w, r, "Ошибка удаления пользователя", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Пользователь успешно удален")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func handleUserTokens(w http.ResponseWriter, r *http.Request, username, tokenID string) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := authService.ListTokens(username)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения списка токенов", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodPost:
+		var request struct {
+			Name string `json:"name"`
+			// срок действия в днях, 0 - бессрочный токен
+			ExpiresInDays int `json:"expires_in_days,omitempty"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		var expiresAt *time.Time
+		if request.ExpiresInDays > 0 {
+			expires := time.Now().AddDate(0, 0, request.ExpiresInDays)
+			expiresAt = &expires
+		}
+
+		token, apiToken, err := authService.CreateToken(username, request.Name, expiresAt)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка создания токена", err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"token":      token,
+			"id":         apiToken.ID,
+			"name":       apiToken.Name,
+			"expires_at": apiToken.ExpiresAt,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		id, err := strconv.Atoi(tokenID)
+		if err != nil {
+			writeBadRequest(w, r, "Неверный идентификатор токена")
+			return
+		}
+
+		if err := authService.DeleteToken(username, id); err != nil {
+			writeServiceError(w, r, "Ошибка удаления токена", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Токен успешно удален")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
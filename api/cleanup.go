@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var cleanupService = &services.CleanupService{}
+
+func handleCleanupPolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		policies, err := cleanupService.ListPolicies(r.Context(), query.Get("repo_type"), query.Get("repository"))
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения списка правил очистки", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policies)
+
+	case http.MethodPost:
+		var spec services.CleanupPolicySpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		policy, err := cleanupService.CreatePolicy(r.Context(), spec)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка создания правила очистки", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(policy)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// handleCleanupPolicyByID обслуживает /api/cleanup-policies/<id>, /api/cleanup-policies/<id>/preview
+// и /api/cleanup-policies/<id>/run
+func handleCleanupPolicyByID(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+
+	id, err := strconv.Atoi(pathParts[3])
+	if err != nil {
+		writeBadRequest(w, r, "Неверный идентификатор правила очистки")
+		return
+	}
+
+	if len(pathParts) >= 5 && pathParts[4] != "" {
+		switch {
+		case pathParts[4] == "preview" && r.Method == http.MethodGet:
+			report, err := cleanupService.PreviewPolicy(r.Context(), id)
+			if err != nil {
+				writeServiceError(w, r, "Ошибка предпросмотра очистки", err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+
+		case pathParts[4] == "run" && r.Method == http.MethodPost:
+			task, err := cleanupService.RunPolicy(r.Context(), id)
+			if err != nil {
+				writeServiceError(w, r, "Ошибка запуска очистки", err)
+				return
+			}
+
+			writeTaskAccepted(w, r, "Очистка поставлена в очередь", task)
+
+		case pathParts[4] == "preview" || pathParts[4] == "run":
+			writeMethodNotAllowed(w, r)
+
+		default:
+			writeError(w, r, http.StatusNotFound, codeNotFound, "Неверный URL", nil)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		policy, err := cleanupService.GetPolicy(r.Context(), id)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения правила очистки", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+
+	case http.MethodPatch:
+		var update services.CleanupPolicyUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		policy, err := cleanupService.UpdatePolicy(r.Context(), id, update)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка изменения правила очистки", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+
+	case http.MethodDelete:
+		if err := cleanupService.DeletePolicy(r.Context(), id); err != nil {
+			writeServiceError(w, r, "Ошибка удаления правила очистки", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Правило очистки успешно удалено")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
@@ -0,0 +1,480 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/services"
+	"github.com/Viste/larets/storage"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// registryRoute - разобранный путь запроса Docker Registry API v2.
+// Первый сегмент имени - это имя репозитория Larets, остальные - имя образа:
+// /v2/docker-local/team/app/manifests/latest -> repo=docker-local, image=team/app
+type registryRoute struct {
+	Repo      string
+	Image     string
+	Kind      string
+	Reference string
+}
+
+const (
+	routeManifest = "manifests"
+	routeBlob     = "blobs"
+	routeUpload   = "uploads"
+	routeTags     = "tags"
+
+	maxManifestSize = 4 << 20
+)
+
+func parseRegistryRoute(path string) (*registryRoute, bool) {
+	path = strings.Trim(strings.TrimPrefix(path, "/v2/"), "/")
+	segments := strings.Split(path, "/")
+	n := len(segments)
+	if n < 4 {
+		return nil, false
+	}
+
+	route := &registryRoute{}
+	var nameSegments []string
+
+	switch {
+	case segments[n-2] == routeBlob && segments[n-1] == routeUpload:
+		route.Kind = routeUpload
+		nameSegments = segments[:n-2]
+	case segments[n-3] == routeBlob && segments[n-2] == routeUpload:
+		route.Kind = routeUpload
+		route.Reference = segments[n-1]
+		nameSegments = segments[:n-3]
+	case segments[n-2] == routeManifest:
+		route.Kind = routeManifest
+		route.Reference = segments[n-1]
+		nameSegments = segments[:n-2]
+	case segments[n-2] == routeBlob:
+		route.Kind = routeBlob
+		route.Reference = segments[n-1]
+		nameSegments = segments[:n-2]
+	case segments[n-2] == routeTags && segments[n-1] == "list":
+		route.Kind = routeTags
+		nameSegments = segments[:n-2]
+	default:
+		return nil, false
+	}
+
+	if len(nameSegments) < 2 || (route.Kind != routeTags && route.Kind != routeUpload && route.Reference == "") {
+		return nil, false
+	}
+
+	route.Repo = nameSegments[0]
+	route.Image = strings.Join(nameSegments[1:], "/")
+	return route, true
+}
+
+// registryError - элемент ответа с ошибкой по спецификации Docker Registry API:
+// {"errors": [{"code": "MANIFEST_UNKNOWN", "message": "...", "detail": "..."}]}
+type registryError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Detail  interface{} `json:"detail,omitempty"`
+}
+
+func writeRegistryError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeRegistryErrorDetail(w, r, status, code, message, nil)
+}
+
+func writeRegistryErrorDetail(w http.ResponseWriter, r *http.Request, status int, code, message string, detail interface{}) {
+	lang := setResponseLanguage(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []registryError{{Code: code, Message: i18n.T(lang, message), Detail: localizeDetails(lang, detail)}},
+	})
+}
+
+// writeRegistryServiceError отвечает на ошибку сервиса кодом из спецификации реестра.
+// message - описание ошибки сервиса, detail - полный текст ошибки с подробностями.
+func writeRegistryServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var status int
+	var code string
+	switch {
+	case errors.Is(err, services.ErrNameUnknown):
+		status, code = http.StatusNotFound, "NAME_UNKNOWN"
+	case errors.Is(err, services.ErrManifestUnknown):
+		status, code = http.StatusNotFound, "MANIFEST_UNKNOWN"
+	case errors.Is(err, services.ErrBlobUnknown), errors.Is(err, storage.ErrNotFound):
+		status, code = http.StatusNotFound, "BLOB_UNKNOWN"
+	case errors.Is(err, services.ErrDigestInvalid):
+		status, code = http.StatusBadRequest, "DIGEST_INVALID"
+	case errors.Is(err, services.ErrManifestInvalid):
+		status, code = http.StatusBadRequest, "MANIFEST_INVALID"
+	case errors.Is(err, services.ErrManifestBlobUnknown):
+		status, code = http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN"
+	case errors.Is(err, services.ErrBlobUploadUnknown):
+		status, code = http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN"
+	case errors.Is(err, services.ErrBlobUploadInvalid):
+		status, code = http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID"
+	case errors.Is(err, services.ErrDenied), errors.Is(err, services.ErrForbidden):
+		status, code = http.StatusForbidden, "DENIED"
+	case errors.Is(err, services.ErrUnauthorized):
+		writeRegistryUnauthorized(w, r, "", i18n.Localize(requestLanguage(r), err))
+		return
+	case errors.Is(err, services.ErrMaintenance):
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		status, code = http.StatusServiceUnavailable, "UNAVAILABLE"
+	default:
+		// остальные ошибки сервисов сохраняют статус своей категории
+		status, _ = serviceErrorStatus(err)
+		code = "UNKNOWN"
+		if status == http.StatusInternalServerError {
+			i18n.Logf("Ошибка Docker Registry API: %v", err)
+		}
+	}
+
+	message := err.Error()
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		message = serviceErr.Message
+	}
+	var detail interface{}
+	if message != err.Error() {
+		detail = err
+	} else {
+		message = i18n.Localize(requestLanguage(r), err)
+	}
+	writeRegistryErrorDetail(w, r, status, code, message, detail)
+}
+
+func handleDockerRegistryAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if r.URL.Path == "/v2/" || r.URL.Path == "/v2" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+			return
+		}
+		// docker login проверяет учетные данные запросом к /v2/, в ответ на 401
+		// клиент получает токен у /v2/token и повторяет запрос с ним
+		if config.Config.EnableAuth && currentUser(r) == nil && registryClaims(r) == nil {
+			writeRegistryUnauthorized(w, r, "", "требуется аутентификация")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+
+	if r.URL.Path == "/v2/_catalog" {
+		if checkRegistryScope(w, r, "registry", "catalog", "*") {
+			handleRegistryCatalog(w, r)
+		}
+		return
+	}
+
+	route, ok := parseRegistryRoute(r.URL.Path)
+	if !ok {
+		writeRegistryError(w, r, http.StatusNotFound, "NAME_INVALID", "Неверный путь запроса")
+		return
+	}
+
+	if !checkRegistryScope(w, r, "repository", route.Repo+"/"+route.Image, registryAction(r, route)) {
+		return
+	}
+
+	switch route.Kind {
+	case routeManifest:
+		handleRegistryManifest(w, r, route)
+	case routeBlob:
+		handleRegistryBlob(w, r, route)
+	case routeUpload:
+		handleRegistryUpload(w, r, route)
+	case routeTags:
+		handleRegistryTags(w, r, route)
+	}
+}
+
+func handleRegistryManifest(w http.ResponseWriter, r *http.Request, route *registryRoute) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		manifest, err := dockerService.GetManifest(r.Context(), route.Repo, route.Image, route.Reference)
+		if err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", manifest.MediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(manifest.Content)))
+		w.Header().Set("Docker-Content-Digest", manifest.Digest)
+		w.Header().Set("Etag", `"`+manifest.Digest+`"`)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(manifest.Content)
+			manifest.TrackDownload()
+		}
+
+	case http.MethodPut:
+		content, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+		if err != nil {
+			writeRegistryError(w, r, http.StatusBadRequest, "MANIFEST_INVALID", "Ошибка чтения манифеста")
+			return
+		}
+		if len(content) > maxManifestSize {
+			writeRegistryError(w, r, http.StatusRequestEntityTooLarge, "SIZE_INVALID", "Манифест слишком большой")
+			return
+		}
+
+		digest, err := dockerService.PutManifest(r.Context(), route.Repo, route.Image, route.Reference, r.Header.Get("Content-Type"), content)
+		if err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", registryLocation(route, routeManifest, digest))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+	}
+}
+
+func handleRegistryBlob(w http.ResponseWriter, r *http.Request, route *registryRoute) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		blob, err := dockerService.GetBlob(r.Context(), route.Repo, route.Image, route.Reference)
+		if err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", route.Reference)
+		w.Header().Set("Etag", `"`+route.Reference+`"`)
+		w.Header().Set("Cache-Control", "max-age=31536000")
+		if err := serveObject(w, r, blob.Key, ""); err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+		if r.Method == http.MethodGet {
+			blob.TrackDownload()
+		}
+
+	default:
+		writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+	}
+}
+
+func registryLocation(route *registryRoute, kind, reference string) string {
+	location := "/v2/" + route.Repo + "/" + route.Image + "/" + kind + "/"
+	if kind == routeUpload {
+		location = "/v2/" + route.Repo + "/" + route.Image + "/" + routeBlob + "/" + routeUpload + "/"
+	}
+	return location + reference
+}
+
+func writeUploadStatus(w http.ResponseWriter, route *registryRoute, upload *models.DockerUpload, status int) {
+	end := upload.Size - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Location", registryLocation(route, routeUpload, upload.ID))
+	w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+	w.Header().Set("Docker-Upload-UUID", upload.ID)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+// parseContentRange разбирает заголовок Content-Range вида "<start>-<end>" у PATCH запроса
+func parseContentRange(value string) (int64, bool) {
+	if value == "" {
+		return -1, true
+	}
+	value = strings.TrimPrefix(value, "bytes ")
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, false
+	}
+	return start, true
+}
+
+func handleRegistryUpload(w http.ResponseWriter, r *http.Request, route *registryRoute) {
+	if route.Reference == "" {
+		if r.Method != http.MethodPost {
+			writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+			return
+		}
+
+		// монолитная загрузка: blob целиком в теле POST запроса
+		if digest := r.URL.Query().Get("digest"); digest != "" {
+			if err := dockerService.PutBlob(r.Context(), route.Repo, route.Image, digest, r.Body); err != nil {
+				writeRegistryServiceError(w, r, err)
+				return
+			}
+			w.Header().Set("Location", registryLocation(route, routeBlob, digest))
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		// blob из другого репозитория уже лежит в общем хранилище, загружать его повторно не нужно
+		if mount := r.URL.Query().Get("mount"); mount != "" {
+			from := r.URL.Query().Get("from")
+			if claims := registryClaims(r); claims != nil && !claims.Allows("repository", from, "pull") {
+				from = ""
+			}
+
+			mounted, err := dockerService.MountBlob(r.Context(), route.Repo, route.Image, mount, from)
+			if err != nil {
+				writeRegistryServiceError(w, r, err)
+				return
+			}
+			if mounted {
+				w.Header().Set("Location", registryLocation(route, routeBlob, mount))
+				w.Header().Set("Docker-Content-Digest", mount)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+
+		upload, err := dockerService.StartUpload(r.Context(), route.Repo, route.Image)
+		if err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+		writeUploadStatus(w, route, upload, http.StatusAccepted)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		upload, err := dockerService.GetUpload(r.Context(), route.Repo, route.Image, route.Reference)
+		if err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+		writeUploadStatus(w, route, upload, http.StatusNoContent)
+
+	case http.MethodPatch:
+		offset, ok := parseContentRange(r.Header.Get("Content-Range"))
+		if !ok {
+			writeRegistryError(w, r, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", "Неверный заголовок Content-Range")
+			return
+		}
+
+		upload, err := dockerService.AppendUpload(r.Context(), route.Repo, route.Image, route.Reference, offset, r.Body)
+		if err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+		writeUploadStatus(w, route, upload, http.StatusAccepted)
+
+	case http.MethodPut:
+		digest := r.URL.Query().Get("digest")
+		if digest == "" {
+			writeRegistryError(w, r, http.StatusBadRequest, "DIGEST_INVALID", "Не указан параметр digest")
+			return
+		}
+
+		if err := dockerService.CompleteUpload(r.Context(), route.Repo, route.Image, route.Reference, digest, r.Body); err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", registryLocation(route, routeBlob, digest))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		if err := dockerService.CancelUpload(r.Context(), route.Repo, route.Image, route.Reference); err != nil {
+			writeRegistryServiceError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+	}
+}
+
+func handleRegistryTags(w http.ResponseWriter, r *http.Request, route *registryRoute) {
+	if r.Method != http.MethodGet {
+		writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+		return
+	}
+
+	tags, err := dockerService.ListTags(r.Context(), route.Repo, route.Image)
+	if err != nil {
+		writeRegistryServiceError(w, r, err)
+		return
+	}
+
+	tags = paginateRegistryList(w, r, tags)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name": route.Repo + "/" + route.Image,
+		"tags": tags,
+	})
+}
+
+func handleRegistryCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+		return
+	}
+
+	repositories, err := dockerService.Catalog(r.Context())
+	if err != nil {
+		writeRegistryServiceError(w, r, err)
+		return
+	}
+
+	repositories = paginateRegistryList(w, r, repositories)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"repositories": repositories,
+	})
+}
+
+// paginateRegistryList реализует пагинацию n/last из спецификации distribution
+// для отсортированных списков и выставляет заголовок Link на следующую страницу
+func paginateRegistryList(w http.ResponseWriter, r *http.Request, items []string) []string {
+	query := r.URL.Query()
+
+	if last := query.Get("last"); last != "" {
+		start := len(items)
+		for i, item := range items {
+			if item > last {
+				start = i
+				break
+			}
+		}
+		items = items[start:]
+	}
+
+	n, err := strconv.Atoi(query.Get("n"))
+	if err != nil || n <= 0 || n >= len(items) {
+		return items
+	}
+
+	items = items[:n]
+	next := *r.URL
+	nextQuery := next.Query()
+	nextQuery.Set("n", strconv.Itoa(n))
+	nextQuery.Set("last", items[len(items)-1])
+	next.RawQuery = nextQuery.Encode()
+	w.Header().Set("Link", `<`+next.RequestURI()+`>; rel="next"`)
+	return items
+}
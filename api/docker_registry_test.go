@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistryRoute(t *testing.T) {
+	tests := []struct {
+		path string
+		want *registryRoute
+	}{
+		{"/v2/docker-local/app/manifests/latest", &registryRoute{Repo: "docker-local", Image: "app", Kind: routeManifest, Reference: "latest"}},
+		{"/v2/docker-local/team/app/manifests/sha256:abc", &registryRoute{Repo: "docker-local", Image: "team/app", Kind: routeManifest, Reference: "sha256:abc"}},
+		{"/v2/docker-local/app/blobs/sha256:abc", &registryRoute{Repo: "docker-local", Image: "app", Kind: routeBlob, Reference: "sha256:abc"}},
+		{"/v2/docker-local/a/b/c/tags/list", &registryRoute{Repo: "docker-local", Image: "a/b/c", Kind: routeTags}},
+		{"/v2/docker-local/app/blobs/uploads/", &registryRoute{Repo: "docker-local", Image: "app", Kind: routeUpload}},
+		{"/v2/docker-local/team/app/blobs/uploads/5f1c", &registryRoute{Repo: "docker-local", Image: "team/app", Kind: routeUpload, Reference: "5f1c"}},
+		{"/v2/docker-local/app/blobs/uploads", &registryRoute{Repo: "docker-local", Image: "app", Kind: routeUpload}},
+		// имя образа может совпадать с ключевыми словами маршрута
+		{"/v2/docker-local/manifests/manifests/latest", &registryRoute{Repo: "docker-local", Image: "manifests", Kind: routeManifest, Reference: "latest"}},
+		{"/v2/docker-local/app/manifests/latest/", &registryRoute{Repo: "docker-local", Image: "app", Kind: routeManifest, Reference: "latest"}},
+
+		// первый сегмент - репозиторий Larets, без имени образа путь неверен
+		{"/v2/app/manifests/latest", nil},
+		{"/v2/docker-local/app/manifests/", nil},
+		{"/v2/docker-local/app/blobs/", nil},
+		{"/v2/app/blobs/uploads/", nil},
+		{"/v2/app/blobs/uploads/5f1c", nil},
+		{"/v2/docker-local/app/tags", nil},
+		{"/v2/docker-local/app/other/latest", nil},
+		{"/v2/", nil},
+		{"/v2/_catalog", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := parseRegistryRoute(tt.path)
+			if ok != (tt.want != nil) {
+				t.Fatalf("parseRegistryRoute(%q) ok = %v, route = %+v", tt.path, ok, got)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRegistryRoute(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateRegistryList(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+		link  string
+	}{
+		{name: "no pagination", query: "", want: items},
+		{name: "first page", query: "n=2", want: []string{"a", "b"}, link: `</v2/_catalog?last=b&n=2>; rel="next"`},
+		{name: "next page", query: "n=2&last=b", want: []string{"c", "d"}, link: `</v2/_catalog?last=d&n=2>; rel="next"`},
+		{name: "last page", query: "n=2&last=d", want: []string{"e"}},
+		{name: "exact last page", query: "n=3&last=b", want: []string{"c", "d", "e"}},
+		{name: "last between items", query: "n=1&last=bb", want: []string{"c"}, link: `</v2/_catalog?last=c&n=1>; rel="next"`},
+		{name: "last after all items", query: "last=z", want: []string{}},
+		{name: "last only", query: "last=c", want: []string{"d", "e"}},
+		{name: "invalid n", query: "n=abc", want: items},
+		{name: "zero n", query: "n=0", want: items},
+		{name: "negative n", query: "n=-1", want: items},
+		{name: "n larger than list", query: "n=10", want: items},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v2/_catalog?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			got := paginateRegistryList(w, r, append([]string(nil), items...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paginateRegistryList(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			if link := w.Header().Get("Link"); link != tt.link {
+				t.Errorf("paginateRegistryList(%q) Link = %q, want %q", tt.query, link, tt.link)
+			}
+		})
+	}
+}
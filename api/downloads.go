@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+)
+
+var downloadService = &services.DownloadService{}
+
+// handleDownloads отдает статистику скачиваний:
+// GET /api/downloads?repo_type=<format>&repository=<name>[&name=<artifact>][&version=<version>][&days=<n>]
+func handleDownloads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.DownloadFilter{
+		RepoType:   query.Get("repo_type"),
+		Repository: query.Get("repository"),
+		Name:       query.Get("name"),
+		Version:    query.Get("version"),
+	}
+	if days := query.Get("days"); days != "" {
+		value, err := strconv.Atoi(days)
+		if err != nil || value < 1 {
+			writeBadRequest(w, r, "Неверное количество дней")
+			return
+		}
+		filter.Days = value
+	}
+
+	report, err := downloadService.GetStats(r.Context(), filter)
+	if err != nil {
+		writeServiceError(w, r, "Ошибка получения статистики скачиваний", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/services"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// errorResponse - тело ответа с ошибкой во всех API, кроме Docker Registry API (/v2/),
+// который отвечает в формате спецификации реестра. Code - машиночитаемый код,
+// Message - описание операции, Details - текст ошибки сервиса или параметры ошибки.
+type errorResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Коды ошибок, не связанные с конкретной ошибкой сервиса. Ошибки сервисов со своим
+// кодом (services.Error) отвечают им, например CHART_EXISTS или REPOSITORY_NOT_FOUND.
+const (
+	codeInvalidRequest   = "INVALID_REQUEST"
+	codeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	codeUnauthorized     = "UNAUTHORIZED"
+	codeForbidden        = "FORBIDDEN"
+	codeNotFound         = "NOT_FOUND"
+	codeConflict         = "CONFLICT"
+	codeUnavailable      = "UNAVAILABLE"
+	codeInternal         = "INTERNAL_ERROR"
+)
+
+// writeError отвечает ошибкой на языке запроса. details - ошибка сервиса, строка или
+// структура с параметрами ошибки; ошибки и строки переводятся, структуры передаются как есть.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	lang := setResponseLanguage(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: i18n.T(lang, message), Details: localizeDetails(lang, details)})
+}
+
+func writeBadRequest(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusBadRequest, codeInvalidRequest, message, nil)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Метод не поддерживается", nil)
+}
+
+// writeServiceError отвечает на ошибку сервиса. Статус и код определяются категорией ошибки,
+// message описывает операцию, текст ошибки на языке запроса передается в details.
+func writeServiceError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	status, code := serviceErrorStatus(err)
+	switch status {
+	case http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Basic realm="Larets"`)
+	case http.StatusServiceUnavailable:
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+	case http.StatusInternalServerError:
+		i18n.Logf("%s %s: %s: %v", r.Method, r.URL.Path, message, err)
+	}
+	writeError(w, r, status, code, message, err)
+}
+
+// serviceErrorStatus возвращает HTTP статус и код ответа для ошибки сервиса
+func serviceErrorStatus(err error) (int, string) {
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		status, _ := errorKindStatus(serviceErr.Kind)
+		return status, serviceErr.Code
+	}
+	return errorKindStatus(err)
+}
+
+func errorKindStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrUnauthorized):
+		return http.StatusUnauthorized, codeUnauthorized
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden, codeForbidden
+	case errors.Is(err, services.ErrMaintenance):
+		return http.StatusServiceUnavailable, codeUnavailable
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound, codeNotFound
+	case errors.Is(err, services.ErrConflict), errors.Is(err, gorm.ErrDuplicatedKey):
+		return http.StatusConflict, codeConflict
+	case errors.Is(err, services.ErrInvalid):
+		return http.StatusBadRequest, codeInvalidRequest
+	default:
+		return http.StatusInternalServerError, codeInternal
+	}
+}
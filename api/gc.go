@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+)
+
+// значение Retry-After в секундах для запросов на запись во время сборки мусора
+const maintenanceRetryAfter = "60"
+
+var gcService = &services.GCService{}
+
+// handleGC запускает сборку мусора: POST /api/gc?dry_run=true.
+// Отчет сохраняется в результате задачи, доступной через /api/tasks/<id>.
+func handleGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	task, err := gcService.StartGC(r.Context(), dryRun)
+	if err != nil {
+		writeServiceError(w, r, "Ошибка запуска сборки мусора", err)
+		return
+	}
+
+	writeTaskAccepted(w, r, "Сборка мусора поставлена в очередь", task)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/Viste/larets/i18n"
+	"net/http"
+	"strings"
+)
+
+// handleGitProtocol обслуживает git smart HTTP:
+// GET /git/<repo>.git/info/refs?service=<svc>, POST /git/<repo>.git/git-upload-pack и /git-receive-pack
+func handleGitProtocol(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/git/")
+
+	var repoPath, service string
+	switch {
+	case strings.HasSuffix(path, "/info/refs"):
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeMethodNotAllowed(w, r)
+			return
+		}
+		repoPath = strings.TrimSuffix(path, "/info/refs")
+		service = r.URL.Query().Get("service")
+		if service == "" {
+			// dumb HTTP протокол не поддерживается
+			writeError(w, r, http.StatusForbidden, codeForbidden, "Поддерживается только smart HTTP протокол git", nil)
+			return
+		}
+	case strings.HasSuffix(path, "/git-upload-pack"), strings.HasSuffix(path, "/git-receive-pack"):
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, r)
+			return
+		}
+		idx := strings.LastIndex(path, "/")
+		repoPath, service = path[:idx], path[idx+1:]
+	default:
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Неверный URL", nil)
+		return
+	}
+
+	repoName := strings.TrimSuffix(repoPath, ".git")
+	if repoName == "" {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Неверный URL", nil)
+		return
+	}
+
+	repo, err := gitService.PrepareService(r.Context(), repoName, service)
+	if err != nil {
+		writeServiceError(w, r, "Ошибка доступа к git репозиторию", err)
+		return
+	}
+
+	protocol := r.Header.Get("Git-Protocol")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+	w.Header().Set("Pragma", "no-cache")
+
+	if strings.HasSuffix(path, "/info/refs") {
+		w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := gitService.AdvertiseRefs(r.Context(), repo, service, protocol, w); err != nil {
+			i18n.Logf("Ошибка получения ссылок git репозитория %s: %v", repoName, err)
+		}
+		return
+	}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Ошибка чтения сжатого запроса", err)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+	if err := gitService.ServiceRPC(r.Context(), repo, service, protocol, body, w); err != nil {
+		// заголовки уже отправлены, git клиент увидит обрыв протокола
+		i18n.Logf("Ошибка обработки %s для репозитория %s: %v", service, repoName, err)
+	}
+}
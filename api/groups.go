@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Viste/larets/services"
+	"net/http"
+)
+
+// handleGroupMembers управляет составом группы: /api/<формат>/repositories/<группа>/members[/<участник>]
+func handleGroupMembers(w http.ResponseWriter, r *http.Request, format, groupName, memberName string) {
+	switch r.Method {
+	case http.MethodGet:
+		members, err := groupService.ListMembers(r.Context(), format, groupName)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения участников группы", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(members)
+
+	case http.MethodPut:
+		var members []services.GroupMemberSpec
+		if err := json.NewDecoder(r.Body).Decode(&members); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		if err := groupService.SetMembers(r.Context(), format, groupName, members); err != nil {
+			writeServiceError(w, r, "Ошибка обновления участников группы", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Состав группы успешно обновлен")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodPost:
+		var member services.GroupMemberSpec
+		if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		if err := groupService.AddMember(r.Context(), format, groupName, member); err != nil {
+			writeServiceError(w, r, "Ошибка добавления участника группы", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		response := map[string]string{"message": tr(r, "Участник успешно добавлен в группу")}
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		if memberName == "" {
+			writeBadRequest(w, r, "Необходимо указать участника группы")
+			return
+		}
+
+		if err := groupService.RemoveMember(r.Context(), format, groupName, memberName); err != nil {
+			writeServiceError(w, r, "Ошибка исключения участника группы", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Участник успешно исключен из группы")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
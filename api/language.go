@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/Viste/larets/i18n"
+	"net/http"
+)
+
+// requestLanguage возвращает язык ответа, выбранный по заголовку Accept-Language
+func requestLanguage(r *http.Request) string {
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// setResponseLanguage указывает в заголовках ответа язык сообщений и возвращает его
+func setResponseLanguage(w http.ResponseWriter, r *http.Request) string {
+	lang := requestLanguage(r)
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	return lang
+}
+
+// tr переводит сообщение ответа на язык запроса
+func tr(r *http.Request, message string) string {
+	return i18n.T(requestLanguage(r), message)
+}
+
+// localizeDetails переводит подробности ошибки: ошибки сервисов и строки
+func localizeDetails(lang string, details interface{}) interface{} {
+	switch details := details.(type) {
+	case error:
+		return i18n.Localize(lang, details)
+	case string:
+		return i18n.T(lang, details)
+	default:
+		return details
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"github.com/Viste/larets/metrics"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handle регистрирует обработчик маршрута с учетом запросов в метриках. route - шаблон
+// маршрута, format - формат репозиториев маршрута или пустая строка для общих API.
+func handle(route, format string, handler http.HandlerFunc) {
+	http.HandleFunc(route, instrument(route, format, handler))
+}
+
+// instrument считает запросы, время их обработки и объем переданных данных. Метки
+// берутся из шаблона маршрута, а не из пути запроса, чтобы число рядов не росло.
+func instrument(route, format string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		var body *countingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+
+		next(recorder, r)
+
+		method := metricsMethod(r.Method)
+		metrics.HTTPRequests.WithLabelValues(route, format, method, strconv.Itoa(recorder.status)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, format, method).Observe(time.Since(started).Seconds())
+		metrics.HTTPResponseBytes.WithLabelValues(route, format).Add(float64(recorder.written))
+		if body != nil {
+			metrics.HTTPRequestBytes.WithLabelValues(route, format).Add(float64(body.read))
+		}
+	}
+}
+
+// metricsMethod ограничивает метку method известными методами
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// responseRecorder запоминает статус ответа и объем тела
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush сохраняет потоковую отдачу ответов через обертку
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap дает http.ResponseController доступ к исходному ResponseWriter
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingReader считает объем прочитанного тела запроса
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+var metricsHandler = metrics.Handler()
+
+// handleMetrics отдает метрики Prometheus. При включенной аутентификации метрики
+// доступны только администраторам: в них есть имена всех репозиториев.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	metricsHandler.ServeHTTP(w, r)
+}
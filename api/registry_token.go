@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var registryTokens = &services.RegistryTokenService{}
+
+type registryContextKey int
+
+const registryClaimsKey registryContextKey = 0
+
+// registryClaims возвращает разрешения токена, с которым выполняется запрос к реестру,
+// или nil, если клиент аутентифицировался паролем или персональным токеном
+func registryClaims(r *http.Request) *services.RegistryClaims {
+	claims, _ := r.Context().Value(registryClaimsKey).(*services.RegistryClaims)
+	return claims
+}
+
+// registryAction возвращает действие scope, необходимое для запроса
+func registryAction(r *http.Request, route *registryRoute) string {
+	if route.Kind == routeUpload {
+		return "push"
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return "pull"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return "push"
+}
+
+// registryScope возвращает scope, который клиент должен запросить у /v2/token для выполнения запроса
+func registryScope(r *http.Request) string {
+	if r.URL.Path == "/v2/_catalog" {
+		return "registry:catalog:*"
+	}
+
+	route, ok := parseRegistryRoute(r.URL.Path)
+	if !ok {
+		return ""
+	}
+
+	action := registryAction(r, route)
+	if action == "push" {
+		// docker всегда запрашивает pull вместе с push
+		action = "pull,push"
+	}
+	return fmt.Sprintf("repository:%s/%s:%s", route.Repo, route.Image, action)
+}
+
+// writeRegistryUnauthorized отвечает 401 с указанием, где получить токен (Bearer challenge)
+func writeRegistryUnauthorized(w http.ResponseWriter, r *http.Request, tokenError, message string) {
+	challenge := fmt.Sprintf(`Bearer realm="%s/v2/token",service="%s"`, config.Config.BaseURL, config.Config.RegistryService)
+	if scope := registryScope(r); scope != "" {
+		challenge += fmt.Sprintf(`,scope="%s"`, scope)
+	}
+	if tokenError != "" {
+		challenge += fmt.Sprintf(`,error="%s"`, tokenError)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeRegistryError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", message)
+}
+
+// withRegistryAuth определяет пользователя запроса к реестру по токену, выданному /v2/token.
+// Запросы с паролем или персональным токеном обрабатываются так же, как в остальном API.
+func withRegistryAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.Config.EnableAuth {
+			next(w, r)
+			return
+		}
+
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		token = strings.TrimSpace(token)
+		if !strings.EqualFold(scheme, "Bearer") || strings.HasPrefix(token, "lrt_") {
+			withAuth(next)(w, r)
+			return
+		}
+
+		user, claims, err := registryTokens.VerifyToken(token)
+		if err != nil {
+			writeRegistryUnauthorized(w, r, "invalid_token", i18n.Localize(requestLanguage(r), err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), registryClaimsKey, claims)
+		if user != nil {
+			ctx = services.WithUser(ctx, user)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// checkRegistryScope проверяет, что токен запроса разрешает нужное действие.
+// Права на репозиторий дополнительно проверяются сервисом, так как их могли отозвать после выдачи токена.
+func checkRegistryScope(w http.ResponseWriter, r *http.Request, resourceType, name, action string) bool {
+	claims := registryClaims(r)
+	if claims == nil || claims.Allows(resourceType, name, action) {
+		return true
+	}
+
+	writeRegistryUnauthorized(w, r, "insufficient_scope", i18n.Sprintf(requestLanguage(r), "токен не разрешает %s для %s", action, name))
+	return false
+}
+
+// handleRegistryToken выдает токен Docker Registry: GET /v2/token?service=...&scope=...
+// Учетные данные передаются через HTTP Basic, без них выдается анонимный токен.
+func handleRegistryToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeRegistryError(w, r, http.StatusMethodNotAllowed, "UNSUPPORTED", "Метод не поддерживается")
+		return
+	}
+
+	user, err := authenticateRequest(r)
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidCredentials) {
+			i18n.Logf("Ошибка аутентификации: %v", err)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="Larets"`)
+		writeRegistryError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "неверное имя пользователя или пароль")
+		return
+	}
+
+	ctx := r.Context()
+	if user != nil {
+		ctx = services.WithUser(ctx, user)
+	}
+
+	var scopes []string
+	for _, value := range r.URL.Query()["scope"] {
+		scopes = append(scopes, strings.Fields(value)...)
+	}
+
+	token, err := registryTokens.IssueToken(ctx, scopes)
+	if err != nil {
+		i18n.Logf("Ошибка выдачи токена Docker Registry: %v", err)
+		writeRegistryErrorDetail(w, r, http.StatusInternalServerError, "UNKNOWN", "Ошибка выдачи токена", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"token":        token.Token,
+		"access_token": token.Token,
+		"expires_in":   token.ExpiresIn,
+		"issued_at":    token.IssuedAt.UTC().Format(time.RFC3339),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+)
+
+type repositoryDeleter func(ctx context.Context, name string, dryRun, force bool) (*services.DeleteReport, error)
+
+// handleRepositoryDelete обрабатывает DELETE /api/<формат>/repositories/<имя>?dry_run=true&force=true.
+// С dry_run ничего не удаляется, а возвращается отчет о том, что будет удалено.
+func handleRepositoryDelete(w http.ResponseWriter, r *http.Request, repoName string, deleteRepository repositoryDeleter) {
+	query := r.URL.Query()
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+	force, _ := strconv.ParseBool(query.Get("force"))
+
+	report, err := deleteRepository(r.Context(), repoName, dryRun, force)
+	if err != nil {
+		writeServiceError(w, r, "Ошибка удаления репозитория", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/services"
+	"net/http"
+)
+
+type repositoryUpdater[T any] func(ctx context.Context, name string, update services.RepositoryUpdate) (T, *models.Task, error)
+
+// withoutTask приводит изменение настроек, которое не запускает фоновых задач, к repositoryUpdater
+func withoutTask[T any](update func(ctx context.Context, name string, update services.RepositoryUpdate) (T, error)) repositoryUpdater[T] {
+	return func(ctx context.Context, name string, u services.RepositoryUpdate) (T, *models.Task, error) {
+		repo, err := update(ctx, name, u)
+		return repo, nil, err
+	}
+}
+
+// handleRepositoryUpdate обрабатывает PATCH /api/<формат>/repositories/<имя>: изменяются только
+// переданные поля, в ответе возвращается репозиторий с новыми настройками. Если изменение требует
+// загрузки из удаленного источника (новый URL прокси-репозитория), она выполняется в фоновой
+// задаче, и ответ - 202 с ее номером.
+func handleRepositoryUpdate[T any](w http.ResponseWriter, r *http.Request, repoName string, updateRepository repositoryUpdater[T]) {
+	var update services.RepositoryUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Неверный формат запроса", err)
+		return
+	}
+
+	repo, task, err := updateRepository(r.Context(), repoName, update)
+	if err != nil {
+		writeServiceError(w, r, "Ошибка изменения репозитория", err)
+		return
+	}
+
+	if task != nil {
+		writeTaskAccepted(w, r, "Настройки сохранены, загрузка из удаленного репозитория выполняется в фоновой задаче", task)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(repo)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var scheduleService = &services.ScheduleService{}
+
+func handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		schedules, err := scheduleService.ListSchedules(r.Context(), query.Get("repo_type"), query.Get("repository"))
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения списка расписаний", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedules)
+
+	case http.MethodPost:
+		var spec services.ScheduleSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		schedule, err := scheduleService.CreateSchedule(r.Context(), spec)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка создания расписания", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(schedule)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// handleScheduleByID обслуживает /api/schedules/<id> и /api/schedules/<id>/run
+func handleScheduleByID(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+
+	id, err := strconv.Atoi(pathParts[3])
+	if err != nil {
+		writeBadRequest(w, r, "Неверный идентификатор расписания")
+		return
+	}
+
+	if len(pathParts) >= 5 && pathParts[4] == "run" {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, r)
+			return
+		}
+
+		task, err := scheduleService.RunSchedule(r.Context(), id)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка запуска задачи", err)
+			return
+		}
+
+		writeTaskAccepted(w, r, "Задача поставлена в очередь", task)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := scheduleService.GetSchedule(r.Context(), id)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения расписания", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+
+	case http.MethodPatch:
+		var update services.ScheduleUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeBadRequest(w, r, "Ошибка декодирования запроса")
+			return
+		}
+
+		schedule, err := scheduleService.UpdateSchedule(r.Context(), id, update)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка изменения расписания", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+
+	case http.MethodDelete:
+		if err := scheduleService.DeleteSchedule(r.Context(), id); err != nil {
+			writeServiceError(w, r, "Ошибка удаления расписания", err)
+			return
+		}
+
+		response := map[string]string{"message": tr(r, "Расписание успешно удалено")}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/storage"
+	"net/http"
+)
+
+// serveObject отдает объект хранилища артефактов. Если хранилище выдает подписанные ссылки,
+// GET запрос перенаправляется на него, чтобы содержимое не проходило через сервер.
+// name используется для определения Content-Type, если он еще не установлен.
+func serveObject(w http.ResponseWriter, r *http.Request, key, name string) error {
+	if r.Method == http.MethodGet {
+		location, err := storage.Store.PresignGet(r.Context(), key)
+		if err == nil {
+			http.Redirect(w, r, location, http.StatusTemporaryRedirect)
+			return nil
+		}
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			i18n.Logf("Ошибка получения ссылки на %s, объект будет отдан сервером: %v", key, err)
+		}
+	}
+
+	reader, info, err := storage.Store.Open(r.Context(), key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// ServeContent сам обрабатывает HEAD и Range запросы
+	http.ServeContent(w, r, name, info.ModTime, reader)
+	return nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var taskService = &services.TaskService{}
+
+// writeTaskAccepted отвечает 202 с идентификатором задачи, состояние которой можно получить через /api/tasks/<id>
+func writeTaskAccepted(w http.ResponseWriter, r *http.Request, message string, task *models.Task) {
+	response := map[string]interface{}{
+		"message": i18n.T(setResponseLanguage(w, r), message),
+		"task_id": task.ID,
+		"status":  task.Status,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/tasks/%d", task.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleTasks возвращает список задач: GET /api/tasks?type=&repo_type=&repository=&schedule_id=&status=&limit=
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.TaskFilter{
+		Type:       query.Get("type"),
+		RepoType:   query.Get("repo_type"),
+		Repository: query.Get("repository"),
+		Status:     query.Get("status"),
+	}
+	filter.ScheduleID, _ = strconv.Atoi(query.Get("schedule_id"))
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+
+	tasks, err := taskService.ListTasks(r.Context(), filter)
+	if err != nil {
+		writeServiceError(w, r, "Ошибка получения списка задач", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// handleTaskByID обслуживает /api/tasks/<id>: GET - состояние и журнал задачи, DELETE - отмена
+func handleTaskByID(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 {
+		writeBadRequest(w, r, "Неверный URL")
+		return
+	}
+
+	id, err := strconv.Atoi(pathParts[3])
+	if err != nil {
+		writeBadRequest(w, r, "Неверный идентификатор задачи")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		task, err := taskService.GetTask(r.Context(), id)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка получения задачи", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(task)
+
+	case http.MethodDelete:
+		task, err := taskService.CancelTask(r.Context(), id)
+		if err != nil {
+			writeServiceError(w, r, "Ошибка отмены задачи", err)
+			return
+		}
+
+		writeTaskAccepted(w, r, "Задача отменяется", task)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
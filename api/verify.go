@@ -0,0 +1,32 @@
+package api
+
+import (
+	"github.com/Viste/larets/services"
+	"net/http"
+)
+
+var verifyService = &services.VerifyService{}
+
+// handleVerify запускает проверку целостности артефактов:
+// POST /api/verify?repo_type=<format>&repository=<name>. Без параметров проверяется все хранилище.
+func handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	task, err := verifyService.StartVerify(r.Context(), services.VerifyOptions{
+		RepoType:   query.Get("repo_type"),
+		Repository: query.Get("repository"),
+	})
+	if err != nil {
+		writeServiceError(w, r, "Ошибка запуска проверки", err)
+		return
+	}
+
+	writeTaskAccepted(w, r, "Проверка целостности поставлена в очередь", task)
+}
@@ -1,33 +1,65 @@
 package main
 
 import (
+	"context"
 	"github.com/Viste/larets/api"
 	"github.com/Viste/larets/config"
 	"github.com/Viste/larets/db"
-	"log"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/services"
+	"github.com/Viste/larets/storage"
 	"os"
 )
 
 func main() {
-	log.Println("Larets - менеджер-репозиториев")
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+
+	i18n.Logf("Larets - менеджер-репозиториев")
+
+	initDB()
+	initStorage()
+
+	err := db.EnsureStorageDirs(config.Config.StorageBasePath)
+	if err != nil {
+		i18n.Fatalf("Ошибка при создании директорий хранилища: %v", err)
+	}
+
+	authService := &services.AuthService{}
+	if err := authService.EnsureAdmin(); err != nil {
+		i18n.Fatalf("Ошибка при создании администратора: %v", err)
+	}
+
+	services.StartTasks(context.Background())
+	services.StartDownloadTracking(context.Background())
+	if config.Config.EnableScheduler {
+		services.StartScheduler(context.Background())
+	}
+	if config.Config.EnableMetrics {
+		services.RegisterMetrics()
+	}
+
+	api.RunAPIServer()
+}
 
+func initDB() {
 	config.LoadConfig()
 
 	connStr := os.Getenv("DATABASE_URL")
 	if connStr == "" {
-		log.Fatal("Не задана переменная окружения DATABASE_URL")
+		i18n.Fatalf("Не задана переменная окружения DATABASE_URL")
 	}
 
 	err := db.InitDB(connStr)
 	if err != nil {
-		log.Fatal("Ошибка при инициализации базы данных: ", err)
+		i18n.Fatalf("Ошибка при инициализации базы данных: %v", err)
 	}
-	log.Println("База данных успешно инициализирована")
+	i18n.Logf("База данных успешно инициализирована")
+}
 
-	err = db.EnsureStorageDirs(config.Config.StorageBasePath)
-	if err != nil {
-		log.Fatal("Ошибка при создании директорий хранилища: ", err)
+func initStorage() {
+	if err := storage.Init(); err != nil {
+		i18n.Fatalf("Ошибка при инициализации хранилища артефактов: %v", err)
 	}
-
-	api.RunAPIServer()
 }
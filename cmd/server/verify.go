@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/services"
+	"os"
+	"os/signal"
+)
+
+// runVerify выполняет команду larets verify: проверку sha256 артефактов без запуска сервера.
+// Код выхода 0 - все артефакты целы, 1 - найдены отсутствующие или поврежденные, 2 - ошибка проверки.
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	repoType := flags.String("repo-type", "", "формат репозиториев: docker, git или helm")
+	repository := flags.String("repository", "", "имя проверяемого репозитория")
+	asJSON := flags.Bool("json", false, "вывести отчет в формате JSON")
+	flags.Parse(args)
+
+	initDB()
+	initStorage()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := services.VerifyStorage(ctx, services.VerifyOptions{RepoType: *repoType, Repository: *repository})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf(i18n.LogLanguage(), "Ошибка проверки: %v", err))
+		return 2
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		for _, issue := range report.Issues {
+			name := issue.Name
+			if issue.Version != "" {
+				name += ":" + issue.Version
+			}
+			fmt.Printf("%-10s %-6s %s/%s %s\n", issue.Problem, issue.RepoType, issue.Repository, name, issue.Path)
+		}
+		for _, message := range report.Errors {
+			fmt.Println(i18n.Sprintf(i18n.LogLanguage(), "ошибка     %s", message))
+		}
+		fmt.Println(i18n.Sprintf(i18n.LogLanguage(), "Репозиториев: %d, артефактов: %d, файлов: %d (%d байт), отсутствует: %d, повреждено: %d",
+			report.Repositories, report.Artifacts, report.Files, report.Size, report.Missing, report.Corrupted))
+	}
+
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
@@ -2,8 +2,8 @@ package config
 
 import (
 	"fmt"
+	"github.com/Viste/larets/i18n"
 	"github.com/joho/godotenv"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -21,17 +21,51 @@ var Config struct {
 	GitStorage      string
 	HelmStorage     string
 	TempStorage     string
+	BlobStorage     string
+
+	StorageBackend  string // fs или s3, где хранятся blob-ы Docker и архивы чартов Helm
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3Prefix        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3UseSSL        bool
+	S3Presign       bool // перенаправлять скачивания на подписанные ссылки S3
+	S3PresignExpiry int  // срок действия подписанной ссылки в минутах
 
 	DefaultCacheTTL int
 
 	EnableAuth    bool
 	AdminUser     string
-	AdminPassword string // переписать с plaintext
+	AdminPassword string // используется только при первом запуске для создания администратора
+
+	RegistryService     string // имя сервиса в токенах Docker Registry (service, aud)
+	RegistryTokenSecret string // ключ подписи токенов; если не задан, генерируется при запуске
+	RegistryTokenTTL    int    // срок действия токена в минутах
+
+	TaskWorkers     int // количество одновременно выполняемых фоновых задач
+	EnableScheduler bool
+	SchedulerJitter int // случайная задержка запуска по умолчанию в секундах
+
+	LogLanguage string // язык журнала сервера: ru или en
+
+	EnableMetrics bool // отдавать метрики Prometheus на /metrics
+
+	GCGracePeriod int // возраст в минутах, после которого файлы без ссылок и незавершенные загрузки удаляет сборщик мусора
 }
 
 func LoadConfig() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Нет .env файла, используем только переменные окружения")
+	envErr := godotenv.Load()
+
+	Config.LogLanguage = getEnv("LOG_LANGUAGE", i18n.DefaultLanguage)
+	if err := i18n.SetLogLanguage(Config.LogLanguage); err != nil {
+		i18n.Logf("%v, используем %s", err, i18n.DefaultLanguage)
+		Config.LogLanguage = i18n.DefaultLanguage
+	}
+
+	if envErr != nil {
+		i18n.Logf("Нет .env файла, используем только переменные окружения")
 	}
 
 	Config.EnableDocker = getEnvBool("ENABLE_DOCKER", true)
@@ -46,6 +80,18 @@ func LoadConfig() {
 	Config.GitStorage = filepath.Join(Config.StorageBasePath, "git")
 	Config.HelmStorage = filepath.Join(Config.StorageBasePath, "helm")
 	Config.TempStorage = filepath.Join(Config.StorageBasePath, "temp")
+	Config.BlobStorage = filepath.Join(Config.StorageBasePath, "blobs")
+
+	Config.StorageBackend = getEnv("STORAGE_BACKEND", "fs")
+	Config.S3Endpoint = getEnv("S3_ENDPOINT", "")
+	Config.S3Region = getEnv("S3_REGION", "")
+	Config.S3Bucket = getEnv("S3_BUCKET", "")
+	Config.S3Prefix = getEnv("S3_PREFIX", "")
+	Config.S3AccessKey = getEnv("S3_ACCESS_KEY", "")
+	Config.S3SecretKey = getEnv("S3_SECRET_KEY", "")
+	Config.S3UseSSL = getEnvBool("S3_USE_SSL", true)
+	Config.S3Presign = getEnvBool("S3_PRESIGN", false)
+	Config.S3PresignExpiry = getEnvInt("S3_PRESIGN_EXPIRY", 15)
 
 	Config.DefaultCacheTTL = getEnvInt("DEFAULT_CACHE_TTL", 1440) // 24 часа в минутах
 
@@ -53,7 +99,19 @@ func LoadConfig() {
 	Config.AdminUser = getEnv("ADMIN_USER", "admin")
 	Config.AdminPassword = getEnv("ADMIN_PASSWORD", "admin") // Не рекомендуется в production
 
-	log.Println("Конфигурация загружена успешно")
+	Config.RegistryService = getEnv("REGISTRY_SERVICE", "larets")
+	Config.RegistryTokenSecret = getEnv("REGISTRY_TOKEN_SECRET", "")
+	Config.RegistryTokenTTL = getEnvInt("REGISTRY_TOKEN_TTL", 5)
+
+	Config.TaskWorkers = getEnvInt("TASK_WORKERS", 2)
+	Config.EnableScheduler = getEnvBool("ENABLE_SCHEDULER", true)
+	Config.SchedulerJitter = getEnvInt("SCHEDULER_JITTER", 30)
+
+	Config.EnableMetrics = getEnvBool("ENABLE_METRICS", true)
+
+	Config.GCGracePeriod = getEnvInt("GC_GRACE_PERIOD", 1440)
+
+	i18n.Logf("Конфигурация загружена успешно")
 }
 
 func getEnv(key, defaultValue string) string {
@@ -83,7 +141,7 @@ func getEnvInt(key string, defaultValue int) int {
 	var result int
 	_, err := fmt.Sscanf(value, "%d", &result)
 	if err != nil {
-		log.Printf("Ошибка при парсинге значения %s: %v, используем значение по умолчанию %d", key, err, defaultValue)
+		i18n.Logf("Ошибка при парсинге значения %s: %v, используем значение по умолчанию %d", key, err, defaultValue)
 		return defaultValue
 	}
 
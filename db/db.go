@@ -1,10 +1,10 @@
 package db
 
 import (
+	"github.com/Viste/larets/i18n"
 	"github.com/Viste/larets/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"log"
 	"os"
 	"path/filepath"
 )
@@ -12,12 +12,13 @@ import (
 var DB *gorm.DB
 
 func InitDB(connStr string) error {
-	db, err := gorm.Open(postgres.Open(connStr), &gorm.Config{})
+	// TranslateError: нарушение уникального индекса возвращается как gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(connStr), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return err
 	}
 
-	log.Println("Подключение к базе данных успешно установлено")
+	i18n.Logf("Подключение к базе данных успешно установлено")
 	DB = db
 
 	err = migrateDB(db)
@@ -29,7 +30,7 @@ func InitDB(connStr string) error {
 }
 
 func migrateDB(db *gorm.DB) error {
-	log.Println("Запуск миграций базы данных...")
+	i18n.Logf("Запуск миграций базы данных...")
 
 	err := db.AutoMigrate(
 		&models.DockerRepository{},
@@ -38,21 +39,37 @@ func migrateDB(db *gorm.DB) error {
 		&models.GroupMember{},
 		&models.Artifact{},
 		&models.DockerImage{},
+		&models.DockerUpload{},
 		&models.HelmChart{},
 		&models.StoredFile{},
+		&models.Blob{},
+		&models.User{},
+		&models.APIToken{},
+		&models.UserGroup{},
+		&models.UserGroupMember{},
+		&models.Permission{},
+		&models.Schedule{},
+		&models.Task{},
+		&models.TaskLog{},
+		&models.CleanupPolicy{},
+		&models.DownloadStat{},
 	)
 
+	if err == nil {
+		err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_helm_charts_version ON helm_charts (repository_id, name, version)").Error
+	}
+
 	if err != nil {
-		log.Printf("Ошибка выполнения миграций: %v", err)
+		i18n.Logf("Ошибка выполнения миграций: %v", err)
 		return err
 	}
 
-	log.Println("Миграции успешно выполнены")
+	i18n.Logf("Миграции успешно выполнены")
 	return nil
 }
 
 func EnsureStorageDirs(basePath string) error {
-	log.Printf("Создание структуры директорий для хранилища в %s", basePath)
+	i18n.Logf("Создание структуры директорий для хранилища в %s", basePath)
 
 	if _, err := os.Stat(basePath); os.IsNotExist(err) {
 		err = os.MkdirAll(basePath, 0755)
@@ -66,6 +83,7 @@ func EnsureStorageDirs(basePath string) error {
 		filepath.Join(basePath, "git"),
 		filepath.Join(basePath, "helm"),
 		filepath.Join(basePath, "temp"),
+		filepath.Join(basePath, "blobs", "sha256"),
 	}
 
 	for _, dir := range dirs {
@@ -77,6 +95,6 @@ func EnsureStorageDirs(basePath string) error {
 		}
 	}
 
-	log.Println("Структура директорий для хранилища успешно создана")
+	i18n.Logf("Структура директорий для хранилища успешно создана")
 	return nil
 }
@@ -0,0 +1,615 @@
+package i18n
+
+// catalogEN - английские переводы сообщений. Ключ - исходное сообщение из кода, включая
+// глаголы форматирования: порядок и типы аргументов в переводе должны совпадать.
+var catalogEN = map[string]string{
+	// api
+	"Ошибка получения списка групп пользователей": "Failed to list user groups",
+	"Ошибка декодирования запроса":                "Failed to decode request",
+	"Ошибка создания группы пользователей":        "Failed to create user group",
+	"Неверный URL": "Invalid URL",
+	"Ошибка получения группы пользователей":                         "Failed to get user group",
+	"Ошибка получения состава группы пользователей":                 "Failed to get user group members",
+	"Ошибка удаления группы пользователей":                          "Failed to delete user group",
+	"Группа пользователей успешно удалена":                          "User group deleted",
+	"Ошибка добавления пользователя в группу":                       "Failed to add user to group",
+	"Пользователь успешно добавлен в группу":                        "User added to group",
+	"Необходимо указать пользователя":                               "User is required",
+	"Ошибка исключения пользователя из группы":                      "Failed to remove user from group",
+	"Пользователь успешно исключен из группы":                       "User removed from group",
+	"Ошибка получения списка прав":                                  "Failed to list permissions",
+	"Ошибка назначения права":                                       "Failed to grant permission",
+	"Неверный идентификатор права":                                  "Invalid permission ID",
+	"Ошибка отзыва права":                                           "Failed to revoke permission",
+	"Право успешно отозвано":                                        "Permission revoked",
+	"Запуск API сервера на порту :%s":                               "Starting API server on port :%s",
+	"Ошибка получения списка репозиториев":                          "Failed to list repositories",
+	"Ошибка создания репозитория":                                   "Failed to create repository",
+	"Репозиторий успешно создан":                                    "Repository created",
+	"Ошибка получения информации о репозитории":                     "Failed to get repository information",
+	"Ошибка поиска образов":                                         "Failed to search images",
+	"Ошибка получения списка образов":                               "Failed to list images",
+	"Необходимо указать параметр repository или q":                  "Parameter repository or q is required",
+	"Необходимо указать параметры repository, name и tag":           "Parameters repository, name and tag are required",
+	"Ошибка сохранения образа":                                      "Failed to save image",
+	"Образ успешно сохранен":                                        "Image saved",
+	"Репозиторий создан, клонирование выполняется в фоновой задаче": "Repository created, cloning runs in a background task",
+	"Репозиторий создан, индекс загружается в фоновой задаче":       "Repository created, the index is being downloaded in a background task",
+	"Ошибка синхронизации репозитория":                              "Failed to sync repository",
+	"Синхронизация поставлена в очередь":                            "Sync queued",
+	"Настройки сохранены, загрузка из удаленного репозитория выполняется в фоновой задаче": "Settings saved, fetching from the remote repository runs in a background task",
+	"Необходимо указать параметр repository":                                               "Parameter repository is required",
+	"Ошибка получения списка чартов":                                                       "Failed to list charts",
+	"Необходимо указать параметры repository и filename":                                   "Parameters repository and filename are required",
+	"Файл должен иметь расширение .tgz":                                                    "File must have the .tgz extension",
+	"Ошибка загрузки чарта":                                                                "Failed to upload chart",
+	"Чарт успешно загружен":                                                                "Chart uploaded",
+	"Необходимо указать параметры repository, name и version":                              "Parameters repository, name and version are required",
+	"Ошибка удаления чарта":                                                                "Failed to delete chart",
+	"Чарт успешно удален":                                                                  "Chart deleted",
+	"Репозиторий не найден":                                                                "Repository not found",
+	"Ошибка получения индекса репозитория":                                                 "Failed to get repository index",
+	"Ошибка получения чарта":                                                               "Failed to get chart",
+	"Ошибка чтения чарта":                                                                  "Failed to read chart",
+	"Неверный путь":                                                                        "Invalid path",
+	"Ошибка аутентификации: %v":                                                            "Authentication error: %v",
+	"требуется аутентификация":                                                             "authentication required",
+	"Требуется аутентификация":                                                             "Authentication required",
+	"Недостаточно прав":                                                                    "Insufficient permissions",
+	"Ошибка получения списка пользователей":                                                "Failed to list users",
+	"Ошибка создания пользователя":                                                         "Failed to create user",
+	"Аутентификация выключена":                                                             "Authentication is disabled",
+	"Ошибка получения пользователя":                                                        "Failed to get user",
+	"Ошибка обновления пользователя":                                                       "Failed to update user",
+	"Ошибка удаления пользователя":                                                         "Failed to delete user",
+	"Пользователь успешно удален":                                                          "User deleted",
+	"Ошибка получения списка токенов":                                                      "Failed to list tokens",
+	"Ошибка создания токена":                                                               "Failed to create token",
+	"Неверный идентификатор токена":                                                        "Invalid token ID",
+	"Ошибка удаления токена":                                                               "Failed to delete token",
+	"Токен успешно удален":                                                                 "Token deleted",
+	"Ошибка получения списка правил очистки":                                               "Failed to list cleanup policies",
+	"Ошибка создания правила очистки":                                                      "Failed to create cleanup policy",
+	"Неверный идентификатор правила очистки":                                               "Invalid cleanup policy ID",
+	"Ошибка предпросмотра очистки":                                                         "Failed to preview cleanup",
+	"Ошибка запуска очистки":                                                               "Failed to start cleanup",
+	"Очистка поставлена в очередь":                                                         "Cleanup queued",
+	"Ошибка получения правила очистки":                                                     "Failed to get cleanup policy",
+	"Ошибка изменения правила очистки":                                                     "Failed to update cleanup policy",
+	"Ошибка удаления правила очистки":                                                      "Failed to delete cleanup policy",
+	"Правило очистки успешно удалено":                                                      "Cleanup policy deleted",
+	"Ошибка Docker Registry API: %v":                                                       "Docker Registry API error: %v",
+	"Метод не поддерживается":                                                              "Method not allowed",
+	"Неверный путь запроса":                                                                "Invalid request path",
+	"Ошибка чтения манифеста":                                                              "Failed to read manifest",
+	"Манифест слишком большой":                                                             "Manifest is too large",
+	"Неверный заголовок Content-Range":                                                     "Invalid Content-Range header",
+	"Не указан параметр digest":                                                            "Parameter digest is required",
+	"Неверное количество дней":                                                             "Invalid number of days",
+	"Ошибка получения статистики скачиваний":                                               "Failed to get download statistics",
+	"Ошибка запуска сборки мусора":                                                         "Failed to start garbage collection",
+	"Сборка мусора поставлена в очередь":                                                   "Garbage collection queued",
+	"Поддерживается только smart HTTP протокол git":                                        "Only the git smart HTTP protocol is supported",
+	"Ошибка доступа к git репозиторию":                                                     "Failed to access git repository",
+	"Ошибка получения ссылок git репозитория %s: %v":                                       "Failed to get refs of git repository %s: %v",
+	"Ошибка чтения сжатого запроса":                                                        "Failed to read compressed request",
+	"Ошибка обработки %s для репозитория %s: %v":                                           "Failed to handle %s for repository %s: %v",
+	"Ошибка получения участников группы":                                                   "Failed to get group members",
+	"Ошибка обновления участников группы":                                                  "Failed to update group members",
+	"Состав группы успешно обновлен":                                                       "Group members updated",
+	"Ошибка добавления участника группы":                                                   "Failed to add group member",
+	"Участник успешно добавлен в группу":                                                   "Member added to group",
+	"Необходимо указать участника группы":                                                  "Group member is required",
+	"Ошибка исключения участника группы":                                                   "Failed to remove group member",
+	"Участник успешно исключен из группы":                                                  "Member removed from group",
+	"токен не разрешает %s для %s":                                                         "token does not allow %s on %s",
+	"неверное имя пользователя или пароль":                                                 "invalid username or password",
+	"Ошибка выдачи токена Docker Registry: %v":                                             "Failed to issue Docker Registry token: %v",
+	"Ошибка выдачи токена":                                                                 "Failed to issue token",
+	"Ошибка удаления репозитория":                                                          "Failed to delete repository",
+	"Неверный формат запроса":                                                              "Invalid request format",
+	"Ошибка изменения репозитория":                                                         "Failed to update repository",
+	"Ошибка получения списка расписаний":                                                   "Failed to list schedules",
+	"Ошибка создания расписания":                                                           "Failed to create schedule",
+	"Неверный идентификатор расписания":                                                    "Invalid schedule ID",
+	"Ошибка запуска задачи":                                                                "Failed to start task",
+	"Задача поставлена в очередь":                                                          "Task queued",
+	"Ошибка получения расписания":                                                          "Failed to get schedule",
+	"Ошибка изменения расписания":                                                          "Failed to update schedule",
+	"Ошибка удаления расписания":                                                           "Failed to delete schedule",
+	"Расписание успешно удалено":                                                           "Schedule deleted",
+	"Ошибка получения ссылки на %s, объект будет отдан сервером: %v":                       "Failed to get a link to %s, the object will be served by the server: %v",
+	"Ошибка получения списка задач":                                                        "Failed to list tasks",
+	"Неверный идентификатор задачи":                                                        "Invalid task ID",
+	"Ошибка получения задачи":                                                              "Failed to get task",
+	"Ошибка отмены задачи":                                                                 "Failed to cancel task",
+	"Задача отменяется":                                                                    "Task is being canceled",
+	"Ошибка запуска проверки":                                                              "Failed to start verification",
+	"Проверка целостности поставлена в очередь":                                            "Integrity verification queued",
+
+	// services
+	"недостаточно прав":                                                         "insufficient permissions",
+	"неверное описание права":                                                   "invalid permission",
+	"группа пользователей с таким именем уже существует":                        "user group with this name already exists",
+	"ошибка получения прав пользователя: %w":                                    "failed to get user permissions: %w",
+	"%w: репозиторий %s":                                                        "%w: repository %s",
+	"%w: %s на репозиторий %s":                                                  "%w: %s on repository %s",
+	"%w: недопустимое имя группы %q":                                            "%w: invalid group name %q",
+	"ошибка сохранения группы пользователей: %w":                                "failed to save user group: %w",
+	"Создана группа пользователей %s":                                           "Created user group %s",
+	"группа пользователей не найдена: %w":                                       "user group not found: %w",
+	"ошибка удаления состава группы: %w":                                        "failed to delete group membership: %w",
+	"ошибка удаления прав группы: %w":                                           "failed to delete group permissions: %w",
+	"ошибка удаления группы пользователей: %w":                                  "failed to delete user group: %w",
+	"Удалена группа пользователей %s":                                           "Deleted user group %s",
+	"ошибка добавления пользователя в группу: %w":                               "failed to add user to group: %w",
+	"Пользователь %s добавлен в группу %s":                                      "User %s added to group %s",
+	"ошибка исключения пользователя из группы: %w":                              "failed to remove user from group: %w",
+	"пользователь %s не входит в группу %s: %w":                                 "user %s is not a member of group %s: %w",
+	"Пользователь %s исключен из группы %s":                                     "User %s removed from group %s",
+	"%w: неизвестный тип субъекта %q":                                           "%w: unknown subject type %q",
+	"%w: неизвестный формат %q":                                                 "%w: unknown format %q",
+	"%w: неизвестное право %q":                                                  "%w: unknown permission %q",
+	"%w: не указан шаблон имени репозитория":                                    "%w: repository name pattern is required",
+	"%w: неверный шаблон %q":                                                    "%w: invalid pattern %q",
+	"ошибка сохранения права: %w":                                               "failed to save permission: %w",
+	"Назначено право %s на %s репозитории %s для %s %s":                         "Granted %s on %s repositories %s to %s %s",
+	"ошибка удаления права: %w":                                                 "failed to delete permission: %w",
+	"право не найдено: %w":                                                      "permission not found: %w",
+	"Отозвано право %d":                                                         "Revoked permission %d",
+	"пользователь с таким именем уже существует":                                "user with this name already exists",
+	"неверные данные пользователя":                                              "invalid user data",
+	"ошибка проверки пользователей: %w":                                         "failed to check users: %w",
+	"ошибка создания администратора: %w":                                        "failed to create administrator: %w",
+	"ВНИМАНИЕ: администратор %s создан с паролем по умолчанию, смените его":     "WARNING: administrator %s was created with the default password, change it",
+	"Создан администратор %s":                                                   "Created administrator %s",
+	"%w: недопустимое имя пользователя %q":                                      "%w: invalid username %q",
+	"%w: пароль не может быть пустым":                                           "%w: password cannot be empty",
+	"ошибка хеширования пароля: %w":                                             "failed to hash password: %w",
+	"ошибка сохранения пользователя: %w":                                        "failed to save user: %w",
+	"Создан пользователь %s":                                                    "Created user %s",
+	"пользователь не найден: %w":                                                "user not found: %w",
+	"ошибка удаления токенов пользователя: %w":                                  "failed to delete user tokens: %w",
+	"ошибка удаления пользователя из групп: %w":                                 "failed to remove user from groups: %w",
+	"ошибка удаления прав пользователя: %w":                                     "failed to delete user permissions: %w",
+	"ошибка удаления пользователя: %w":                                          "failed to delete user: %w",
+	"Удален пользователь %s":                                                    "Deleted user %s",
+	"ошибка получения пользователя: %w":                                         "failed to get user: %w",
+	"Ошибка обновления времени входа пользователя %s: %v":                       "Failed to update last login of user %s: %v",
+	"ошибка получения токена: %w":                                               "failed to get token: %w",
+	"Ошибка обновления времени использования токена %d: %v":                     "Failed to update last use of token %d: %v",
+	"ошибка генерации токена: %w":                                               "failed to generate token: %w",
+	"ошибка сохранения токена: %w":                                              "failed to save token: %w",
+	"Выпущен токен %q для пользователя %s":                                      "Issued token %q for user %s",
+	"ошибка удаления токена: %w":                                                "failed to delete token: %w",
+	"токен не найден: %w":                                                       "token not found: %w",
+	"ошибка сохранения blob: %w":                                                "failed to store blob: %w",
+	"ошибка записи blob: %w":                                                    "failed to write blob: %w",
+	"ошибка чтения blob: %w":                                                    "failed to read blob: %w",
+	"ошибка сохранения записи blob: %w":                                         "failed to save blob record: %w",
+	"ошибка сохранения связи с blob: %w":                                        "failed to save blob reference: %w",
+	"ошибка обновления счетчика ссылок blob: %w":                                "failed to update blob reference count: %w",
+	"ошибка проверки связи blob с репозиторием: %w":                             "failed to check blob reference to repository: %w",
+	"ошибка получения связей с blob: %w":                                        "failed to get blob references: %w",
+	"ошибка удаления связей с blob: %w":                                         "failed to delete blob references: %w",
+	"недопустимое правило очистки":                                              "invalid cleanup policy",
+	"%w: очистка поддерживается только для docker и helm репозиториев":          "%w: cleanup is supported only for docker and helm repositories",
+	"%w: группа не хранит артефакты, правила задаются для ее участников":        "%w: a group does not store artifacts, policies are set on its members",
+	"%w: keep_last и not_downloaded_days не могут быть отрицательными":          "%w: keep_last and not_downloaded_days cannot be negative",
+	"%w: необходимо указать keep_last, not_downloaded_days или version_pattern": "%w: keep_last, not_downloaded_days or version_pattern is required",
+	"%w: неверный version_pattern: %v":                                          "%w: invalid version_pattern: %v",
+	"правило очистки не найдено: %w":                                            "cleanup policy not found: %w",
+	"ошибка сохранения правила очистки: %w":                                     "failed to save cleanup policy: %w",
+	"Создано правило очистки %d для %s репозитория %s":                          "Created cleanup policy %d for %s repository %s",
+	"ошибка получения правил очистки: %w":                                       "failed to get cleanup policies: %w",
+	"ошибка удаления правила очистки: %w":                                       "failed to delete cleanup policy: %w",
+	"Удалено правило очистки %d для %s репозитория %s":                          "Deleted cleanup policy %d for %s repository %s",
+	"%w: очистка не поддерживается для %s репозиториев":                         "%w: cleanup is not supported for %s repositories",
+	"ошибка получения артефактов: %w":                                           "failed to get artifacts: %w",
+	"неверные параметры задачи: %w":                                             "invalid task parameters: %w",
+	"Нет правил очистки для применения":                                         "No cleanup policies to apply",
+	"Правило %d: к удалению %d версий":                                          "Policy %d: %d versions to delete",
+	"ошибка удаления %s:%s: %w":                                                 "failed to delete %s:%s: %w",
+	"Удалена версия %s:%s":                                                      "Deleted version %s:%s",
+	"Правило очистки %d удалило из %s репозитория %s версий: %d":                "Cleanup policy %d deleted from %s repository %s versions: %d",
+	"ошибка создания директории хранилища: %w":                                  "failed to create storage directory: %w",
+	"ошибка сохранения репозитория: %w":                                         "failed to save repository: %w",
+	"Создан Docker репозиторий: %s, тип: %s":                                    "Created Docker repository: %s, type: %s",
+	"ошибка удаления записей образов: %w":                                       "failed to delete image records: %w",
+	"ошибка удаления сессий загрузки: %w":                                       "failed to delete upload sessions: %w",
+	"ошибка удаления репозитория: %w":                                           "failed to delete repository: %w",
+	"Удален Docker репозиторий %s: образов %d, загрузок %d":                     "Deleted Docker repository %s: images %d, uploads %d",
+	"Изменены настройки Docker репозитория %s":                                  "Updated settings of Docker repository %s",
+	"%w: нельзя сохранять образы в репозиторий %s":                              "%w: images cannot be saved to repository %s",
+	"ошибка создания временной директории: %w":                                  "failed to create temporary directory: %w",
+	"ошибка чтения архива образа: %w":                                           "failed to read image archive: %w",
+	"ошибка чтения manifest.json: %w":                                           "failed to read manifest.json: %w",
+	"ошибка создания временного файла: %w":                                      "failed to create temporary file: %w",
+	"ошибка записи данных образа: %w":                                           "failed to write image data: %w",
+	"%w: архив не содержит manifest.json, ожидается результат docker save":      "%w: archive does not contain manifest.json, docker save output is expected",
+	"в архиве отсутствует файл %s":                                              "file %s is missing from the archive",
+	"ошибка формирования манифеста: %w":                                         "failed to build manifest: %w",
+	"Сохранен Docker образ: %s:%s в репозиторий %s":                             "Saved Docker image %s:%s to repository %s",
+	"Используем кешированный образ: %s:%s":                                      "Using cached image: %s:%s",
+	"Ошибка обновления образа %s:%s из %s, используем кеш: %v":                  "Failed to refresh image %s:%s from %s, using cache: %v",
+	"ошибка обновления записи образа: %w":                                       "failed to update image record: %w",
+	"Образ %s:%s в удаленном репозитории не изменился":                          "Image %s:%s has not changed in the remote repository",
+	"Получение образа %s:%s из удаленного репозитория %s":                       "Fetching image %s:%s from remote repository %s",
+	"ошибка получения манифеста %s: %w":                                         "failed to fetch manifest %s: %w",
+	"Образ %s:%s получен из удаленного репозитория и сохранен в кеше":           "Image %s:%s fetched from the remote repository and cached",
+	"образ не найден: %w":                                                       "image not found: %w",
+	"ошибка удаления записи образа: %w":                                         "failed to delete image record: %w",
+	"ошибка поиска ссылок на манифест: %w":                                      "failed to find manifest references: %w",
+	"ошибка поиска вложенного манифеста: %w":                                    "failed to find child manifest: %w",
+	"Ошибка получения манифеста %s:%s из репозитория %s группы %s: %v":          "Failed to get manifest %s:%s from repository %s of group %s: %v",
+	"Ошибка получения blob %s из репозитория %s группы %s: %v":                  "Failed to get blob %s from repository %s of group %s: %v",
+	"удаленный реестр требует аутентификацию, но учетные данные не указаны":     "remote registry requires authentication, but no credentials are configured",
+	"неподдерживаемая схема аутентификации удаленного реестра: %q":              "unsupported remote registry authentication scheme: %q",
+	"в Bearer challenge удаленного реестра не указан realm":                     "remote registry Bearer challenge has no realm",
+	"неверный realm в Bearer challenge: %w":                                     "invalid realm in Bearer challenge: %w",
+	"ошибка получения токена удаленного реестра: %w":                            "failed to get remote registry token: %w",
+	"ошибка получения токена удаленного реестра, код ответа: %d":                "failed to get remote registry token, status code: %d",
+	"ошибка декодирования токена удаленного реестра: %w":                        "failed to decode remote registry token: %w",
+	"сервис авторизации удаленного реестра не вернул токен":                     "remote registry authorization service returned no token",
+	"код ответа: %d":                                                            "status code: %d",
+	"ошибка получения манифеста: %w":                                            "failed to fetch manifest: %w",
+	"ошибка получения манифеста, код ответа: %d":                                "failed to fetch manifest, status code: %d",
+	"ошибка чтения манифеста: %w":                                               "failed to read manifest: %w",
+	"%w: upstream вернул устаревший манифест schema1":                           "%w: upstream returned a deprecated schema1 manifest",
+	"ошибка получения blob %s: %w":                                              "failed to fetch blob %s: %w",
+	"ошибка получения blob %s, код ответа: %d":                                  "failed to fetch blob %s, status code: %d",
+	"ошибка записи blob %s: %w":                                                 "failed to write blob %s: %w",
+	"%w: upstream вернул sha256:%s вместо %s":                                   "%w: upstream returned sha256:%s instead of %s",
+	"Blob %s (%d байт) получен из удаленного репозитория":                       "Blob %s (%d bytes) fetched from the remote repository",
+	"репозиторий не найден":                                                     "repository not found",
+	"манифест не найден":                                                        "manifest not found",
+	"blob не найден":                                                            "blob not found",
+	"неверный формат digest":                                                    "invalid digest format",
+	"неверный манифест":                                                         "invalid manifest",
+	"манифест ссылается на отсутствующий blob":                                  "manifest references a missing blob",
+	"ошибка поиска манифеста: %w":                                               "failed to find manifest: %w",
+	"ошибка получения списка тегов: %w":                                         "failed to list tags: %w",
+	"ошибка получения каталога: %w":                                             "failed to get catalog: %w",
+	"Сохранен манифест %s:%s (%s) в репозиторий %s":                             "Saved manifest %s:%s (%s) to repository %s",
+	"%w: ожидался %s, получен %s":                                               "%w: expected %s, got %s",
+	"%w: поддерживается только schemaVersion 2":                                 "%w: only schemaVersion 2 is supported",
+	"%w: отсутствует config":                                                    "%w: config is missing",
+	"ошибка записи манифеста: %w":                                               "failed to write manifest: %w",
+	"ошибка поиска образа: %w":                                                  "failed to find image: %w",
+	"ошибка сохранения записи образа: %w":                                       "failed to save image record: %w",
+	"сессия загрузки не найдена":                                                "upload session not found",
+	"неверный диапазон загрузки":                                                "invalid upload range",
+	"операция запрещена для этого репозитория":                                  "operation is not allowed for this repository",
+	"%w: загружать образы можно только в хостовый репозиторий":                  "%w: images can be pushed only to a hosted repository",
+	"ошибка создания директории загрузок: %w":                                   "failed to create uploads directory: %w",
+	"ошибка создания файла загрузки: %w":                                        "failed to create upload file: %w",
+	"ошибка сохранения сессии загрузки: %w":                                     "failed to save upload session: %w",
+	"ошибка получения сессии загрузки: %w":                                      "failed to get upload session: %w",
+	"%w: ожидалось начало %d, получено %d":                                      "%w: expected start %d, got %d",
+	"ошибка открытия файла загрузки: %w":                                        "failed to open upload file: %w",
+	"ошибка обновления сессии загрузки: %w":                                     "failed to update upload session: %w",
+	"ошибка записи данных загрузки: %w":                                         "failed to write upload data: %w",
+	"ошибка вычисления digest: %w":                                              "failed to compute digest: %w",
+	"%w: ожидался %s, получен sha256:%s":                                        "%w: expected %s, got sha256:%s",
+	"Загружен blob %s для образа %s в репозиторий %s":                           "Uploaded blob %s for image %s to repository %s",
+	"Ошибка удаления сессии загрузки %s: %v":                                    "Failed to delete upload session %s: %v",
+	"Учет скачиваний запущен":                                                   "Download tracking started",
+	"Очередь учета скачиваний переполнена, пропущено скачиваний: %d":            "Download tracking queue is full, downloads skipped: %d",
+	"Ошибка учета скачивания %s %s:%s: %v":                                      "Failed to track download of %s %s:%s: %v",
+	"Ошибка учета скачивания blob %s образа %s: %v":                             "Failed to track download of blob %s of image %s: %v",
+	"Ошибка записи статистики скачиваний %s %s:%s: %v":                          "Failed to write download statistics for %s %s:%s: %v",
+	"формат %s не хранит артефакты":                                             "format %s does not store artifacts",
+	"недопустимые параметры статистики скачиваний":                              "invalid download statistics parameters",
+	"%w: не указан репозиторий":                                                 "%w: repository is required",
+	"ошибка получения статистики скачиваний: %w":                                "failed to get download statistics: %w",
+	"не найдено":          "not found",
+	"конфликт":            "conflict",
+	"недопустимый запрос": "invalid request",
+	"репозиторий с таким именем уже существует":          "repository with this name already exists",
+	"операция доступна только для хостового репозитория": "operation is available only for a hosted repository",
+	"репозиторий не является прокси":                     "repository is not a proxy",
+	"URL удаленного репозитория не указан":               "remote repository URL is not set",
+	"ошибка получения репозитория %s: %w":                "failed to get repository %s: %w",
+	"сборка мусора": "garbage collection",
+	"обслуживание хранилища уже выполняется":                                      "storage maintenance is already running",
+	"Запись в хранилище приостановлена на время сборки мусора":                    "Writes to storage are paused during garbage collection",
+	"Поиск используемых blob-ов":                                                  "Finding blobs in use",
+	"Удаление blob-ов без ссылок":                                                 "Deleting unreferenced blobs",
+	"Удаление незавершенных загрузок":                                             "Deleting incomplete uploads",
+	"Удаление временных файлов":                                                   "Deleting temporary files",
+	"Удаление файлов без ссылок в репозиториях":                                   "Deleting unreferenced files in repositories",
+	"blob-ов %d (%d байт), загрузок %d (%d байт), файлов без ссылок %d (%d байт)": "blobs %d (%d bytes), uploads %d (%d bytes), unreferenced files %d (%d bytes)",
+	"Будет удалено: %s":                                                           "Will delete: %s",
+	"Пробная сборка мусора: будет удалено %s":                                     "Garbage collection dry run: will delete %s",
+	"Удалено: %s": "Deleted: %s",
+	"Сборка мусора завершена: удалено %s":                                  "Garbage collection finished: deleted %s",
+	"ошибка получения образов: %w":                                         "failed to get images: %w",
+	"Используемых blob-ов: %d":                                             "Blobs in use: %d",
+	"ошибка получения blob-ов: %w":                                         "failed to get blobs: %w",
+	"ошибка поиска записи blob: %w":                                        "failed to find blob record: %w",
+	"Ошибка обхода хранилища blob-ов: %v":                                  "Failed to walk blob storage: %v",
+	"Blob %s используется, но его счетчик ссылок равен нулю":               "Blob %s is in use, but its reference count is zero",
+	"Ошибка удаления записи blob %s: %v":                                   "Failed to delete blob record %s: %v",
+	"Ошибка удаления blob %s: %v":                                          "Failed to delete blob %s: %v",
+	"ошибка получения размера blob: %w":                                    "failed to get blob size: %w",
+	"ошибка получения сессий загрузки: %w":                                 "failed to get upload sessions: %w",
+	"Ошибка удаления файла загрузки %s: %v":                                "Failed to delete upload file %s: %v",
+	"ошибка получения задач: %w":                                           "failed to get tasks: %w",
+	"ошибка получения %s репозиториев: %w":                                 "failed to get %s repositories: %w",
+	"ошибка получения чартов репозитория %s: %w":                           "failed to get charts of repository %s: %w",
+	"Ошибка обхода чартов репозитория %s: %v":                              "Failed to walk charts of repository %s: %v",
+	"Ошибка чтения %s: %v":                                                 "Failed to read %s: %v",
+	"Ошибка удаления %s: %v":                                               "Failed to delete %s: %v",
+	"ошибка инициализации Git репозитория: %w":                             "failed to initialize Git repository: %w",
+	"Ошибка установки основной ветки %s для репозитория %s: %v":            "Failed to set default branch %s for repository %s: %v",
+	"Создан Git репозиторий: %s, тип: %s, клонирование в задаче %d":        "Created Git repository: %s, type: %s, cloning in task %d",
+	"Создан Git репозиторий: %s, тип: %s":                                  "Created Git repository: %s, type: %s",
+	"Удален Git репозиторий %s":                                            "Deleted Git repository %s",
+	"%w: недопустимое имя ветки %s":                                        "%w: invalid branch name %s",
+	"ошибка установки основной ветки: %w":                                  "failed to set default branch: %w",
+	"Изменены настройки Git репозитория %s":                                "Updated settings of Git repository %s",
+	"Изменены настройки Git репозитория %s, клонирование с %s в задаче %d": "Updated settings of Git repository %s, cloning from %s in task %d",
+	"%w: клонирование (задача %d)":                                         "%w: mirroring (task %d)",
+	"ошибка клонирования удаленного репозитория: %w":                       "failed to clone remote repository: %w",
+	"ошибка замены зеркала репозитория: %w":                                "failed to replace repository mirror: %w",
+	"Git репозиторий %s клонирован с %s":                                   "Git repository %s cloned from %s",
+	"репозиторий не найден: %w":                                            "repository not found: %w",
+	"Клонирование %s":                                                      "Cloning %s",
+	"Клонирование с нового адреса %s":                                      "Cloning from the new address %s",
+	"Репозиторий %s удален, так как клонирование не выполнено":             "Repository %s deleted because cloning failed",
+	"Синхронизация Git репозитория %s с удаленным источником %s":           "Syncing Git repository %s with remote %s",
+	"Синхронизация с удаленным источником %s":                              "Syncing with remote %s",
+	"ошибка выполнения git fetch: %w":                                      "git fetch failed: %w",
+	"ошибка обновления записи репозитория: %w":                             "failed to update repository record: %w",
+	"Git репозиторий %s успешно синхронизирован":                           "Git repository %s synced",
+	"ошибка получения списка веток: %w":                                    "failed to list branches: %w",
+	"ошибка получения истории коммитов: %w":                                "failed to get commit history: %w",
+	"%w: нельзя создавать ветки в репозитории %s":                          "%w: branches cannot be created in repository %s",
+	"ошибка создания ветки: %w":                                            "failed to create branch: %w",
+	"Создана ветка %s в репозитории %s":                                    "Created branch %s in repository %s",
+	"%w: нельзя удалять ветки в репозитории %s":                            "%w: branches cannot be deleted in repository %s",
+	"ошибка удаления ветки: %w":                                            "failed to delete branch: %w",
+	"Удалена ветка %s в репозитории %s":                                    "Deleted branch %s in repository %s",
+	"неподдерживаемая служба git":                                          "unsupported git service",
+	"клонирование репозитория запрещено":                                   "cloning the repository is not allowed",
+	"push в репозиторий запрещен":                                          "push to the repository is not allowed",
+	"Участник %s группы %s недоступен: %v":                                 "Member %s of group %s is unavailable: %v",
+	"в группе %s нет доступных для чтения репозиториев: %w":                "group %s has no readable repositories: %w",
+	"ошибка выполнения %s: %w":                                             "%s failed: %w",
+	"ошибка выполнения %s: %w: %s":                                         "%s failed: %w: %s",
+	"Ошибка обновления записи репозитория %s: %v":                          "Failed to update repository record %s: %v",
+	"Выполнен push в Git репозиторий %s":                                   "Push to Git repository %s completed",
+	"репозиторий не является группой":                                      "repository is not a group",
+	"недопустимый участник группы":                                         "invalid group member",
+	"неизвестный формат репозитория: %s":                                   "unknown repository format: %s",
+	"ошибка получения участников группы: %w":                               "failed to get group members: %w",
+	"%w: группа не может входить в саму себя":                              "%w: a group cannot be a member of itself",
+	"%w: репозиторий %s не найден":                                         "%w: repository %s not found",
+	"%w: %s является группой":                                              "%w: %s is a group",
+	"%w: %s указан дважды":                                                 "%w: %s is listed twice",
+	"ошибка удаления участников группы: %w":                                "failed to delete group members: %w",
+	"ошибка сохранения участника группы: %w":                               "failed to save group member: %w",
+	"Обновлен состав группы %s (%s): %d участников":                        "Updated members of group %s (%s): %d members",
+	"%w: %s уже входит в группу":                                           "%w: %s is already a member of the group",
+	"Репозиторий %s добавлен в группу %s (%s)":                             "Repository %s added to group %s (%s)",
+	"ошибка удаления участника группы: %w":                                 "failed to delete group member: %w",
+	"участник %s не найден в группе %s: %w":                                "member %s not found in group %s: %w",
+	"Репозиторий %s исключен из группы %s (%s)":                            "Repository %s removed from group %s (%s)",
+	"ошибка получения индексного файла: %w":                                "failed to fetch index file: %w",
+	"ошибка получения индексного файла, код ответа: %d":                    "failed to fetch index file, status code: %d",
+	"Создан Helm репозиторий: %s, тип: %s":                                 "Created Helm repository: %s, type: %s",
+	"Создан Helm репозиторий: %s, тип: %s, загрузка индекса в задаче %d":   "Created Helm repository: %s, type: %s, downloading the index in task %d",
+	"ошибка удаления записей файлов: %w":                                   "failed to delete file records: %w",
+	"ошибка удаления записей чартов: %w":                                   "failed to delete chart records: %w",
+	"Удален Helm репозиторий %s: чартов %d":                                "Deleted Helm repository %s: charts %d",
+	"Изменены настройки Helm репозитория %s":                               "Updated settings of Helm repository %s",
+	"Изменены настройки Helm репозитория %s, загрузка индекса в задаче %d": "Updated settings of Helm repository %s, downloading the index in task %d",
+	"%w: синхронизация (задача %d)":                                        "%w: sync (task %d)",
+	"%w: нельзя загружать чарты в репозиторий %s":                          "%w: charts cannot be uploaded to repository %s",
+	"ошибка записи данных чарта: %w":                                       "failed to write chart data: %w",
+	"%w: имя файла %s не соответствует Chart.yaml, ожидалось %s":           "%w: file name %s does not match Chart.yaml, expected %s",
+	"%w: %s версии %s": "%w: %s version %s",
+	"ошибка сохранения чарта в хранилище: %w":                             "failed to store chart: %w",
+	"ошибка сохранения записи чарта: %w":                                  "failed to save chart record: %w",
+	"Загружен Helm чарт: %s в репозиторий %s":                             "Uploaded Helm chart %s to repository %s",
+	"чарт не найден: %w":                                                  "chart not found: %w",
+	"ошибка удаления записи чарта: %w":                                    "failed to delete chart record: %w",
+	"Ошибка удаления архива чарта %s: %v":                                 "Failed to delete chart archive %s: %v",
+	"Удален Helm чарт %s-%s из репозитория %s":                            "Deleted Helm chart %s-%s from repository %s",
+	"ошибка чтения индексного файла: %w":                                  "failed to read index file: %w",
+	"ошибка сериализации зависимостей чарта: %w":                          "failed to serialize chart dependencies: %w",
+	"ошибка сериализации метаданных чарта: %w":                            "failed to serialize chart metadata: %w",
+	"Синхронизация Helm репозитория %s с удаленным источником %s":         "Syncing Helm repository %s with remote %s",
+	"Загрузка %s/index.yaml":                                              "Downloading %s/index.yaml",
+	"Helm репозиторий %s успешно синхронизирован":                         "Helm repository %s synced",
+	"ошибка создания запроса: %w":                                         "failed to create request: %w",
+	"ошибка сохранения индексного файла: %w":                              "failed to save index file: %w",
+	"Используем кешированный чарт: %s-%s":                                 "Using cached chart: %s-%s",
+	"Получение чарта %s-%s из удаленного репозитория %s":                  "Fetching chart %s-%s from remote repository %s",
+	"ошибка получения чарта: %w":                                          "failed to fetch chart: %w",
+	"%w: %s в удаленном репозитории":                                      "%w: %s in the remote repository",
+	"ошибка получения чарта, код ответа: %d":                              "failed to fetch chart, status code: %d",
+	"ошибка создания файла чарта: %w":                                     "failed to create chart file: %w",
+	"%w: sha256 архива %s не совпадает с индексом удаленного репозитория": "%w: sha256 of archive %s does not match the remote repository index",
+	"%w: удаленный репозиторий вернул чарт %s версии %s":                  "%w: remote repository returned chart %s version %s",
+	"ошибка сохранения чарта: %w":                                         "failed to save chart: %w",
+	"ошибка получения записи чарта: %w":                                   "failed to get chart record: %w",
+	"Чарт %s-%s получен из удаленного репозитория и сохранен в кеше":      "Chart %s-%s fetched from the remote repository and cached",
+	"%w: неверное имя файла чарта %s":                                     "%w: invalid chart file name %s",
+	"Ошибка получения чарта %s из репозитория %s группы %s: %v":           "Failed to get chart %s from repository %s of group %s: %v",
+	"ошибка чтения чарта: %w":                                             "failed to read chart: %w",
+	"Ошибка получения списка чартов репозитория %s группы %s: %v":         "Failed to list charts of repository %s of group %s: %v",
+	"архив не является корректным Helm чартом":                            "archive is not a valid Helm chart",
+	"чарт уже существует":                                                 "chart already exists",
+	"чарт не найден":                                                      "chart not found",
+	"индекс репозитория еще не загружен":                                  "repository index has not been downloaded yet",
+	"%w: в Chart.yaml не указан apiVersion":                               "%w: Chart.yaml has no apiVersion",
+	"%w: неподдерживаемый apiVersion %q":                                  "%w: unsupported apiVersion %q",
+	"%w: в Chart.yaml не указано имя чарта":                               "%w: Chart.yaml has no chart name",
+	"%w: недопустимое имя чарта %q":                                       "%w: invalid chart name %q",
+	"%w: в Chart.yaml не указана версия чарта":                            "%w: Chart.yaml has no chart version",
+	"%w: версия %q не соответствует SemVer 2":                             "%w: version %q is not SemVer 2",
+	"%w: неизвестный тип чарта %q":                                        "%w: unknown chart type %q",
+	"%w: у зависимости не указано имя":                                    "%w: dependency has no name",
+	"ошибка открытия архива чарта: %w":                                    "failed to open chart archive: %w",
+	"%w: архив содержит несколько каталогов чартов":                       "%w: archive contains multiple chart directories",
+	"%w: файл %s слишком большой":                                         "%w: file %s is too large",
+	"%w: в архиве нет Chart.yaml":                                         "%w: archive has no Chart.yaml",
+	"%w: ошибка разбора Chart.yaml: %v":                                   "%w: failed to parse Chart.yaml: %v",
+	"%w: ошибка разбора requirements.yaml: %v":                            "%w: failed to parse requirements.yaml: %v",
+	"%w: ошибка разбора Chart.lock: %v":                                   "%w: failed to parse Chart.lock: %v",
+	"Ошибка чтения метаданных чарта %s-%s: %v":                            "Failed to read metadata of chart %s-%s: %v",
+	"ошибка формирования index.yaml: %w":                                  "failed to build index.yaml: %w",
+	"ошибка получения списка чартов: %w":                                  "failed to list charts: %w",
+	"ошибка разбора индексного файла %s: %w":                              "failed to parse index file %s: %w",
+	"Ошибка получения индекса репозитория %s группы %s: %v":               "Failed to get index of repository %s of group %s: %v",
+	"Ошибка обновления индекса репозитория %s: %v":                        "Failed to update index of repository %s: %v",
+	"Ошибка вычисления sha256 чарта %s-%s: %v":                            "Failed to compute sha256 of chart %s-%s: %v",
+	"Ошибка сохранения sha256 чарта %s-%s: %v":                            "Failed to save sha256 of chart %s-%s: %v",
+	"выполняется обслуживание хранилища, запись временно недоступна":      "storage maintenance in progress, writes are temporarily unavailable",
+	"%w: %s с %s": "%w: %s since %s",
+	"неверный токен доступа к реестру":                                                               "invalid registry access token",
+	"Ошибка генерации ключа подписи токенов: %v":                                                     "Failed to generate token signing key: %v",
+	"REGISTRY_TOKEN_SECRET не задан, токены Docker Registry будут недействительны после перезапуска": "REGISTRY_TOKEN_SECRET is not set, Docker Registry tokens will become invalid after restart",
+	"ошибка подписи токена: %w":                                                                      "failed to sign token: %w",
+	"%w: пользователь %s недоступен":                                                                 "%w: user %s is unavailable",
+	"репозиторий входит в группу":                                                                    "repository is a member of a group",
+	"ошибка получения групп репозитория: %w":                                                         "failed to get repository groups: %w",
+	"%w: %s, для удаления укажите force":                                                             "%w: %s, set force to delete",
+	"ошибка удаления участия в группах: %w":                                                          "failed to delete group memberships: %w",
+	"ошибка удаления артефактов: %w":                                                                 "failed to delete artifacts: %w",
+	"ошибка удаления расписаний: %w":                                                                 "failed to delete schedules: %w",
+	"ошибка удаления правил очистки: %w":                                                             "failed to delete cleanup policies: %w",
+	"ошибка удаления статистики скачиваний: %w":                                                      "failed to delete download statistics: %w",
+	"Директория %s находится вне хранилища %s и не будет удалена":                                    "Directory %s is outside of storage %s and will not be deleted",
+	"Ошибка удаления директории %s: %v":                                                              "Failed to delete directory %s: %v",
+	"Ошибка получения объектов %s: %v":                                                               "Failed to list objects %s: %v",
+	"Ошибка удаления объекта %s: %v":                                                                 "Failed to delete object %s: %v",
+	"недопустимые параметры репозитория":                                                             "invalid repository settings",
+	"%w: поля %s не поддерживаются для %s репозиториев":                                              "%w: fields %s are not supported for %s repositories",
+	"%w: URL указывается только для прокси-репозитория":                                              "%w: URL can be set only for a proxy repository",
+	"%w: cache_ttl не может быть отрицательным":                                                      "%w: cache_ttl cannot be negative",
+	"%w: имя ветки не может быть пустым":                                                             "%w: branch name cannot be empty",
+	"%w: push разрешается только в хостовый репозиторий":                                             "%w: push can be allowed only for a hosted repository",
+	"%w: index_path должен быть относительным путем внутри хранилища":                                "%w: index_path must be a relative path inside the storage",
+	"%w: index_path не может указывать в директорию архивов чартов":                                  "%w: index_path cannot point into the chart archive directory",
+	"%w: URL не может быть пустым":                                                                   "%w: URL cannot be empty",
+	"%w: URL должен быть адресом http или https":                                                     "%w: URL must be an http or https address",
+	"Планировщик задач запущен":                                                                      "Task scheduler started",
+	"Ошибка получения расписаний: %v":                                                                "Failed to get schedules: %v",
+	"Ошибка расчета следующего запуска расписания %d: %v":                                            "Failed to compute next run of schedule %d: %v",
+	"Ошибка обновления расписания %d: %v":                                                            "Failed to update schedule %d: %v",
+	"Ошибка постановки задачи расписания %d в очередь: %v":                                           "Failed to queue task of schedule %d: %v",
+	"предыдущая задача %d для репозитория еще выполняется":                                           "previous task %d for the repository is still running",
+	"ошибка сохранения задачи: %w":                                                                   "failed to save task: %w",
+	"Задача %s для репозитория %s пропущена: предыдущая еще выполняется":                             "Task %s for repository %s skipped: the previous one is still running",
+	"недопустимое расписание":                                                                        "invalid schedule",
+	"%w: укажите cron или interval, но не оба":                                                       "%w: set either cron or interval, not both",
+	"%w: необходимо указать cron или interval":                                                       "%w: cron or interval is required",
+	"%w: interval должен быть положительным":                                                         "%w: interval must be positive",
+	"%w: jitter не может быть отрицательным":                                                         "%w: jitter cannot be negative",
+	"%w: неверное cron-выражение: %v":                                                                "%w: invalid cron expression: %v",
+	"%w: синхронизация не поддерживается для %s репозиториев":                                        "%w: sync is not supported for %s repositories",
+	"%w: синхронизация доступна только для прокси-репозиториев":                                      "%w: sync is available only for proxy repositories",
+	"%w: очистка недоступна для групп":                                                               "%w: cleanup is not available for groups",
+	"%w: неизвестная задача %s":                                                                      "%w: unknown task %s",
+	"расписание не найдено: %w":                                                                      "schedule not found: %w",
+	"ошибка сохранения расписания: %w":                                                               "failed to save schedule: %w",
+	"Создано расписание %s для %s репозитория %s":                                                    "Created schedule %s for %s repository %s",
+	"ошибка получения расписаний: %w":                                                                "failed to get schedules: %w",
+	"ошибка удаления расписания: %w":                                                                 "failed to delete schedule: %w",
+	"Удалено расписание %d для %s репозитория %s":                                                    "Deleted schedule %d for %s repository %s",
+	"задача отменена":                                                                                "task canceled",
+	"задача уже завершена":                                                                           "task already finished",
+	"задачу нельзя отменить":                                                                         "task cannot be canceled",
+	"для репозитория уже выполняется задача":                                                         "a task is already running for the repository",
+	"синхронизация не поддерживается для %s репозиториев":                                            "sync is not supported for %s repositories",
+	"Ошибка записи журнала задачи %d: %v":                                                            "Failed to write log of task %d: %v",
+	"Ошибка сериализации результата задачи %d: %v":                                                   "Failed to serialize result of task %d: %v",
+	"Ошибка сохранения результата задачи %d: %v":                                                     "Failed to save result of task %d: %v",
+	"Запущено обработчиков фоновых задач: %d (экземпляр %s)":                                         "Background task workers started: %d (instance %s)",
+	"Ошибка получения брошенных задач: %v":                                                           "Failed to get abandoned tasks: %v",
+	"Ошибка возобновления задачи %d: %v":                                                             "Failed to resume task %d: %v",
+	"Экземпляр сервера %s перестал отвечать, задача возвращена в очередь":                            "Server instance %s stopped responding, task returned to the queue",
+	"Возвращено в очередь брошенных задач: %d":                                                       "Abandoned tasks returned to the queue: %d",
+	"ошибка захвата задачи: %w":                                                                      "failed to claim task: %w",
+	"Ошибка обновления отметки выполнения задач: %v":                                                 "Failed to update task heartbeats: %v",
+	"Ошибка выбора задачи: %v":                                                                       "Failed to pick task: %v",
+	"Задача запущена (экземпляр %s)":                                                                 "Task started (instance %s)",
+	"задача возвращена в очередь другим экземпляром сервера":                                         "task was returned to the queue by another server instance",
+	"Задача %d возвращена в очередь другим экземпляром сервера, выполнение прервано":                 "Task %d was returned to the queue by another server instance, execution interrupted",
+	"Задача %d возвращена в очередь другим экземпляром сервера, результат не сохранен":               "Task %d was returned to the queue by another server instance, result not saved",
+	"неизвестный тип задачи: %s":                                                                     "unknown task type: %s",
+	"Задача %d прервана остановкой сервера":                                                          "Task %d interrupted by server shutdown",
+	"Задача выполнена":                                                                               "Task completed",
+	"Задача отменена":                                                                                "Task canceled",
+	"Ошибка: %v":                                                                                     "Error: %v",
+	"Ошибка выполнения задачи %d (%s, репозиторий %s): %v":                                           "Task %d (%s, repository %s) failed: %v",
+	"ошибка поиска задачи: %w":                                                                       "failed to find task: %w",
+	"ошибка сериализации параметров задачи: %w":                                                      "failed to serialize task parameters: %w",
+	"ошибка получения списка задач: %w":                                                              "failed to list tasks: %w",
+	"задача не найдена: %w":                                                                          "task not found: %w",
+	"ошибка получения журнала задачи: %w":                                                            "failed to get task log: %w",
+	"ошибка отмены задачи: %w":                                                                       "failed to cancel task: %w",
+	"Задача отменена до запуска":                                                                     "Task canceled before start",
+	"%w: задача выполняется другим экземпляром сервера":                                              "%w: task is being run by another server instance",
+	"недопустимые параметры проверки":                                                                "invalid verification parameters",
+	"%w: для проверки репозитория укажите repo_type":                                                 "%w: set repo_type to verify a repository",
+	"обнаружены поврежденные артефакты: отсутствует %d, повреждено %d":                               "damaged artifacts found: missing %d, corrupted %d",
+	"ошибка получения репозиториев: %w":                                                              "failed to get repositories: %w",
+	"репозиторий %s не найден":                                                                       "repository %s not found",
+	"Проверка %s репозитория %s":                                                                     "Verifying %s repository %s",
+	"Проверено артефактов: %d, файлов: %d, отсутствует: %d, повреждено: %d":                          "Verified artifacts: %d, files: %d, missing: %d, corrupted: %d",
+	"ошибка получения файлов образа %s:%s: %w":                                                       "failed to get files of image %s:%s: %w",
+	"Образ %s:%s репозитория %s: blob sha256:%s %s":                                                  "Image %s:%s of repository %s: blob sha256:%s %s",
+	"ошибка получения чартов: %w":                                                                    "failed to get charts: %w",
+	"Чарт %s-%s репозитория %s: %s":                                                                  "Chart %s-%s of repository %s: %s",
+	"Git репозиторий %s: директория %s отсутствует":                                                  "Git repository %s: directory %s is missing",
+	"Git репозиторий %s: git fsck завершился ошибкой: %v":                                            "Git repository %s: git fsck failed: %v",
+	"Ошибка расчета объема хранилища для метрик: %v":                                                 "Failed to calculate storage usage for metrics: %v",
+
+	// storage
+	"недопустимый ключ объекта: %s":                               "invalid object key: %s",
+	"ошибка создания директории: %w":                              "failed to create directory: %w",
+	"ошибка создания файла: %w":                                   "failed to create file: %w",
+	"ошибка записи файла: %w":                                     "failed to write file: %w",
+	"ошибка сохранения файла: %w":                                 "failed to save file: %w",
+	"для хранилища S3 необходимо указать S3_ENDPOINT и S3_BUCKET": "S3_ENDPOINT and S3_BUCKET are required for S3 storage",
+	"ошибка подключения к S3: %w":                                 "failed to connect to S3: %w",
+	"ошибка проверки бакета %s: %w":                               "failed to check bucket %s: %w",
+	"ошибка создания бакета %s: %w":                               "failed to create bucket %s: %w",
+	"ошибка загрузки объекта %s в S3: %w":                         "failed to upload object %s to S3: %w",
+	"ошибка удаления объекта %s из S3: %w":                        "failed to delete object %s from S3: %w",
+	"ошибка получения списка объектов S3: %w":                     "failed to list S3 objects: %w",
+	"ошибка создания подписанной ссылки: %w":                      "failed to create presigned URL: %w",
+	"объект не найден в хранилище":                                "object not found in storage",
+	"хранилище не выдает подписанные ссылки":                      "storage does not issue presigned URLs",
+	"Артефакты хранятся в файловой системе: %s":                   "Artifacts are stored in the file system: %s",
+	"Артефакты хранятся в S3: %s/%s":                              "Artifacts are stored in S3: %s/%s",
+	"неизвестный тип хранилища: %s":                               "unknown storage backend: %s",
+
+	// config, db, i18n
+	"%v, используем %s": "%v, using %s",
+	"Нет .env файла, используем только переменные окружения":                   "No .env file, using environment variables only",
+	"Конфигурация загружена успешно":                                           "Configuration loaded",
+	"Ошибка при парсинге значения %s: %v, используем значение по умолчанию %d": "Failed to parse value of %s: %v, using default %d",
+	"неподдерживаемый язык журнала: %s":                                        "unsupported log language: %s",
+	"Подключение к базе данных успешно установлено":                            "Connected to the database",
+	"Запуск миграций базы данных...":                                           "Running database migrations...",
+	"Ошибка выполнения миграций: %v":                                           "Database migration failed: %v",
+	"Миграции успешно выполнены":                                               "Migrations completed",
+	"Создание структуры директорий для хранилища в %s":                         "Creating storage directory structure in %s",
+	"Структура директорий для хранилища успешно создана":                       "Storage directory structure created",
+
+	// cmd/server
+	"Larets - менеджер-репозиториев":                                                          "Larets - repository manager",
+	"Ошибка при создании директорий хранилища: %v":                                            "Failed to create storage directories: %v",
+	"Ошибка при создании администратора: %v":                                                  "Failed to create administrator: %v",
+	"Не задана переменная окружения DATABASE_URL":                                             "DATABASE_URL environment variable is not set",
+	"Ошибка при инициализации базы данных: %v":                                                "Failed to initialize database: %v",
+	"База данных успешно инициализирована":                                                    "Database initialized",
+	"Ошибка при инициализации хранилища артефактов: %v":                                       "Failed to initialize artifact storage: %v",
+	"Ошибка проверки: %v":                                                                     "Verification error: %v",
+	"ошибка     %s":                                                                           "error      %s",
+	"Репозиториев: %d, артефактов: %d, файлов: %d (%d байт), отсутствует: %d, повреждено: %d": "Repositories: %d, artifacts: %d, files: %d (%d bytes), missing: %d, corrupted: %d",
+}
@@ -0,0 +1,180 @@
+package i18n
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Языки сообщений. Сообщения в коде пишутся на русском и служат ключами каталогов:
+// для другого языка перевод ищется в его каталоге, а при отсутствии перевода
+// возвращается исходный текст.
+const (
+	Russian = "ru"
+	English = "en"
+
+	DefaultLanguage = Russian
+)
+
+var catalogs = map[string]map[string]string{
+	English: catalogEN,
+}
+
+// язык журнала сервера, задается LOG_LANGUAGE при загрузке конфигурации
+var logLanguage = DefaultLanguage
+
+// Supported сообщает, есть ли сообщения на языке lang
+func Supported(lang string) bool {
+	if lang == Russian {
+		return true
+	}
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// SetLogLanguage задает язык журнала сервера
+func SetLogLanguage(lang string) error {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if !Supported(lang) {
+		return Errorf("неподдерживаемый язык журнала: %s", lang)
+	}
+	logLanguage = lang
+	return nil
+}
+
+func LogLanguage() string {
+	return logLanguage
+}
+
+// T возвращает перевод сообщения на язык lang
+func T(lang, message string) string {
+	if translated, ok := catalogs[lang][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Message - сообщение из каталога, переданное аргументом форматирования.
+// В отличие от обычных строк такие аргументы переводятся вместе с форматом.
+type Message string
+
+// Sprintf форматирует сообщение на языке lang. Аргументы-ошибки и Message тоже переводятся,
+// поэтому в формате допускается %w, как в fmt.Errorf.
+func Sprintf(lang, format string, args ...interface{}) string {
+	format = strings.ReplaceAll(T(lang, format), "%w", "%v")
+	localized := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case error:
+			localized[i] = Localize(lang, arg)
+		case Message:
+			localized[i] = T(lang, string(arg))
+		default:
+			localized[i] = arg
+		}
+	}
+	return fmt.Sprintf(format, localized...)
+}
+
+// Error - ошибка, текст которой можно получить на любом поддерживаемом языке.
+// Error() возвращает текст на русском, errors.Is и errors.As работают как с fmt.Errorf.
+type Error struct {
+	err    error
+	format string
+	args   []interface{}
+}
+
+// Errorf создает ошибку как fmt.Errorf, запоминая формат для перевода
+func Errorf(format string, args ...interface{}) error {
+	return &Error{err: fmt.Errorf(format, args...), format: format, args: args}
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	switch wrapped := e.err.(type) {
+	case interface{ Unwrap() error }:
+		if err := wrapped.Unwrap(); err != nil {
+			return []error{err}
+		}
+	case interface{ Unwrap() []error }:
+		return wrapped.Unwrap()
+	}
+	return nil
+}
+
+// Localize возвращает текст ошибки на языке lang
+func (e *Error) Localize(lang string) string {
+	return Sprintf(lang, e.format, e.args...)
+}
+
+// Localize возвращает текст ошибки на языке lang. Ошибки, созданные errors.New с текстом
+// из каталога, переводятся целиком, ошибки других пакетов возвращаются как есть.
+func Localize(lang string, err error) string {
+	if localizer, ok := err.(interface{ Localize(lang string) string }); ok {
+		return localizer.Localize(lang)
+	}
+	return T(lang, err.Error())
+}
+
+// Logf пишет сообщение в журнал сервера на языке LOG_LANGUAGE
+func Logf(format string, args ...interface{}) {
+	log.Output(2, Sprintf(logLanguage, format, args...))
+}
+
+// Fatalf пишет сообщение в журнал и завершает процесс, как log.Fatalf
+func Fatalf(format string, args ...interface{}) {
+	log.Output(2, Sprintf(logLanguage, format, args...))
+	os.Exit(1)
+}
+
+// Negotiate выбирает язык ответа по заголовку Accept-Language (RFC 9110):
+// поддерживаемый язык с наибольшим весом q, при равных весах - указанный раньше.
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		if tag == "*" {
+			tag = DefaultLanguage
+		}
+		lang, _, _ := strings.Cut(tag, "-")
+		if Supported(lang) {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return DefaultLanguage
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].lang
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Registry - метрики сервера, которые отдает /metrics. Кроме метрик ниже в него
+// регистрируются метрики процесса и Go runtime, а сервисы добавляют свои коллекторы.
+var Registry = prometheus.NewRegistry()
+
+// Результаты обращения к кешу прокси-репозитория (метка result)
+const (
+	CacheHit         = "hit"         // артефакт отдан из кеша без обращения к upstream
+	CacheRevalidated = "revalidated" // upstream подтвердил, что артефакт в кеше не изменился
+	CacheMiss        = "miss"        // артефакт получен из upstream
+	CacheStale       = "stale"       // upstream недоступен, отдан устаревший артефакт из кеша
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "larets",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Количество HTTP запросов по маршрутам и форматам репозиториев.",
+	}, []string{"route", "format", "method", "code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "larets",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Время обработки HTTP запросов, включая передачу ответа.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"route", "format", "method"})
+
+	HTTPResponseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "larets",
+		Subsystem: "http",
+		Name:      "response_bytes_total",
+		Help:      "Объем отданных данных (тела ответов) в байтах.",
+	}, []string{"route", "format"})
+
+	HTTPRequestBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "larets",
+		Subsystem: "http",
+		Name:      "request_bytes_total",
+		Help:      "Объем полученных данных (тела запросов) в байтах.",
+	}, []string{"route", "format"})
+
+	ProxyCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "larets",
+		Subsystem: "proxy",
+		Name:      "cache_requests_total",
+		Help:      "Обращения к кешу прокси-репозиториев: hit, revalidated, miss или stale.",
+	}, []string{"format", "repository", "result"})
+
+	UpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "larets",
+		Subsystem: "proxy",
+		Name:      "upstream_errors_total",
+		Help:      "Ошибки обращения к удаленным репозиториям: сетевые ошибки и неожиданные коды ответа.",
+	}, []string{"format", "repository"})
+
+	TaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "larets",
+		Subsystem: "task",
+		Name:      "duration_seconds",
+		Help:      "Время выполнения фоновых задач по типу и итоговому статусу.",
+		Buckets:   []float64{.1, .5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600, 7200},
+	}, []string{"type", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+		HTTPRequests,
+		HTTPRequestDuration,
+		HTTPResponseBytes,
+		HTTPRequestBytes,
+		ProxyCacheRequests,
+		UpstreamErrors,
+		TaskDuration,
+	)
+}
+
+// Handler отдает метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ProxyCache учитывает обращение к кешу прокси-репозитория
+func ProxyCache(format, repository, result string) {
+	ProxyCacheRequests.WithLabelValues(format, repository, result).Inc()
+}
+
+// UpstreamError учитывает ошибку обращения к удаленному репозиторию
+func UpstreamError(format, repository string) {
+	UpstreamErrors.WithLabelValues(format, repository).Inc()
+}
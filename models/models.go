@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"github.com/lib/pq"
 	"time"
 )
 
@@ -17,13 +19,17 @@ type BaseRepository struct {
 	Name        string         `json:"name" gorm:"uniqueIndex"`
 	Description string         `json:"description"`
 	Type        RepositoryType `json:"type"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	// разрешает чтение без аутентификации при включенном ENABLE_AUTH
+	AnonymousRead bool      `json:"anonymous_read" gorm:"default:false"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type DockerRepository struct {
 	BaseRepository
 	URL          string `json:"url,omitempty" gorm:"default:null"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"-"`
 	IndexType    string `json:"index_type,omitempty"`
 	CacheEnabled bool   `json:"cache_enabled" gorm:"default:true"`
 	CacheTTL     int    `json:"cache_ttl" gorm:"default:1440"`
@@ -50,10 +56,10 @@ type HelmRepository struct {
 
 type GroupMember struct {
 	ID         int    `json:"id" gorm:"primaryKey"`
-	GroupID    int    `json:"group_id"`
+	GroupID    int    `json:"group_id" gorm:"index:idx_group_members_group"`
 	MemberID   int    `json:"member_id"`
 	MemberName string `json:"member_name"`
-	MemberType string `json:"member_type"`
+	MemberType string `json:"member_type" gorm:"index:idx_group_members_group"`
 	Priority   int    `json:"priority"`
 }
 
@@ -69,29 +75,199 @@ type Artifact struct {
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 	DownloadCount int       `json:"download_count" gorm:"default:0"`
+	// время последнего скачивания, nil - артефакт не скачивался
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
 }
 
 type DockerImage struct {
 	Artifact
-	Tag      string   `json:"tag"`
-	Manifest []byte   `json:"manifest" gorm:"type:jsonb"`
-	Layers   []string `json:"layers" gorm:"type:text[]"`
+	Tag       string         `json:"tag"`
+	MediaType string         `json:"media_type"`
+	Manifest  []byte         `json:"manifest" gorm:"type:jsonb"`
+	Layers    pq.StringArray `json:"layers" gorm:"type:text[]"`
+}
+
+// DockerUpload - сессия загрузки blob через Registry API v2. После завершения загрузки
+// или монтирования blob-а в Digest записывается его digest, а файл загрузки удаляется:
+// запись подтверждает, что blob загружен в репозиторий, пока на него не сошлется манифест.
+// Завершенные сессии, как и брошенные, удаляет сборщик мусора.
+// Cached отмечает blob, скачанный прокси-репозиторием из upstream: такая запись держит
+// ссылку на blob и живет, пока существует репозиторий.
+type DockerUpload struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	RepositoryID int       `json:"repository_id"`
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	Digest       string    `json:"digest,omitempty" gorm:"index"`
+	Cached       bool      `json:"cached,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// HelmChart - версия чарта в репозитории. Версия уникальна в пределах репозитория: индекс
+// idx_helm_charts_version по (repository_id, name, version) создается при миграции, потому что
+// эти поля объявлены в Artifact, который встраивается и в другие модели.
 type HelmChart struct {
 	Artifact
-	AppVersion   string   `json:"app_version"`
-	Description  string   `json:"description"`
-	Keywords     []string `json:"keywords" gorm:"type:text[]"`
-	Dependencies []byte   `json:"dependencies" gorm:"type:jsonb"`
+	AppVersion   string          `json:"app_version"`
+	Description  string          `json:"description"`
+	Keywords     pq.StringArray  `json:"keywords" gorm:"type:text[]"`
+	Dependencies json.RawMessage `json:"dependencies" gorm:"type:jsonb"`
+	// полное содержимое Chart.yaml
+	Metadata json.RawMessage `json:"metadata" gorm:"type:jsonb"`
 }
 
 type StoredFile struct {
 	ID         int       `json:"id" gorm:"primaryKey"`
-	ArtifactID int       `json:"artifact_id"`
+	ArtifactID int       `json:"artifact_id" gorm:"index:idx_stored_files_artifact"`
+	RepoType   string    `json:"repo_type" gorm:"index:idx_stored_files_artifact"`
 	FileName   string    `json:"file_name"`
 	FilePath   string    `json:"file_path"`
 	Size       int64     `json:"size"`
 	SHA256     string    `json:"sha256"`
 	CreatedAt  time.Time `json:"created_at"`
 }
+
+// Blob - файл в общем content-addressable хранилище.
+// RefCount - число StoredFile, ссылающихся на blob; blob-ы с нулевым счетчиком удаляет сборщик мусора
+type Blob struct {
+	Digest    string    `json:"digest" gorm:"primaryKey"`
+	Size      int64     `json:"size"`
+	RefCount  int       `json:"ref_count" gorm:"default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type User struct {
+	ID           int        `json:"id" gorm:"primaryKey"`
+	Username     string     `json:"username" gorm:"uniqueIndex"`
+	Email        string     `json:"email,omitempty"`
+	PasswordHash string     `json:"-"`
+	IsAdmin      bool       `json:"is_admin"`
+	Active       bool       `json:"active" gorm:"default:true"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// APIToken - персональный токен доступа. Хранится только sha256 токена,
+// сам токен показывается пользователю один раз при создании
+type APIToken struct {
+	ID         int        `json:"id" gorm:"primaryKey"`
+	UserID     int        `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	Prefix     string     `json:"prefix"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserGroup - группа пользователей, которой можно назначать права
+type UserGroup struct {
+	ID          int       `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type UserGroupMember struct {
+	ID      int `json:"id" gorm:"primaryKey"`
+	GroupID int `json:"group_id" gorm:"uniqueIndex:idx_user_group_members"`
+	UserID  int `json:"user_id" gorm:"uniqueIndex:idx_user_group_members;index"`
+}
+
+// Permission - право на репозитории формата Format ("*" - любой формат), имя которых
+// совпадает с Pattern (имя или glob). Action: read, write, delete или admin, старшее право включает младшие
+type Permission struct {
+	ID          int       `json:"id" gorm:"primaryKey"`
+	SubjectType string    `json:"subject_type" gorm:"index:idx_permissions_subject"`
+	SubjectID   int       `json:"subject_id" gorm:"index:idx_permissions_subject"`
+	SubjectName string    `json:"subject_name"`
+	Format      string    `json:"format"`
+	Pattern     string    `json:"pattern"`
+	Action      string    `json:"action"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Schedule - периодическое выполнение задачи над репозиторием по cron-выражению или с интервалом
+type Schedule struct {
+	ID             int        `json:"id" gorm:"primaryKey"`
+	Task           string     `json:"task"`
+	RepoType       string     `json:"repo_type" gorm:"index:idx_schedules_repository"`
+	RepositoryID   int        `json:"repository_id" gorm:"index:idx_schedules_repository"`
+	RepositoryName string     `json:"repository"`
+	Cron           string     `json:"cron,omitempty"`
+	Interval       int        `json:"interval,omitempty"` // в минутах
+	Jitter         int        `json:"jitter"`             // случайная задержка запуска в секундах
+	Enabled        bool       `json:"enabled"`
+	NextRunAt      time.Time  `json:"next_run_at" gorm:"index"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CleanupPolicy - правило очистки репозитория. Заданные условия объединяются: из версий,
+// подходящих под VersionPattern, у каждого артефакта остаются KeepLast последних, а из
+// остальных удаляются те, что не скачивались NotDownloadedDays дней.
+type CleanupPolicy struct {
+	ID                int       `json:"id" gorm:"primaryKey"`
+	Name              string    `json:"name"`
+	RepoType          string    `json:"repo_type" gorm:"index:idx_cleanup_policies_repository"`
+	RepositoryID      int       `json:"repository_id" gorm:"index:idx_cleanup_policies_repository"`
+	RepositoryName    string    `json:"repository"`
+	KeepLast          int       `json:"keep_last"`
+	NotDownloadedDays int       `json:"not_downloaded_days"`
+	VersionPattern    string    `json:"version_pattern"`
+	Enabled           bool      `json:"enabled"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// DownloadStat - число скачиваний и объем отданных данных артефакта за сутки (UTC).
+// ArtifactID 0 - скачивания без конкретной версии: клонирование git репозитория и blob-ы образа docker
+type DownloadStat struct {
+	ID               int       `json:"-" gorm:"primaryKey"`
+	RepoType         string    `json:"repo_type" gorm:"uniqueIndex:idx_download_stats_key"`
+	RepositoryID     int       `json:"repository_id" gorm:"uniqueIndex:idx_download_stats_key"`
+	ArtifactID       int       `json:"artifact_id" gorm:"uniqueIndex:idx_download_stats_key"`
+	Name             string    `json:"name" gorm:"uniqueIndex:idx_download_stats_key"`
+	Version          string    `json:"version" gorm:"uniqueIndex:idx_download_stats_key"`
+	Day              time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_download_stats_key"`
+	Downloads        int64     `json:"downloads"`
+	Bytes            int64     `json:"bytes"`
+	LastDownloadedAt time.Time `json:"last_downloaded_at"`
+}
+
+// Task - фоновая задача и запись истории ее выполнения
+type Task struct {
+	ID             int             `json:"id" gorm:"primaryKey"`
+	ScheduleID     *int            `json:"schedule_id,omitempty" gorm:"index"`
+	Type           string          `json:"type"`
+	RepoType       string          `json:"repo_type" gorm:"index:idx_tasks_repository;uniqueIndex:idx_tasks_running,where:status = 'running'"`
+	RepositoryID   int             `json:"repository_id" gorm:"index:idx_tasks_repository;uniqueIndex:idx_tasks_running,where:status = 'running'"`
+	RepositoryName string          `json:"repository"`
+	Params         json.RawMessage `json:"params,omitempty" gorm:"type:jsonb"`
+	Status         string          `json:"status" gorm:"index"`
+	Progress       int             `json:"progress"` // процент выполнения
+	Error          string          `json:"error,omitempty"`
+	Result         json.RawMessage `json:"result,omitempty" gorm:"type:jsonb"` // отчет задачи, например сборки мусора
+	CreatedBy      string          `json:"created_by,omitempty"`
+	// экземпляр сервера, выполняющий задачу, и время его последнего сигнала о работе
+	WorkerID    string     `json:"worker_id,omitempty"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TaskLog - строка журнала выполнения задачи
+type TaskLog struct {
+	ID        int       `json:"-" gorm:"primaryKey"`
+	TaskID    int       `json:"-" gorm:"index"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"time"`
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"gorm.io/gorm"
+	"path"
+	"strings"
+	"time"
+)
+
+// Права на репозитории. Каждое следующее право включает предыдущие:
+// read - скачивание, write - загрузка и синхронизация, delete - удаление артефактов,
+// admin - создание репозитория и управление составом группы.
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+)
+
+// Субъекты, которым назначаются права
+const (
+	SubjectUser  = "user"
+	SubjectGroup = "group"
+)
+
+var actionLevels = map[string]int{
+	ActionRead:   1,
+	ActionWrite:  2,
+	ActionDelete: 3,
+	ActionAdmin:  4,
+}
+
+var (
+	ErrUnauthorized      = errors.New("требуется аутентификация")
+	ErrForbidden         = errors.New("недостаточно прав")
+	ErrPermissionInvalid = newError(ErrInvalid, "PERMISSION_INVALID", "неверное описание права")
+	ErrUserGroupExists   = newError(ErrConflict, "USER_GROUP_EXISTS", "группа пользователей с таким именем уже существует")
+)
+
+type accessContextKey int
+
+const (
+	userAccessKey accessContextKey = iota
+	systemAccessKey
+)
+
+// WithUser возвращает контекст запроса от имени пользователя. Контекст без пользователя
+// считается анонимным.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userAccessKey, user)
+}
+
+// UserFromContext возвращает пользователя, от имени которого выполняется запрос, или nil
+func UserFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userAccessKey).(*models.User)
+	return user
+}
+
+// withSystemAccess снимает проверку прав. Используется, когда доступ уже проверен
+// на уровне группы и сервис обращается к ее участникам.
+func withSystemAccess(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemAccessKey, true)
+}
+
+// accessScope - права субъекта запроса, загруженные один раз для проверки нескольких репозиториев
+type accessScope struct {
+	unrestricted bool
+	user         *models.User
+	permissions  []models.Permission
+}
+
+func loadAccessScope(ctx context.Context) (*accessScope, error) {
+	if !config.Config.EnableAuth {
+		return &accessScope{unrestricted: true}, nil
+	}
+	if system, _ := ctx.Value(systemAccessKey).(bool); system {
+		return &accessScope{unrestricted: true}, nil
+	}
+
+	user := UserFromContext(ctx)
+	if user == nil {
+		return &accessScope{}, nil
+	}
+	if user.IsAdmin {
+		return &accessScope{unrestricted: true, user: user}, nil
+	}
+
+	var permissions []models.Permission
+	err := db.DB.Where("subject_type = ? AND subject_id = ?", SubjectUser, user.ID).
+		Or("subject_type = ? AND subject_id IN (?)", SubjectGroup,
+			db.DB.Model(&models.UserGroupMember{}).Select("group_id").Where("user_id = ?", user.ID)).
+		Find(&permissions).Error
+	if err != nil {
+		return nil, i18n.Errorf("ошибка получения прав пользователя: %w", err)
+	}
+
+	return &accessScope{user: user, permissions: permissions}, nil
+}
+
+// check проверяет право action на репозиторий repo формата format
+func (a *accessScope) check(format string, repo *models.BaseRepository, action string) error {
+	if a.unrestricted {
+		return nil
+	}
+
+	if action == ActionRead && repo.AnonymousRead {
+		return nil
+	}
+	if a.user == nil {
+		return i18n.Errorf("%w: репозиторий %s", ErrUnauthorized, repo.Name)
+	}
+
+	required := actionLevels[action]
+	for _, permission := range a.permissions {
+		if permission.Format != "*" && permission.Format != format {
+			continue
+		}
+		if actionLevels[permission.Action] < required {
+			continue
+		}
+		if matched, _ := path.Match(permission.Pattern, repo.Name); matched {
+			return nil
+		}
+	}
+	return i18n.Errorf("%w: %s на репозиторий %s", ErrForbidden, action, repo.Name)
+}
+
+// authorize проверяет право action текущего пользователя на репозиторий.
+// Во время обслуживания хранилища разрешено только чтение.
+func authorize(ctx context.Context, format string, repo *models.BaseRepository, action string) error {
+	if action != ActionRead {
+		if err := maintenance.check(); err != nil {
+			return err
+		}
+	}
+
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return err
+	}
+	return scope.check(format, repo, action)
+}
+
+// authorizeName проверяет право на репозиторий, который еще не создан
+func authorizeName(ctx context.Context, format, name, action string) error {
+	return authorize(ctx, format, &models.BaseRepository{Name: name}, action)
+}
+
+// AccessService управляет группами пользователей и правами на репозитории
+type AccessService struct{}
+
+func (s *AccessService) CreateUserGroup(name, description string) (*models.UserGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, ":/ ") {
+		return nil, i18n.Errorf("%w: недопустимое имя группы %q", ErrPermissionInvalid, name)
+	}
+
+	var count int64
+	db.DB.Model(&models.UserGroup{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		return nil, i18n.Errorf("%w: %s", ErrUserGroupExists, name)
+	}
+
+	group := models.UserGroup{
+		Name:        name,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+	if err := db.DB.Create(&group).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения группы пользователей: %w", err)
+	}
+
+	i18n.Logf("Создана группа пользователей %s", name)
+	return &group, nil
+}
+
+func (s *AccessService) ListUserGroups() ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	err := db.DB.Order("name").Find(&groups).Error
+	return groups, err
+}
+
+func (s *AccessService) GetUserGroup(name string) (*models.UserGroup, error) {
+	var group models.UserGroup
+	if err := db.DB.Where("name = ?", name).First(&group).Error; err != nil {
+		return nil, i18n.Errorf("группа пользователей не найдена: %w", err)
+	}
+	return &group, nil
+}
+
+// DeleteUserGroup удаляет группу вместе с ее составом и назначенными ей правами
+func (s *AccessService) DeleteUserGroup(name string) error {
+	group, err := s.GetUserGroup(name)
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.UserGroupMember{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления состава группы: %w", err)
+		}
+		if err := tx.Where("subject_type = ? AND subject_id = ?", SubjectGroup, group.ID).Delete(&models.Permission{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления прав группы: %w", err)
+		}
+		if err := tx.Delete(group).Error; err != nil {
+			return i18n.Errorf("ошибка удаления группы пользователей: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	i18n.Logf("Удалена группа пользователей %s", name)
+	return nil
+}
+
+// ListUserGroupMembers возвращает пользователей, входящих в группу
+func (s *AccessService) ListUserGroupMembers(name string) ([]models.User, error) {
+	group, err := s.GetUserGroup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	err = db.DB.Where("id IN (?)", db.DB.Model(&models.UserGroupMember{}).Select("user_id").Where("group_id = ?", group.ID)).
+		Order("username").
+		Find(&users).Error
+	return users, err
+}
+
+func (s *AccessService) AddUserToGroup(name, username string) error {
+	group, err := s.GetUserGroup(name)
+	if err != nil {
+		return err
+	}
+	user, err := (&AuthService{}).GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	db.DB.Model(&models.UserGroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, user.ID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	if err := db.DB.Create(&models.UserGroupMember{GroupID: group.ID, UserID: user.ID}).Error; err != nil {
+		return i18n.Errorf("ошибка добавления пользователя в группу: %w", err)
+	}
+
+	i18n.Logf("Пользователь %s добавлен в группу %s", username, name)
+	return nil
+}
+
+func (s *AccessService) RemoveUserFromGroup(name, username string) error {
+	group, err := s.GetUserGroup(name)
+	if err != nil {
+		return err
+	}
+	user, err := (&AuthService{}).GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	result := db.DB.Where("group_id = ? AND user_id = ?", group.ID, user.ID).Delete(&models.UserGroupMember{})
+	if result.Error != nil {
+		return i18n.Errorf("ошибка исключения пользователя из группы: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return i18n.Errorf("пользователь %s не входит в группу %s: %w", username, name, gorm.ErrRecordNotFound)
+	}
+
+	i18n.Logf("Пользователь %s исключен из группы %s", username, name)
+	return nil
+}
+
+// subjectID находит пользователя или группу пользователей, которым назначается право
+func (s *AccessService) subjectID(subjectType, subject string) (int, error) {
+	switch subjectType {
+	case SubjectUser:
+		user, err := (&AuthService{}).GetUser(subject)
+		if err != nil {
+			return 0, err
+		}
+		return user.ID, nil
+	case SubjectGroup:
+		group, err := s.GetUserGroup(subject)
+		if err != nil {
+			return 0, err
+		}
+		return group.ID, nil
+	}
+	return 0, i18n.Errorf("%w: неизвестный тип субъекта %q", ErrPermissionInvalid, subjectType)
+}
+
+// GrantPermission назначает право action на репозитории формата format, имя которых
+// совпадает с pattern. Формат "*" означает любой формат.
+func (s *AccessService) GrantPermission(subjectType, subject, format, pattern, action string) (*models.Permission, error) {
+	switch format {
+	case FormatDocker, FormatGit, FormatHelm, "*":
+	default:
+		return nil, i18n.Errorf("%w: неизвестный формат %q", ErrPermissionInvalid, format)
+	}
+	if _, ok := actionLevels[action]; !ok {
+		return nil, i18n.Errorf("%w: неизвестное право %q", ErrPermissionInvalid, action)
+	}
+	if pattern == "" {
+		return nil, i18n.Errorf("%w: не указан шаблон имени репозитория", ErrPermissionInvalid)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, i18n.Errorf("%w: неверный шаблон %q", ErrPermissionInvalid, pattern)
+	}
+
+	id, err := s.subjectID(subjectType, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	permission := models.Permission{
+		SubjectType: subjectType,
+		SubjectID:   id,
+		SubjectName: subject,
+		Format:      format,
+		Pattern:     pattern,
+		Action:      action,
+		CreatedAt:   time.Now(),
+	}
+	if err := db.DB.Create(&permission).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения права: %w", err)
+	}
+
+	i18n.Logf("Назначено право %s на %s репозитории %s для %s %s", action, format, pattern, subjectType, subject)
+	return &permission, nil
+}
+
+// ListPermissions возвращает права, назначенные субъекту, или все права, если субъект не указан
+func (s *AccessService) ListPermissions(subjectType, subject string) ([]models.Permission, error) {
+	query := db.DB.Order("id")
+	if subjectType != "" {
+		id, err := s.subjectID(subjectType, subject)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("subject_type = ? AND subject_id = ?", subjectType, id)
+	}
+
+	var permissions []models.Permission
+	err := query.Find(&permissions).Error
+	return permissions, err
+}
+
+func (s *AccessService) RevokePermission(id int) error {
+	result := db.DB.Delete(&models.Permission{}, id)
+	if result.Error != nil {
+		return i18n.Errorf("ошибка удаления права: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return i18n.Errorf("право не найдено: %w", gorm.ErrRecordNotFound)
+	}
+
+	i18n.Logf("Отозвано право %d", id)
+	return nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"github.com/Viste/larets/models"
+	"testing"
+)
+
+func TestAccessScopeCheck(t *testing.T) {
+	user := &models.User{ID: 1, Username: "alice"}
+	scope := &accessScope{
+		user: user,
+		permissions: []models.Permission{
+			{Format: FormatDocker, Pattern: "team-*", Action: ActionWrite},
+			{Format: "*", Pattern: "shared", Action: ActionRead},
+			{Format: FormatHelm, Pattern: "charts-?", Action: ActionAdmin},
+			{Format: FormatGit, Pattern: "[", Action: ActionAdmin}, // некорректный шаблон ничего не разрешает
+		},
+	}
+
+	tests := []struct {
+		name    string
+		scope   *accessScope
+		format  string
+		repo    models.BaseRepository
+		action  string
+		wantErr error
+	}{
+		{"pattern read", scope, FormatDocker, models.BaseRepository{Name: "team-a"}, ActionRead, nil},
+		{"pattern write", scope, FormatDocker, models.BaseRepository{Name: "team-a"}, ActionWrite, nil},
+		{"pattern delete above level", scope, FormatDocker, models.BaseRepository{Name: "team-a"}, ActionDelete, ErrForbidden},
+		{"pattern does not match", scope, FormatDocker, models.BaseRepository{Name: "other"}, ActionRead, ErrForbidden},
+		{"pattern other format", scope, FormatGit, models.BaseRepository{Name: "team-a"}, ActionRead, ErrForbidden},
+		{"star does not cross slash", scope, FormatDocker, models.BaseRepository{Name: "team-a/b"}, ActionRead, ErrForbidden},
+		{"any format", scope, FormatGit, models.BaseRepository{Name: "shared"}, ActionRead, nil},
+		{"any format write", scope, FormatGit, models.BaseRepository{Name: "shared"}, ActionWrite, ErrForbidden},
+		{"single character", scope, FormatHelm, models.BaseRepository{Name: "charts-1"}, ActionAdmin, nil},
+		{"single character too long", scope, FormatHelm, models.BaseRepository{Name: "charts-10"}, ActionRead, ErrForbidden},
+		{"invalid pattern", scope, FormatGit, models.BaseRepository{Name: "["}, ActionRead, ErrForbidden},
+		{"anonymous read", scope, FormatGit, models.BaseRepository{Name: "public", AnonymousRead: true}, ActionRead, nil},
+		{"anonymous read is not write", scope, FormatGit, models.BaseRepository{Name: "public", AnonymousRead: true}, ActionWrite, ErrForbidden},
+		{"anonymous user", &accessScope{}, FormatDocker, models.BaseRepository{Name: "team-a"}, ActionRead, ErrUnauthorized},
+		{"anonymous user public", &accessScope{}, FormatDocker, models.BaseRepository{Name: "public", AnonymousRead: true}, ActionRead, nil},
+		{"anonymous user public write", &accessScope{}, FormatDocker, models.BaseRepository{Name: "public", AnonymousRead: true}, ActionWrite, ErrUnauthorized},
+		{"no permissions", &accessScope{user: user}, FormatDocker, models.BaseRepository{Name: "team-a"}, ActionRead, ErrForbidden},
+		{"unrestricted", &accessScope{unrestricted: true}, FormatDocker, models.BaseRepository{Name: "anything"}, ActionAdmin, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.scope.check(tt.format, &tt.repo, tt.action)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("check(%s, %s, %s) error = %v", tt.format, tt.repo.Name, tt.action, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("check(%s, %s, %s) error = %v, want %v", tt.format, tt.repo.Name, tt.action, err, tt.wantErr)
+			}
+		})
+	}
+}
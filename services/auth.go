@@ -0,0 +1,290 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = newError(ErrUnauthorized, "INVALID_CREDENTIALS", "неверное имя пользователя или пароль")
+	ErrUserExists         = newError(ErrConflict, "USER_EXISTS", "пользователь с таким именем уже существует")
+	ErrUserInvalid        = newError(ErrInvalid, "USER_INVALID", "неверные данные пользователя")
+)
+
+// префикс персональных токенов, позволяет отличить токен от пароля
+const apiTokenPrefix = "lrt_"
+
+type AuthService struct{}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnsureAdmin создает администратора из ADMIN_USER/ADMIN_PASSWORD при первом запуске,
+// когда в базе еще нет ни одного пользователя
+func (s *AuthService) EnsureAdmin() error {
+	var count int64
+	if err := db.DB.Model(&models.User{}).Count(&count).Error; err != nil {
+		return i18n.Errorf("ошибка проверки пользователей: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := s.CreateUser(config.Config.AdminUser, config.Config.AdminPassword, "", true); err != nil {
+		return i18n.Errorf("ошибка создания администратора: %w", err)
+	}
+
+	if config.Config.AdminPassword == "admin" {
+		i18n.Logf("ВНИМАНИЕ: администратор %s создан с паролем по умолчанию, смените его", config.Config.AdminUser)
+	} else {
+		i18n.Logf("Создан администратор %s", config.Config.AdminUser)
+	}
+	return nil
+}
+
+func (s *AuthService) CreateUser(username, password, email string, isAdmin bool) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || strings.ContainsAny(username, ":/ ") {
+		return nil, i18n.Errorf("%w: недопустимое имя пользователя %q", ErrUserInvalid, username)
+	}
+	if password == "" {
+		return nil, i18n.Errorf("%w: пароль не может быть пустым", ErrUserInvalid)
+	}
+
+	var count int64
+	db.DB.Model(&models.User{}).Where("username = ?", username).Count(&count)
+	if count > 0 {
+		return nil, i18n.Errorf("%w: %s", ErrUserExists, username)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, i18n.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	user := models.User{
+		Username:     username,
+		Email:        email,
+		PasswordHash: string(hash),
+		IsAdmin:      isAdmin,
+		Active:       true,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := db.DB.Create(&user).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения пользователя: %w", err)
+	}
+
+	i18n.Logf("Создан пользователь %s", username)
+	return &user, nil
+}
+
+func (s *AuthService) ListUsers() ([]models.User, error) {
+	var users []models.User
+	err := db.DB.Order("username").Find(&users).Error
+	return users, err
+}
+
+func (s *AuthService) GetUser(username string) (*models.User, error) {
+	var user models.User
+	err := db.DB.Where("username = ?", username).First(&user).Error
+	if err != nil {
+		return nil, i18n.Errorf("пользователь не найден: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdateUser меняет пароль, email, признак администратора и активность пользователя.
+// Пустые значения и nil не изменяют соответствующее поле.
+func (s *AuthService) UpdateUser(username, password, email string, isAdmin, active *bool) (*models.User, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, i18n.Errorf("ошибка хеширования пароля: %w", err)
+		}
+		user.PasswordHash = string(hash)
+	}
+	if email != "" {
+		user.Email = email
+	}
+	if isAdmin != nil {
+		user.IsAdmin = *isAdmin
+	}
+	if active != nil {
+		user.Active = *active
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := db.DB.Save(user).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения пользователя: %w", err)
+	}
+	return user, nil
+}
+
+// DeleteUser удаляет пользователя вместе с его токенами, членством в группах и правами
+func (s *AuthService) DeleteUser(username string) error {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.APIToken{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления токенов пользователя: %w", err)
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserGroupMember{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления пользователя из групп: %w", err)
+		}
+		if err := tx.Where("subject_type = ? AND subject_id = ?", SubjectUser, user.ID).Delete(&models.Permission{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления прав пользователя: %w", err)
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return i18n.Errorf("ошибка удаления пользователя: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	i18n.Logf("Удален пользователь %s", username)
+	return nil
+}
+
+// Authenticate проверяет имя пользователя и пароль. Вместо пароля можно передать
+// персональный токен пользователя, как это делают docker login и git.
+func (s *AuthService) Authenticate(username, password string) (*models.User, error) {
+	if strings.HasPrefix(password, apiTokenPrefix) {
+		user, err := s.AuthenticateToken(password)
+		if err == nil && user.Username == username {
+			return user, nil
+		}
+	}
+
+	var user models.User
+	err := db.DB.Where("username = ?", username).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, i18n.Errorf("ошибка получения пользователя: %w", err)
+	}
+
+	if !user.Active {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	if err := db.DB.Model(&user).Update("last_login_at", now).Error; err != nil {
+		i18n.Logf("Ошибка обновления времени входа пользователя %s: %v", username, err)
+	}
+	return &user, nil
+}
+
+// AuthenticateToken находит пользователя по персональному токену
+func (s *AuthService) AuthenticateToken(token string) (*models.User, error) {
+	var apiToken models.APIToken
+	err := db.DB.Where("token_hash = ?", hashToken(token)).First(&apiToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, i18n.Errorf("ошибка получения токена: %w", err)
+	}
+
+	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidCredentials
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, apiToken.UserID).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Active {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if err := db.DB.Model(&apiToken).Update("last_used_at", now).Error; err != nil {
+		i18n.Logf("Ошибка обновления времени использования токена %d: %v", apiToken.ID, err)
+	}
+	return &user, nil
+}
+
+// CreateToken выпускает персональный токен. Возвращаемая строка токена больше нигде не сохраняется
+func (s *AuthService) CreateToken(username, name string, expiresAt *time.Time) (string, *models.APIToken, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return "", nil, err
+	}
+
+	random := make([]byte, 20)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, i18n.Errorf("ошибка генерации токена: %w", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(random)
+
+	apiToken := models.APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := db.DB.Create(&apiToken).Error; err != nil {
+		return "", nil, i18n.Errorf("ошибка сохранения токена: %w", err)
+	}
+
+	i18n.Logf("Выпущен токен %q для пользователя %s", name, username)
+	return token, &apiToken, nil
+}
+
+func (s *AuthService) ListTokens(username string) ([]models.APIToken, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []models.APIToken
+	err = db.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&tokens).Error
+	return tokens, err
+}
+
+func (s *AuthService) DeleteToken(username string, tokenID int) error {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	result := db.DB.Where("id = ? AND user_id = ?", tokenID, user.ID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		return i18n.Errorf("ошибка удаления токена: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return i18n.Errorf("токен не найден: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"os"
+	"time"
+)
+
+// BlobStore - общее content-addressable хранилище: одинаковые слои разных
+// репозиториев и тегов хранятся один раз под ключом blobs/sha256/<первые 2 символа>/<hex>.
+// Артефакты ссылаются на blob-ы через StoredFile, счетчик ссылок ведется в таблице blobs.
+type BlobStore struct{}
+
+var blobStore = &BlobStore{}
+
+// BlobLink - blob, на который ссылается артефакт
+type BlobLink struct {
+	FileName string
+	Hex      string
+	Size     int64
+}
+
+// Key возвращает ключ blob-а в хранилище артефактов
+func (b *BlobStore) Key(digestHex string) string {
+	return "blobs/sha256/" + digestHex[:2] + "/" + digestHex
+}
+
+// Stat возвращает размер blob или ошибку storage.ErrNotFound, если его нет в хранилище
+func (b *BlobStore) Stat(digestHex string) (int64, error) {
+	info, err := storage.Store.Stat(context.Background(), b.Key(digestHex))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (b *BlobStore) Exists(digestHex string) bool {
+	_, err := b.Stat(digestHex)
+	return err == nil
+}
+
+// Open открывает blob для чтения
+func (b *BlobStore) Open(digestHex string) (io.ReadSeekCloser, storage.Info, error) {
+	return storage.Store.Open(context.Background(), b.Key(digestHex))
+}
+
+// ReadAll читает небольшой blob (например, манифест) целиком
+func (b *BlobStore) ReadAll(digestHex string) ([]byte, error) {
+	reader, _, err := b.Open(digestHex)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Commit переносит проверенный файл в хранилище. Если такой blob уже есть, файл удаляется
+func (b *BlobStore) Commit(srcPath, digestHex string) error {
+	if b.Exists(digestHex) {
+		os.Remove(srcPath)
+		return b.register(digestHex)
+	}
+
+	if err := storage.Store.PutFile(context.Background(), b.Key(digestHex), srcPath); err != nil {
+		return i18n.Errorf("ошибка сохранения blob: %w", err)
+	}
+	return b.register(digestHex)
+}
+
+// WriteBytes сохраняет небольшой blob (например, манифест) из памяти
+func (b *BlobStore) WriteBytes(digestHex string, content []byte) error {
+	if !b.Exists(digestHex) {
+		err := storage.Store.Put(context.Background(), b.Key(digestHex), bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return i18n.Errorf("ошибка записи blob: %w", err)
+		}
+	}
+	return b.register(digestHex)
+}
+
+// register создает запись о blob с нулевым счетчиком ссылок, если ее еще нет
+func (b *BlobStore) register(digestHex string) error {
+	size, err := b.Stat(digestHex)
+	if err != nil {
+		return i18n.Errorf("ошибка чтения blob: %w", err)
+	}
+
+	blob := models.Blob{
+		Digest:    "sha256:" + digestHex,
+		Size:      size,
+		RefCount:  0,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob).Error
+	if err != nil {
+		return i18n.Errorf("ошибка сохранения записи blob: %w", err)
+	}
+	return nil
+}
+
+// Link привязывает blob-ы к артефакту и увеличивает их счетчики ссылок.
+// Вызывается внутри транзакции, в которой сохраняется сам артефакт.
+func (b *BlobStore) Link(tx *gorm.DB, artifactID int, repoType string, links []BlobLink) error {
+	for _, link := range links {
+		storedFile := models.StoredFile{
+			ArtifactID: artifactID,
+			RepoType:   repoType,
+			FileName:   link.FileName,
+			FilePath:   b.Key(link.Hex),
+			Size:       link.Size,
+			SHA256:     link.Hex,
+			CreatedAt:  time.Now(),
+		}
+		if err := tx.Create(&storedFile).Error; err != nil {
+			return i18n.Errorf("ошибка сохранения связи с blob: %w", err)
+		}
+
+		if err := b.Retain(tx, link.Hex, link.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlink удаляет связи артефакта с blob-ами и уменьшает их счетчики ссылок.
+// Сами файлы не удаляются: blob мог быть только что загружен под новый манифест,
+// поэтому blob-ы без ссылок удаляет сборщик мусора.
+func (b *BlobStore) Unlink(tx *gorm.DB, artifactID int, repoType string) error {
+	var storedFiles []models.StoredFile
+	err := tx.Where("artifact_id = ? AND repo_type = ?", artifactID, repoType).Find(&storedFiles).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения связей с blob: %w", err)
+	}
+
+	for _, storedFile := range storedFiles {
+		if err := b.Release(tx, storedFile.SHA256); err != nil {
+			return err
+		}
+	}
+
+	if len(storedFiles) > 0 {
+		err = tx.Where("artifact_id = ? AND repo_type = ?", artifactID, repoType).Delete(&models.StoredFile{}).Error
+		if err != nil {
+			return i18n.Errorf("ошибка удаления связей с blob: %w", err)
+		}
+	}
+	return nil
+}
+
+// Retain увеличивает счетчик ссылок blob-а, создавая запись о нем, если ее еще нет
+func (b *BlobStore) Retain(tx *gorm.DB, digestHex string, size int64) error {
+	result := tx.Model(&models.Blob{}).
+		Where("digest = ?", "sha256:"+digestHex).
+		Updates(map[string]interface{}{
+			"ref_count":  gorm.Expr("ref_count + 1"),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return i18n.Errorf("ошибка обновления счетчика ссылок blob: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	blob := models.Blob{
+		Digest:    "sha256:" + digestHex,
+		Size:      size,
+		RefCount:  1,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := tx.Create(&blob).Error; err != nil {
+		return i18n.Errorf("ошибка сохранения записи blob: %w", err)
+	}
+	return nil
+}
+
+// Release уменьшает счетчик ссылок blob-а
+func (b *BlobStore) Release(tx *gorm.DB, digestHex string) error {
+	err := tx.Model(&models.Blob{}).
+		Where("digest = ? AND ref_count > 0", "sha256:"+digestHex).
+		Updates(map[string]interface{}{
+			"ref_count":  gorm.Expr("ref_count - 1"),
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return i18n.Errorf("ошибка обновления счетчика ссылок blob: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package services
+
+import (
+	"context"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"regexp"
+	"time"
+)
+
+var ErrCleanupPolicyInvalid = newError(ErrInvalid, "CLEANUP_POLICY_INVALID", "недопустимое правило очистки")
+
+// CleanupPolicySpec - параметры создаваемого правила очистки
+type CleanupPolicySpec struct {
+	Name              string `json:"name"`
+	RepoType          string `json:"repo_type"`
+	Repository        string `json:"repository"`
+	KeepLast          int    `json:"keep_last"`
+	NotDownloadedDays int    `json:"not_downloaded_days"`
+	VersionPattern    string `json:"version_pattern"`
+	Enabled           *bool  `json:"enabled"`
+}
+
+// CleanupPolicyUpdate - изменяемые поля правила очистки. Поля, равные nil, не изменяются.
+type CleanupPolicyUpdate struct {
+	Name              *string `json:"name"`
+	KeepLast          *int    `json:"keep_last"`
+	NotDownloadedDays *int    `json:"not_downloaded_days"`
+	VersionPattern    *string `json:"version_pattern"`
+	Enabled           *bool   `json:"enabled"`
+}
+
+// CleanupOptions - параметры задачи очистки. Без PolicyID применяются все включенные правила репозитория
+type CleanupOptions struct {
+	PolicyID int `json:"policy_id,omitempty"`
+}
+
+// CleanupCandidate - версия артефакта, которую удаляет правило очистки
+type CleanupCandidate struct {
+	ID               int        `json:"id"`
+	Name             string     `json:"name"`
+	Version          string     `json:"version"`
+	Size             int64      `json:"size"`
+	DownloadCount    int        `json:"download_count"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// CleanupReport - удаленные правилом версии, при предпросмотре - версии, которые будут удалены
+type CleanupReport struct {
+	PolicyID   int                `json:"policy_id"`
+	Policy     string             `json:"policy"`
+	Repository string             `json:"repository"`
+	Preview    bool               `json:"preview"`
+	Count      int                `json:"count"`
+	Size       int64              `json:"size"`
+	Artifacts  []CleanupCandidate `json:"artifacts"`
+}
+
+type CleanupService struct{}
+
+// compileVersionPattern компилирует шаблон версии. Шаблон должен совпадать с версией целиком
+func compileVersionPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+func validateCleanupPolicy(policy *models.CleanupPolicy, repo *models.BaseRepository) error {
+	switch {
+	case policy.RepoType != FormatDocker && policy.RepoType != FormatHelm:
+		return i18n.Errorf("%w: очистка поддерживается только для docker и helm репозиториев", ErrCleanupPolicyInvalid)
+	case repo.Type == models.TypeGroup:
+		return i18n.Errorf("%w: группа не хранит артефакты, правила задаются для ее участников", ErrCleanupPolicyInvalid)
+	case policy.KeepLast < 0 || policy.NotDownloadedDays < 0:
+		return i18n.Errorf("%w: keep_last и not_downloaded_days не могут быть отрицательными", ErrCleanupPolicyInvalid)
+	case policy.KeepLast == 0 && policy.NotDownloadedDays == 0 && policy.VersionPattern == "":
+		return i18n.Errorf("%w: необходимо указать keep_last, not_downloaded_days или version_pattern", ErrCleanupPolicyInvalid)
+	}
+
+	if _, err := compileVersionPattern(policy.VersionPattern); err != nil {
+		return i18n.Errorf("%w: неверный version_pattern: %v", ErrCleanupPolicyInvalid, err)
+	}
+	return nil
+}
+
+// getPolicyFor находит правило очистки и проверяет право action на его репозиторий
+func (s *CleanupService) getPolicyFor(ctx context.Context, id int, action string) (*models.CleanupPolicy, *models.BaseRepository, error) {
+	var policy models.CleanupPolicy
+	if err := db.DB.First(&policy, id).Error; err != nil {
+		return nil, nil, i18n.Errorf("правило очистки не найдено: %w", err)
+	}
+
+	repo, err := scheduleRepository(ctx, policy.RepoType, policy.RepositoryName, action)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &policy, repo, nil
+}
+
+func (s *CleanupService) CreatePolicy(ctx context.Context, spec CleanupPolicySpec) (*models.CleanupPolicy, error) {
+	if _, err := repositoryModel(spec.RepoType); err != nil {
+		return nil, i18n.Errorf("%w: %v", ErrCleanupPolicyInvalid, err)
+	}
+
+	repo, err := scheduleRepository(ctx, spec.RepoType, spec.Repository, ActionAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := models.CleanupPolicy{
+		Name:              spec.Name,
+		RepoType:          spec.RepoType,
+		RepositoryID:      repo.ID,
+		RepositoryName:    repo.Name,
+		KeepLast:          spec.KeepLast,
+		NotDownloadedDays: spec.NotDownloadedDays,
+		VersionPattern:    spec.VersionPattern,
+		Enabled:           true,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+	if spec.Enabled != nil {
+		policy.Enabled = *spec.Enabled
+	}
+
+	if err := validateCleanupPolicy(&policy, repo); err != nil {
+		return nil, err
+	}
+
+	if err := db.DB.Create(&policy).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения правила очистки: %w", err)
+	}
+
+	i18n.Logf("Создано правило очистки %d для %s репозитория %s", policy.ID, policy.RepoType, policy.RepositoryName)
+	return &policy, nil
+}
+
+// ListPolicies возвращает правила очистки репозиториев, доступных пользователю на чтение
+func (s *CleanupService) ListPolicies(ctx context.Context, format, repoName string) ([]models.CleanupPolicy, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.DB.Order("id")
+	if format != "" {
+		query = query.Where("repo_type = ?", format)
+	}
+	if repoName != "" {
+		query = query.Where("repository_name = ?", repoName)
+	}
+
+	var policies []models.CleanupPolicy
+	if err := query.Find(&policies).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения правил очистки: %w", err)
+	}
+
+	readable := policies[:0]
+	for _, policy := range policies {
+		repo, err := findBaseRepository(policy.RepoType, policy.RepositoryName)
+		if err != nil {
+			continue
+		}
+		if scope.check(policy.RepoType, repo, ActionRead) == nil {
+			readable = append(readable, policy)
+		}
+	}
+	return readable, nil
+}
+
+func (s *CleanupService) GetPolicy(ctx context.Context, id int) (*models.CleanupPolicy, error) {
+	policy, _, err := s.getPolicyFor(ctx, id, ActionRead)
+	return policy, err
+}
+
+func (s *CleanupService) UpdatePolicy(ctx context.Context, id int, update CleanupPolicyUpdate) (*models.CleanupPolicy, error) {
+	policy, repo, err := s.getPolicyFor(ctx, id, ActionAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		policy.Name = *update.Name
+	}
+	if update.KeepLast != nil {
+		policy.KeepLast = *update.KeepLast
+	}
+	if update.NotDownloadedDays != nil {
+		policy.NotDownloadedDays = *update.NotDownloadedDays
+	}
+	if update.VersionPattern != nil {
+		policy.VersionPattern = *update.VersionPattern
+	}
+	if update.Enabled != nil {
+		policy.Enabled = *update.Enabled
+	}
+
+	if err := validateCleanupPolicy(policy, repo); err != nil {
+		return nil, err
+	}
+
+	policy.UpdatedAt = time.Now()
+	if err := db.DB.Save(policy).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения правила очистки: %w", err)
+	}
+	return policy, nil
+}
+
+func (s *CleanupService) DeletePolicy(ctx context.Context, id int) error {
+	policy, _, err := s.getPolicyFor(ctx, id, ActionAdmin)
+	if err != nil {
+		return err
+	}
+
+	if err := db.DB.Delete(policy).Error; err != nil {
+		return i18n.Errorf("ошибка удаления правила очистки: %w", err)
+	}
+
+	i18n.Logf("Удалено правило очистки %d для %s репозитория %s", policy.ID, policy.RepoType, policy.RepositoryName)
+	return nil
+}
+
+// PreviewPolicy возвращает версии, которые правило удалило бы сейчас, ничего не удаляя
+func (s *CleanupService) PreviewPolicy(ctx context.Context, id int) (*CleanupReport, error) {
+	policy, _, err := s.getPolicyFor(ctx, id, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := cleanupCandidates(policy)
+	if err != nil {
+		return nil, err
+	}
+	return newCleanupReport(policy, candidates, true), nil
+}
+
+// RunPolicy ставит в очередь задачу очистки по правилу, в том числе выключенному
+func (s *CleanupService) RunPolicy(ctx context.Context, id int) (*models.Task, error) {
+	policy, _, err := s.getPolicyFor(ctx, id, ActionDelete)
+	if err != nil {
+		return nil, err
+	}
+
+	return submitTask(ctx, models.Task{
+		Type:           TaskCleanup,
+		RepoType:       policy.RepoType,
+		RepositoryID:   policy.RepositoryID,
+		RepositoryName: policy.RepositoryName,
+	}, CleanupOptions{PolicyID: policy.ID})
+}
+
+func newCleanupReport(policy *models.CleanupPolicy, candidates []CleanupCandidate, preview bool) *CleanupReport {
+	report := &CleanupReport{
+		PolicyID:   policy.ID,
+		Policy:     policy.Name,
+		Repository: policy.RepositoryName,
+		Preview:    preview,
+		Artifacts:  []CleanupCandidate{},
+	}
+	for _, candidate := range candidates {
+		report.Count++
+		report.Size += candidate.Size
+		report.Artifacts = append(report.Artifacts, candidate)
+	}
+	return report
+}
+
+// cleanupCandidates возвращает версии артефактов, которые удаляет правило.
+// Для Docker рассматриваются только теги: образы без тега - вложенные манифесты manifest list,
+// они удаляются вместе с ним.
+func cleanupCandidates(policy *models.CleanupPolicy) ([]CleanupCandidate, error) {
+	pattern, err := compileVersionPattern(policy.VersionPattern)
+	if err != nil {
+		return nil, i18n.Errorf("%w: неверный version_pattern: %v", ErrCleanupPolicyInvalid, err)
+	}
+
+	query := db.DB.Where("repository_id = ?", policy.RepositoryID)
+	switch policy.RepoType {
+	case FormatDocker:
+		query = query.Model(&models.DockerImage{}).Where("tag <> ''")
+	case FormatHelm:
+		query = query.Model(&models.HelmChart{})
+	default:
+		return nil, i18n.Errorf("%w: очистка не поддерживается для %s репозиториев", ErrCleanupPolicyInvalid, policy.RepoType)
+	}
+
+	var artifacts []models.Artifact
+	if err := query.Order("name, created_at DESC, id DESC").Find(&artifacts).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения артефактов: %w", err)
+	}
+	return selectCleanupCandidates(policy, pattern, artifacts, time.Now()), nil
+}
+
+// selectCleanupCandidates выбирает версии к удалению из artifacts, упорядоченных по имени и от
+// новых к старым. Из версий, подходящих под шаблон, у каждого артефакта пропускаются KeepLast
+// самых новых, из остальных выбираются те, что не скачивались NotDownloadedDays дней до now
+// (никогда не скачанные - с момента загрузки).
+func selectCleanupCandidates(policy *models.CleanupPolicy, pattern *regexp.Regexp, artifacts []models.Artifact, now time.Time) []CleanupCandidate {
+	var cutoff time.Time
+	if policy.NotDownloadedDays > 0 {
+		cutoff = now.AddDate(0, 0, -policy.NotDownloadedDays)
+	}
+
+	kept := make(map[string]int)
+	var candidates []CleanupCandidate
+	for _, artifact := range artifacts {
+		if pattern != nil && !pattern.MatchString(artifact.Version) {
+			continue
+		}
+		if kept[artifact.Name] < policy.KeepLast {
+			kept[artifact.Name]++
+			continue
+		}
+		if policy.NotDownloadedDays > 0 {
+			lastUsed := artifact.CreatedAt
+			if artifact.DownloadCount > 0 && artifact.LastDownloadedAt != nil {
+				lastUsed = *artifact.LastDownloadedAt
+			}
+			if lastUsed.After(cutoff) {
+				continue
+			}
+		}
+
+		candidates = append(candidates, CleanupCandidate{
+			ID:               artifact.ID,
+			Name:             artifact.Name,
+			Version:          artifact.Version,
+			Size:             artifact.Size,
+			DownloadCount:    artifact.DownloadCount,
+			LastDownloadedAt: artifact.LastDownloadedAt,
+			CreatedAt:        artifact.CreatedAt,
+		})
+	}
+	return candidates
+}
+
+// runCleanupTask - обработчик задачи очистки: применяет правило из параметров задачи
+// или все включенные правила репозитория
+func runCleanupTask(ctx context.Context, run *TaskRun) error {
+	var options CleanupOptions
+	if err := run.Params(&options); err != nil {
+		return i18n.Errorf("неверные параметры задачи: %w", err)
+	}
+	if err := maintenance.check(); err != nil {
+		return err
+	}
+
+	query := db.DB.Where("repo_type = ? AND repository_id = ?", run.Task.RepoType, run.Task.RepositoryID)
+	if options.PolicyID != 0 {
+		query = query.Where("id = ?", options.PolicyID)
+	} else {
+		query = query.Where("enabled = ?", true)
+	}
+
+	var policies []models.CleanupPolicy
+	if err := query.Order("id").Find(&policies).Error; err != nil {
+		return i18n.Errorf("ошибка получения правил очистки: %w", err)
+	}
+	if len(policies) == 0 {
+		run.Logf("Нет правил очистки для применения")
+		return nil
+	}
+
+	reports := []CleanupReport{}
+	defer func() { run.SetResult(reports) }()
+
+	for i, policy := range policies {
+		report, err := applyCleanupPolicy(ctx, &policy, run)
+		if report != nil {
+			reports = append(reports, *report)
+		}
+		if err != nil {
+			return err
+		}
+		run.SetProgress((i + 1) * 100 / len(policies))
+	}
+	return nil
+}
+
+// applyCleanupPolicy удаляет выбранные правилом версии. Файлы blob-ов Docker образов
+// освобождаются следующей сборкой мусора.
+func applyCleanupPolicy(ctx context.Context, policy *models.CleanupPolicy, run *TaskRun) (*CleanupReport, error) {
+	candidates, err := cleanupCandidates(policy)
+	if err != nil {
+		return nil, err
+	}
+	run.Logf("Правило %d: к удалению %d версий", policy.ID, len(candidates))
+
+	var deleted []CleanupCandidate
+	for _, candidate := range candidates {
+		if err := ctx.Err(); err != nil {
+			return newCleanupReport(policy, deleted, false), err
+		}
+
+		switch policy.RepoType {
+		case FormatDocker:
+			err = (&DockerService{}).deleteImage(candidate.ID)
+		case FormatHelm:
+			err = (&HelmService{}).DeleteChart(ctx, policy.RepositoryName, candidate.Name, candidate.Version)
+		}
+		if err != nil {
+			return newCleanupReport(policy, deleted, false), i18n.Errorf("ошибка удаления %s:%s: %w", candidate.Name, candidate.Version, err)
+		}
+
+		deleted = append(deleted, candidate)
+		run.Logf("Удалена версия %s:%s", candidate.Name, candidate.Version)
+	}
+
+	if len(deleted) > 0 {
+		i18n.Logf("Правило очистки %d удалило из %s репозитория %s версий: %d", policy.ID, policy.RepoType, policy.RepositoryName, len(deleted))
+	}
+	return newCleanupReport(policy, deleted, false), nil
+}
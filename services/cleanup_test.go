@@ -0,0 +1,93 @@
+package services
+
+import (
+	"github.com/Viste/larets/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSelectCleanupCandidates(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	downloaded := func(days int) *time.Time {
+		at := daysAgo(days)
+		return &at
+	}
+
+	// как их возвращает запрос: по имени, от новых версий к старым
+	artifacts := []models.Artifact{
+		{ID: 1, Name: "api", Version: "2.0.0", CreatedAt: daysAgo(1)},
+		{ID: 2, Name: "api", Version: "2.0.0-rc.1", CreatedAt: daysAgo(5)},
+		{ID: 3, Name: "api", Version: "1.1.0", CreatedAt: daysAgo(40), DownloadCount: 3, LastDownloadedAt: downloaded(2)},
+		{ID: 4, Name: "api", Version: "1.0.0", CreatedAt: daysAgo(60), DownloadCount: 1, LastDownloadedAt: downloaded(45)},
+		{ID: 5, Name: "api", Version: "0.9.0", CreatedAt: daysAgo(90)},
+		{ID: 6, Name: "web", Version: "1.0.0", CreatedAt: daysAgo(100)},
+		{ID: 7, Name: "web", Version: "0.1.0-dev", CreatedAt: daysAgo(120)},
+	}
+
+	tests := []struct {
+		name    string
+		policy  models.CleanupPolicy
+		wantIDs []int
+	}{
+		{
+			name:    "keep last",
+			policy:  models.CleanupPolicy{KeepLast: 2},
+			wantIDs: []int{3, 4, 5},
+		},
+		{
+			name:    "keep last larger than versions",
+			policy:  models.CleanupPolicy{KeepLast: 10},
+			wantIDs: nil,
+		},
+		{
+			name:    "not downloaded days",
+			policy:  models.CleanupPolicy{NotDownloadedDays: 30},
+			wantIDs: []int{4, 5, 6, 7},
+		},
+		{
+			name:    "version pattern",
+			policy:  models.CleanupPolicy{VersionPattern: `.*-.*`},
+			wantIDs: []int{2, 7},
+		},
+		{
+			name:    "keep last and not downloaded days",
+			policy:  models.CleanupPolicy{KeepLast: 1, NotDownloadedDays: 30},
+			wantIDs: []int{4, 5, 7},
+		},
+		{
+			// версии, не подходящие под шаблон, не входят и в число сохраняемых
+			name:    "version pattern and keep last",
+			policy:  models.CleanupPolicy{KeepLast: 1, VersionPattern: `\d+\.\d+\.\d+`},
+			wantIDs: []int{3, 4, 5},
+		},
+		{
+			name:    "all conditions",
+			policy:  models.CleanupPolicy{KeepLast: 1, NotDownloadedDays: 30, VersionPattern: `[0-9.]+`},
+			wantIDs: []int{4, 5},
+		},
+		{
+			name:    "pattern matches whole version",
+			policy:  models.CleanupPolicy{VersionPattern: `1\.0`},
+			wantIDs: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := compileVersionPattern(tt.policy.VersionPattern)
+			if err != nil {
+				t.Fatalf("compileVersionPattern(%q) error = %v", tt.policy.VersionPattern, err)
+			}
+
+			var gotIDs []int
+			for _, candidate := range selectCleanupCandidates(&tt.policy, pattern, artifacts, now) {
+				gotIDs = append(gotIDs, candidate.ID)
+			}
+			if !reflect.DeepEqual(gotIDs, tt.wantIDs) {
+				t.Errorf("candidates = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -1,15 +1,20 @@
 package services
 
 import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Viste/larets/config"
 	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
 	"github.com/Viste/larets/models"
+	"gorm.io/gorm"
 	"io"
-	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,251 +23,552 @@ import (
 
 type DockerService struct{}
 
-func (s *DockerService) CreateRepository(name, description string, repoType models.RepositoryType, url string) error {
+// CreateRepository создает Docker репозиторий. username и password используются прокси-репозиторием
+// для аутентификации в удаленном реестре, для анонимного доступа их можно не указывать.
+// members - участники группы, они сохраняются вместе с ней.
+func (s *DockerService) CreateRepository(ctx context.Context, name, description string, repoType models.RepositoryType, url, username, password string, anonymousRead bool, members []GroupMemberSpec) error {
+	if err := authorizeName(ctx, FormatDocker, name, ActionAdmin); err != nil {
+		return err
+	}
+
 	var count int64
 	db.DB.Model(&models.DockerRepository{}).Where("name = ?", name).Count(&count)
 	if count > 0 {
-		return errors.New("репозиторий с таким именем уже существует")
+		return i18n.Errorf("%w: %s", ErrRepositoryExists, name)
 	}
 
 	storagePath := filepath.Join(config.Config.DockerStorage, name)
 	if err := os.MkdirAll(storagePath, 0755); err != nil {
-		return fmt.Errorf("ошибка создания директории хранилища: %w", err)
+		return i18n.Errorf("ошибка создания директории хранилища: %w", err)
 	}
 
 	repo := models.DockerRepository{
 		BaseRepository: models.BaseRepository{
-			Name:        name,
-			Description: description,
-			Type:        repoType,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
+			Name:          name,
+			Description:   description,
+			Type:          repoType,
+			AnonymousRead: anonymousRead,
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
 		},
 		URL:          url,
+		Username:     username,
+		Password:     password,
 		IndexType:    "v2",
 		CacheEnabled: true,
 		CacheTTL:     config.Config.DefaultCacheTTL,
 		StoragePath:  storagePath,
 	}
 
-	if err := db.DB.Create(&repo).Error; err != nil {
+	if err := createRepositoryRecord(ctx, FormatDocker, &repo, &repo.BaseRepository, members); err != nil {
 		os.RemoveAll(storagePath)
-		return fmt.Errorf("ошибка сохранения репозитория: %w", err)
+		return err
 	}
 
-	log.Printf("Создан Docker репозиторий: %s, тип: %s", name, repoType)
+	i18n.Logf("Создан Docker репозиторий: %s, тип: %s", name, repoType)
 	return nil
 }
 
-func (s *DockerService) ListRepositories() ([]models.DockerRepository, error) {
+// ListRepositories возвращает репозитории, доступные пользователю на чтение
+func (s *DockerService) ListRepositories(ctx context.Context) ([]models.DockerRepository, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var repos []models.DockerRepository
-	err := db.DB.Find(&repos).Error
-	return repos, err
+	if err := db.DB.Find(&repos).Error; err != nil {
+		return nil, err
+	}
+
+	readable := repos[:0]
+	for _, repo := range repos {
+		if scope.check(FormatDocker, &repo.BaseRepository, ActionRead) == nil {
+			readable = append(readable, repo)
+		}
+	}
+	return readable, nil
 }
 
-func (s *DockerService) GetRepository(name string) (*models.DockerRepository, error) {
+func (s *DockerService) GetRepository(ctx context.Context, name string) (*models.DockerRepository, error) {
+	repo, err := s.getRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, FormatDocker, &repo.BaseRepository, ActionRead); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (s *DockerService) getRepository(name string) (*models.DockerRepository, error) {
 	var repo models.DockerRepository
 	err := db.DB.Where("name = ?", name).First(&repo).Error
 	if err != nil {
-		return nil, fmt.Errorf("репозиторий не найден: %w", err)
+		return nil, repositoryLookupError(name, err)
 	}
 	return &repo, nil
 }
 
-func (s *DockerService) StoreImage(repoName, imageName, tag string, imageData io.Reader) error {
-	repo, err := s.GetRepository(repoName)
+// DeleteRepository удаляет репозиторий вместе с записями образов, связями с blob-ами,
+// незавершенными загрузками и участием в группах. Сами blob-ы удаляет сборщик мусора.
+// В режиме dryRun ничего не удаляется, а возвращается отчет о том, что будет удалено.
+func (s *DockerService) DeleteRepository(ctx context.Context, name string, dryRun, force bool) (*DeleteReport, error) {
+	repo, err := s.getRepository(name)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := authorize(ctx, FormatDocker, &repo.BaseRepository, ActionAdmin); err != nil {
+		return nil, err
 	}
 
-	if repo.Type != models.TypeHosted {
-		return errors.New("нельзя сохранять образы в репозиторий, который не является хостовым")
+	report, err := newDeleteReport(FormatDocker, &repo.BaseRepository, repo.StoragePath, dryRun)
+	if err != nil {
+		return nil, err
 	}
 
-	imagePath := filepath.Join(repo.StoragePath, imageName, tag)
-	if err := os.MkdirAll(imagePath, 0755); err != nil {
-		return fmt.Errorf("ошибка создания директории образа: %w", err)
+	var imageIDs []int
+	db.DB.Model(&models.DockerImage{}).Where("repository_id = ?", repo.ID).Pluck("id", &imageIDs)
+	report.Artifacts = int64(len(imageIDs))
+	if len(imageIDs) > 0 {
+		db.DB.Model(&models.StoredFile{}).Where("artifact_id IN ? AND repo_type = ?", imageIDs, "docker").Count(&report.StoredFiles)
 	}
 
-	imageTarPath := filepath.Join(imagePath, "image.tar")
-	imageFile, err := os.Create(imageTarPath)
-	if err != nil {
-		return fmt.Errorf("ошибка создания файла образа: %w", err)
+	var uploads []models.DockerUpload
+	db.DB.Where("repository_id = ?", repo.ID).Find(&uploads)
+	report.Uploads = int64(len(uploads))
+
+	if err := report.checkGroupMembership(force); err != nil || dryRun {
+		return report, err
 	}
-	defer imageFile.Close()
 
-	size, err := io.Copy(imageFile, imageData)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range imageIDs {
+			if err := blobStore.Unlink(tx, id, "docker"); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("repository_id = ?", repo.ID).Delete(&models.DockerImage{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления записей образов: %w", err)
+		}
+		for _, upload := range uploads {
+			if !upload.Cached {
+				continue
+			}
+			if err := blobStore.Release(tx, strings.TrimPrefix(upload.Digest, "sha256:")); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("repository_id = ?", repo.ID).Delete(&models.DockerUpload{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления сессий загрузки: %w", err)
+		}
+		if err := deleteRepositoryRecords(tx, FormatDocker, repo.ID); err != nil {
+			return err
+		}
+		return tx.Delete(repo).Error
+	})
 	if err != nil {
-		return fmt.Errorf("ошибка записи данных образа: %w", err)
+		return nil, i18n.Errorf("ошибка удаления репозитория: %w", err)
 	}
 
-	// TODO: посчитать SHA256 для чека целостности
+	for _, upload := range uploads {
+		os.Remove(upload.Path)
+	}
+	removeStorage(config.Config.DockerStorage, repo.StoragePath)
 
-	imageRecord := models.DockerImage{
-		Artifact: models.Artifact{
-			RepositoryID:  repo.ID,
-			RepoType:      "docker",
-			Name:          imageName,
-			Version:       tag,
-			Path:          imageTarPath,
-			Size:          size,
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
-			DownloadCount: 0,
-		},
-		Tag: tag,
+	i18n.Logf("Удален Docker репозиторий %s: образов %d, загрузок %d", name, report.Artifacts, report.Uploads)
+	return report, nil
+}
+
+// UpdateRepository изменяет настройки Docker репозитория. Кешированные образы прокси-репозитория
+// после смены URL остаются и перепроверяются у нового реестра по истечении CacheTTL.
+func (s *DockerService) UpdateRepository(ctx context.Context, name string, update RepositoryUpdate) (*models.DockerRepository, error) {
+	repo, err := s.getRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, FormatDocker, &repo.BaseRepository, ActionAdmin); err != nil {
+		return nil, err
+	}
+	if err := update.validate(FormatDocker, repo.Type); err != nil {
+		return nil, err
 	}
 
-	if err := db.DB.Create(&imageRecord).Error; err != nil {
-		os.Remove(imageTarPath)
-		return fmt.Errorf("ошибка сохранения записи образа: %w", err)
+	update.applyBase(&repo.BaseRepository)
+	if update.URL != nil {
+		repo.URL = *update.URL
+	}
+	if update.Username != nil {
+		repo.Username = *update.Username
+	}
+	if update.Password != nil {
+		repo.Password = *update.Password
+	}
+	if update.CacheEnabled != nil {
+		repo.CacheEnabled = *update.CacheEnabled
+	}
+	if update.CacheTTL != nil {
+		repo.CacheTTL = *update.CacheTTL
 	}
 
-	log.Printf("Сохранен Docker образ: %s:%s в репозиторий %s", imageName, tag, repoName)
-	return nil
+	if err := db.DB.Save(repo).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения репозитория: %w", err)
+	}
+
+	i18n.Logf("Изменены настройки Docker репозитория %s", name)
+	return repo, nil
 }
 
-func (s *DockerService) FetchImageFromProxy(repoName, imageName, tag string) (string, error) {
-	repo, err := s.GetRepository(repoName)
+// StoreImage импортирует архив, созданный `docker save`, в хранилище репозитория:
+// каждый файл архива сохраняется как blob, а из manifest.json собирается манифест schema2
+func (s *DockerService) StoreImage(ctx context.Context, repoName, imageName, tag string, imageData io.Reader) error {
+	repo, err := s.getRepository(repoName)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	if repo.Type != models.TypeProxy {
-		return "", errors.New("репозиторий не является прокси")
+	if err := authorize(ctx, FormatDocker, &repo.BaseRepository, ActionWrite); err != nil {
+		return err
 	}
 
-	imagePath := filepath.Join(repo.StoragePath, imageName, tag)
-	imageTarPath := filepath.Join(imagePath, "image.tar")
+	if repo.Type != models.TypeHosted {
+		return i18n.Errorf("%w: нельзя сохранять образы в репозиторий %s", ErrRepositoryNotHosted, repo.Name)
+	}
+
+	tempDir, err := os.MkdirTemp(config.Config.TempStorage, "docker-image-")
+	if err != nil {
+		return i18n.Errorf("ошибка создания временной директории: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	type archiveEntry struct {
+		path string
+		hex  string
+		size int64
+		gzip bool
+	}
+	entries := make(map[string]archiveEntry)
+	var saveManifest []struct {
+		Config string   `json:"Config"`
+		Layers []string `json:"Layers"`
+	}
+
+	reader := tar.NewReader(imageData)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return i18n.Errorf("ошибка чтения архива образа: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
 
-	if repo.CacheEnabled {
-		info, err := os.Stat(imageTarPath)
-		if err == nil {
-			modTime := info.ModTime()
-			cacheDuration := time.Duration(repo.CacheTTL) * time.Minute
-			if time.Since(modTime) < cacheDuration {
-				log.Printf("Используем кешированный образ: %s:%s", imageName, tag)
-				return imageTarPath, nil
+		if header.Name == "manifest.json" {
+			if err := json.NewDecoder(reader).Decode(&saveManifest); err != nil {
+				return i18n.Errorf("ошибка чтения manifest.json: %w", err)
 			}
+			continue
+		}
+
+		entryPath := filepath.Join(tempDir, fmt.Sprintf("%d", len(entries)))
+		entryFile, err := os.Create(entryPath)
+		if err != nil {
+			return i18n.Errorf("ошибка создания временного файла: %w", err)
+		}
+
+		hasher := sha256.New()
+		size, err := io.Copy(io.MultiWriter(entryFile, hasher), reader)
+		entryFile.Close()
+		if err != nil {
+			return i18n.Errorf("ошибка записи данных образа: %w", err)
+		}
+
+		magic := make([]byte, 2)
+		if f, err := os.Open(entryPath); err == nil {
+			io.ReadFull(f, magic)
+			f.Close()
+		}
+
+		entries[header.Name] = archiveEntry{
+			path: entryPath,
+			hex:  hex.EncodeToString(hasher.Sum(nil)),
+			size: size,
+			gzip: magic[0] == 0x1f && magic[1] == 0x8b,
+		}
+	}
+
+	if len(saveManifest) == 0 {
+		return i18n.Errorf("%w: архив не содержит manifest.json, ожидается результат docker save", ErrInvalid)
+	}
+
+	commit := func(name, mediaType string) (manifestDescriptor, error) {
+		entry, ok := entries[name]
+		if !ok {
+			return manifestDescriptor{}, i18n.Errorf("в архиве отсутствует файл %s", name)
+		}
+		if err := blobStore.Commit(entry.path, entry.hex); err != nil {
+			return manifestDescriptor{}, err
 		}
+		return manifestDescriptor{MediaType: mediaType, Digest: "sha256:" + entry.hex, Size: entry.size}, nil
 	}
 
-	log.Printf("Получение образа %s:%s из удаленного репозитория %s", imageName, tag, repo.URL)
+	configDescriptor, err := commit(saveManifest[0].Config, "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		return err
+	}
 
-	remoteURL := fmt.Sprintf("%s/v2/%s/manifests/%s", repo.URL, imageName, tag)
+	manifest := imageManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeDockerManifest,
+		Config:        configDescriptor,
+	}
+	for _, layerName := range saveManifest[0].Layers {
+		mediaType := "application/vnd.docker.image.rootfs.diff.tar"
+		if entries[layerName].gzip {
+			mediaType = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+		}
+		layerDescriptor, err := commit(layerName, mediaType)
+		if err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, layerDescriptor)
+	}
 
-	resp, err := http.Get(remoteURL)
+	content, err := json.Marshal(manifest)
 	if err != nil {
-		return "", fmt.Errorf("ошибка получения манифеста: %w", err)
+		return i18n.Errorf("ошибка формирования манифеста: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ошибка получения манифеста, код ответа: %d", resp.StatusCode)
+	if _, err := s.PutManifest(ctx, repoName, imageName, tag, MediaTypeDockerManifest, content); err != nil {
+		return err
 	}
 
-	var manifest map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
-		return "", fmt.Errorf("ошибка декодирования манифеста: %w", err)
+	i18n.Logf("Сохранен Docker образ: %s:%s в репозиторий %s", imageName, tag, repoName)
+	return nil
+}
+
+// FetchImageFromProxy получает образ из удаленного реестра: манифест, config и все слои
+// (для manifest list / OCI index - все вложенные манифесты) сохраняются в хранилище,
+// после чего образ отдается через Registry API без обращения к upstream до истечения CacheTTL
+func (s *DockerService) FetchImageFromProxy(ctx context.Context, repoName, imageName, reference string) (*models.DockerImage, error) {
+	repo, err := s.GetRepository(ctx, repoName)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := os.MkdirAll(imagePath, 0755); err != nil {
-		return "", fmt.Errorf("ошибка создания директории образа: %w", err)
+	if repo.Type != models.TypeProxy {
+		return nil, i18n.Errorf("%w: %s", ErrRepositoryNotProxy, repo.Name)
 	}
 
-	// TODO: Скачивание слоев образа и сборка tar-архива
-	// 1. Получить список слоев из манифеста
-	// 2. Скачать каждый слой
-	// 3. Собрать tar-архив образа
+	if repo.URL == "" {
+		return nil, i18n.Errorf("%w: %s", ErrRemoteURLMissing, repo.Name)
+	}
 
-	// Заглушка: записываем манифест в файл для примера
-	manifestPath := filepath.Join(imagePath, "manifest.json")
-	manifestFile, err := os.Create(manifestPath)
+	cached, err := s.findImage(repo, imageName, reference)
+	if err != nil && !errors.Is(err, ErrManifestUnknown) {
+		return nil, err
+	}
+
+	if cached != nil && repo.CacheEnabled {
+		// манифест по digest неизменяем, тег проверяем по TTL
+		cacheDuration := time.Duration(repo.CacheTTL) * time.Minute
+		if isDigest(reference) || time.Since(cached.UpdatedAt) < cacheDuration {
+			i18n.Logf("Используем кешированный образ: %s:%s", imageName, reference)
+			metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheHit)
+			return cached, nil
+		}
+	}
+
+	// во время обслуживания хранилища кеш не пополняется
+	if err := maintenance.check(); err != nil {
+		if cached != nil {
+			metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheStale)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%d/%s:%s", repo.ID, imageName, reference)
+	result, err, _ := proxyFetches.Do(key, func() (interface{}, error) {
+		return s.fetchImageTree(repo, imageName, reference, cached)
+	})
 	if err != nil {
-		return "", fmt.Errorf("ошибка создания файла манифеста: %w", err)
+		if cached != nil {
+			i18n.Logf("Ошибка обновления образа %s:%s из %s, используем кеш: %v", imageName, reference, repo.URL, err)
+			metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheStale)
+			return cached, nil
+		}
+		metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheMiss)
+		return nil, err
 	}
-	defer manifestFile.Close()
 
-	if err := json.NewEncoder(manifestFile).Encode(manifest); err != nil {
-		return "", fmt.Errorf("ошибка записи манифеста: %w", err)
+	image := result.(*models.DockerImage)
+	if cached != nil && image.SHA256 == cached.SHA256 {
+		metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheRevalidated)
+	} else {
+		metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheMiss)
+	}
+	return image, nil
+}
+
+func (s *DockerService) fetchImageTree(repo *models.DockerRepository, imageName, reference string, cached *models.DockerImage) (*models.DockerImage, error) {
+	client := newUpstreamClient(repo)
+
+	// тег не изменился в upstream - достаточно продлить срок жизни кеша
+	if cached != nil && !isDigest(reference) {
+		digest, err := client.manifestDigest(imageName, reference)
+		if err == nil && digest == "sha256:"+cached.SHA256 {
+			cached.UpdatedAt = time.Now()
+			if err := db.DB.Model(cached).Update("updated_at", cached.UpdatedAt).Error; err != nil {
+				return nil, i18n.Errorf("ошибка обновления записи образа: %w", err)
+			}
+			i18n.Logf("Образ %s:%s в удаленном репозитории не изменился", imageName, reference)
+			return cached, nil
+		}
 	}
 
-	imageFile, err := os.Create(imageTarPath)
+	i18n.Logf("Получение образа %s:%s из удаленного репозитория %s", imageName, reference, repo.URL)
+
+	content, mediaType, err := client.fetchManifest(imageName, reference)
 	if err != nil {
-		return "", fmt.Errorf("ошибка создания файла образа: %w", err)
-	}
-	defer imageFile.Close()
-
-	imageRecord := models.DockerImage{
-		Artifact: models.Artifact{
-			RepositoryID:  repo.ID,
-			RepoType:      "docker",
-			Name:          imageName,
-			Version:       tag,
-			Path:          imageTarPath,
-			Size:          0, // TODO: посчитать реальный размер
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
-			DownloadCount: 0,
-		},
-		Tag: tag,
+		return nil, err
 	}
 
-	var count int64
-	db.DB.Model(&models.DockerImage{}).
-		Joins("JOIN artifacts ON docker_images.artifact_id = artifacts.id").
-		Where("artifacts.repository_id = ? AND artifacts.name = ? AND docker_images.tag = ?",
-			repo.ID, imageName, tag).
-		Count(&count)
+	var manifest imageManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, i18n.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
 
-	if count > 0 {
-		db.DB.Model(&models.DockerImage{}).
-			Joins("JOIN artifacts ON docker_images.artifact_id = artifacts.id").
-			Where("artifacts.repository_id = ? AND artifacts.name = ? AND docker_images.tag = ?",
-				repo.ID, imageName, tag).
-			Updates(map[string]interface{}{
-				"updated_at": time.Now(),
-			})
+	if isManifestList(mediaType) {
+		for _, child := range manifest.Manifests {
+			if _, err := s.fetchImageTree(repo, imageName, child.Digest, nil); err != nil {
+				return nil, i18n.Errorf("ошибка получения манифеста %s: %w", child.Digest, err)
+			}
+		}
 	} else {
-		if err := db.DB.Create(&imageRecord).Error; err != nil {
-			return "", fmt.Errorf("ошибка сохранения записи образа: %w", err)
+		for _, descriptor := range append([]manifestDescriptor{manifest.Config}, manifest.Layers...) {
+			if err := s.fetchBlob(client, imageName, descriptor.Digest); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	log.Printf("Образ %s:%s получен из удаленного репозитория и сохранен в кеше", imageName, tag)
-	return imageTarPath, nil
+	if _, err := s.storeManifest(repo, imageName, reference, mediaType, content); err != nil {
+		return nil, err
+	}
+
+	image, err := s.findImage(repo, imageName, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	i18n.Logf("Образ %s:%s получен из удаленного репозитория и сохранен в кеше", imageName, reference)
+	return image, nil
 }
 
-func (s *DockerService) ListImages(repoName string) ([]models.DockerImage, error) {
-	repo, err := s.GetRepository(repoName)
+// deleteImage удаляет образ и вложенные манифесты manifest list, на которые больше не ссылается
+// ни один образ репозитория. Blob-ы без ссылок удаляет сборщик мусора.
+func (s *DockerService) deleteImage(imageID int) error {
+	var image models.DockerImage
+	if err := db.DB.First(&image, imageID).Error; err != nil {
+		return i18n.Errorf("образ не найден: %w", err)
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := blobStore.Unlink(tx, image.ID, "docker"); err != nil {
+			return err
+		}
+		if err := tx.Delete(&image).Error; err != nil {
+			return i18n.Errorf("ошибка удаления записи образа: %w", err)
+		}
+
+		if !isManifestList(image.MediaType) {
+			return nil
+		}
+		var manifest imageManifest
+		if json.Unmarshal(image.Manifest, &manifest) != nil {
+			return nil
+		}
+
+		for _, child := range manifest.Manifests {
+			childHex, err := ParseDigest(child.Digest)
+			if err != nil {
+				continue
+			}
+
+			var references int64
+			err = tx.Model(&models.StoredFile{}).
+				Where("repo_type = ? AND sha256 = ? AND artifact_id IN (?)", "docker", childHex,
+					tx.Model(&models.DockerImage{}).Select("id").Where("repository_id = ? AND sha256 <> ?", image.RepositoryID, childHex)).
+				Count(&references).Error
+			if err != nil {
+				return i18n.Errorf("ошибка поиска ссылок на манифест: %w", err)
+			}
+			if references > 0 {
+				continue
+			}
+
+			var children []models.DockerImage
+			err = tx.Where("repository_id = ? AND name = ? AND sha256 = ? AND tag = ''", image.RepositoryID, image.Name, childHex).
+				Find(&children).Error
+			if err != nil {
+				return i18n.Errorf("ошибка поиска вложенного манифеста: %w", err)
+			}
+			for _, childImage := range children {
+				if err := blobStore.Unlink(tx, childImage.ID, "docker"); err != nil {
+					return err
+				}
+				if err := tx.Delete(&childImage).Error; err != nil {
+					return i18n.Errorf("ошибка удаления записи образа: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DockerService) ListImages(ctx context.Context, repoName string) ([]models.DockerImage, error) {
+	repo, err := s.GetRepository(ctx, repoName)
 	if err != nil {
 		return nil, err
 	}
 
 	var images []models.DockerImage
-	err = db.DB.Joins("JOIN artifacts ON docker_images.artifact_id = artifacts.id").
-		Where("artifacts.repository_id = ?", repo.ID).
-		Find(&images).Error
+	err = db.DB.Where("repository_id = ?", repo.ID).Find(&images).Error
 
 	return images, err
 }
 
-func (s *DockerService) SearchImages(query string) ([]models.DockerImage, error) {
+// SearchImages ищет образы по имени и тегу в репозиториях, доступных пользователю на чтение
+func (s *DockerService) SearchImages(ctx context.Context, query string) ([]models.DockerImage, error) {
+	repos, err := s.ListRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repoIDs := make([]int, 0, len(repos))
+	for _, repo := range repos {
+		repoIDs = append(repoIDs, repo.ID)
+	}
+
 	var images []models.DockerImage
+	if len(repoIDs) == 0 {
+		return images, nil
+	}
 
+	search := db.DB.Where("repository_id IN ?", repoIDs)
 	if strings.Contains(query, ":") {
 		parts := strings.Split(query, ":")
 		name, tag := parts[0], parts[1]
 
-		err := db.DB.Joins("JOIN artifacts ON docker_images.artifact_id = artifacts.id").
-			Where("artifacts.name LIKE ? AND docker_images.tag LIKE ?",
-				"%"+name+"%", "%"+tag+"%").
+		err := search.Where("name LIKE ? AND tag LIKE ?", "%"+name+"%", "%"+tag+"%").
 			Find(&images).Error
 		return images, err
 	}
 
-	err := db.DB.Joins("JOIN artifacts ON docker_images.artifact_id = artifacts.id").
-		Where("artifacts.name LIKE ?", "%"+query+"%").
-		Find(&images).Error
+	err = search.Where("name LIKE ?", "%"+query+"%").Find(&images).Error
 	return images, err
 }
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"sort"
+)
+
+// isRegistryNotFound сообщает, что в репозитории нет запрошенного объекта,
+// и поиск в группе можно продолжить со следующего участника
+func isRegistryNotFound(err error) bool {
+	return errors.Is(err, ErrNameUnknown) || errors.Is(err, ErrManifestUnknown) || errors.Is(err, ErrBlobUnknown)
+}
+
+// getGroupManifest ищет манифест у участников группы в порядке приоритета.
+// Право чтения группы дает доступ к артефактам ее участников.
+func (s *DockerService) getGroupManifest(ctx context.Context, group *models.DockerRepository, imageName, reference string) (*ManifestContent, error) {
+	members, err := groupMembers(FormatDocker, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		manifest, err := s.GetManifest(withSystemAccess(ctx), member.MemberName, imageName, reference)
+		if err == nil {
+			return manifest, nil
+		}
+		if !isRegistryNotFound(err) {
+			i18n.Logf("Ошибка получения манифеста %s:%s из репозитория %s группы %s: %v",
+				imageName, reference, member.MemberName, group.Name, err)
+		}
+	}
+	return nil, i18n.Errorf("%w: %s:%s", ErrManifestUnknown, imageName, reference)
+}
+
+// getGroupBlob ищет blob у участников группы в порядке приоритета
+func (s *DockerService) getGroupBlob(ctx context.Context, group *models.DockerRepository, imageName, digest string) (*BlobContent, error) {
+	members, err := groupMembers(FormatDocker, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		blob, err := s.GetBlob(withSystemAccess(ctx), member.MemberName, imageName, digest)
+		if err == nil {
+			return blob, nil
+		}
+		if !isRegistryNotFound(err) {
+			i18n.Logf("Ошибка получения blob %s из репозитория %s группы %s: %v",
+				digest, member.MemberName, group.Name, err)
+		}
+	}
+	return nil, i18n.Errorf("%w: %s", ErrBlobUnknown, digest)
+}
+
+// listGroupTags объединяет теги образа всех участников группы
+func (s *DockerService) listGroupTags(ctx context.Context, group *models.DockerRepository, imageName string) ([]string, error) {
+	members, err := groupMembers(FormatDocker, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, member := range members {
+		memberTags, err := s.ListTags(withSystemAccess(ctx), member.MemberName, imageName)
+		if err != nil {
+			if !isRegistryNotFound(err) {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, tag := range memberTags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil, i18n.Errorf("%w: %s/%s", ErrNameUnknown, group.Name, imageName)
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
+	"github.com/Viste/larets/models"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestAcceptTypes - типы манифестов, которые Larets умеет хранить и отдавать.
+// Без заголовка Accept многие реестры отдают устаревший schema1.
+var manifestAcceptTypes = []string{
+	MediaTypeOCIIndex,
+	MediaTypeDockerManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifest,
+}
+
+// proxyFetches объединяет одновременные запросы одного и того же образа или blob,
+// чтобы upstream не скачивался несколько раз параллельно
+var proxyFetches singleflight.Group
+
+type upstreamClient struct {
+	repository string // имя прокси-репозитория для метрик
+	baseURL    string
+	username   string
+	password   string
+	http       *http.Client
+}
+
+func newUpstreamClient(repo *models.DockerRepository) *upstreamClient {
+	return &upstreamClient{
+		repository: repo.Name,
+		baseURL:    strings.TrimSuffix(repo.URL, "/"),
+		username:   repo.Username,
+		password:   repo.Password,
+		http:       &http.Client{Timeout: 30 * time.Minute},
+	}
+}
+
+// upstreamImageName добавляет префикс library/ к официальным образам Docker Hub:
+// registry-1.docker.io отвечает 401 на запросы вида /v2/nginx/...
+func (c *upstreamClient) upstreamImageName(imageName string) string {
+	if strings.Contains(imageName, "/") {
+		return imageName
+	}
+
+	parsed, err := url.Parse(c.baseURL)
+	if err != nil {
+		return imageName
+	}
+	switch parsed.Hostname() {
+	case "docker.io", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "library/" + imageName
+	}
+	return imageName
+}
+
+// do выполняет запрос к upstream и учитывает в метриках ошибки: сетевые и коды ответа,
+// кроме 404, который означает отсутствие артефакта
+func (c *upstreamClient) do(method, imageName, path string, accept []string) (*http.Response, error) {
+	resp, err := c.request(method, imageName, path, accept)
+	if err != nil || (resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound) {
+		metrics.UpstreamError(FormatDocker, c.repository)
+	}
+	return resp, err
+}
+
+// request выполняет запрос к upstream. Если реестр отвечает 401 с Bearer challenge,
+// получает токен у сервиса авторизации (анонимно или с учетными данными репозитория),
+// кеширует его и повторяет запрос
+func (c *upstreamClient) request(method, imageName, path string, accept []string) (*http.Response, error) {
+	imageName = c.upstreamImageName(imageName)
+	scope := "repository:" + imageName + ":pull"
+	requestURL := c.baseURL + fmt.Sprintf(path, imageName)
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, requestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		return req, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := upstreamTokens.get(c.tokenKey(scope)); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	scheme, params := parseAuthChallenge(challenge)
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case "bearer":
+		if params["scope"] == "" {
+			params["scope"] = scope
+		}
+		token, err := c.fetchToken(params)
+		if err != nil {
+			return nil, err
+		}
+		upstreamTokens.set(c.tokenKey(scope), token)
+		req.Header.Set("Authorization", "Bearer "+token.value)
+	case "basic":
+		if c.username == "" {
+			return nil, i18n.Errorf("удаленный реестр требует аутентификацию, но учетные данные не указаны")
+		}
+		req.SetBasicAuth(c.username, c.password)
+	default:
+		return nil, i18n.Errorf("неподдерживаемая схема аутентификации удаленного реестра: %q", challenge)
+	}
+
+	return c.http.Do(req)
+}
+
+func (c *upstreamClient) tokenKey(scope string) string {
+	return c.baseURL + "|" + c.username + "|" + scope
+}
+
+// fetchToken получает токен по протоколу Docker Registry Token Authentication
+func (c *upstreamClient) fetchToken(params map[string]string) (upstreamToken, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return upstreamToken{}, i18n.Errorf("в Bearer challenge удаленного реестра не указан realm")
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return upstreamToken{}, i18n.Errorf("неверный realm в Bearer challenge: %w", err)
+	}
+	query := tokenURL.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	for _, scope := range strings.Fields(params["scope"]) {
+		query.Add("scope", scope)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return upstreamToken{}, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return upstreamToken{}, i18n.Errorf("ошибка получения токена удаленного реестра: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return upstreamToken{}, i18n.Errorf("ошибка получения токена удаленного реестра, код ответа: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Token       string    `json:"token"`
+		AccessToken string    `json:"access_token"`
+		ExpiresIn   int       `json:"expires_in"`
+		IssuedAt    time.Time `json:"issued_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return upstreamToken{}, i18n.Errorf("ошибка декодирования токена удаленного реестра: %w", err)
+	}
+
+	token := upstreamToken{value: body.Token}
+	if token.value == "" {
+		token.value = body.AccessToken
+	}
+	if token.value == "" {
+		return upstreamToken{}, i18n.Errorf("сервис авторизации удаленного реестра не вернул токен")
+	}
+
+	// по спецификации токен без expires_in живет 60 секунд
+	expiresIn := body.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = 60
+	}
+	issuedAt := body.IssuedAt
+	if issuedAt.IsZero() || issuedAt.After(time.Now()) {
+		issuedAt = time.Now()
+	}
+	token.expiresAt = issuedAt.Add(time.Duration(expiresIn) * time.Second)
+	return token, nil
+}
+
+// parseAuthChallenge разбирает заголовок WWW-Authenticate вида
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"
+func parseAuthChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+	header = strings.TrimSpace(header)
+
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		return strings.ToLower(header), params
+	}
+	scheme := strings.ToLower(header[:i])
+	rest := header[i+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\"`, `"`)
+			rest = rest[min(end+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+type upstreamToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// tokenCache хранит токены удаленных реестров по scope до истечения их срока действия
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]upstreamToken
+}
+
+var upstreamTokens = &tokenCache{tokens: make(map[string]upstreamToken)}
+
+func (t *tokenCache) get(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	token, ok := t.tokens[key]
+	// запас в 10 секунд, чтобы токен не истек в процессе запроса
+	if !ok || time.Now().Add(10*time.Second).After(token.expiresAt) {
+		delete(t.tokens, key)
+		return "", false
+	}
+	return token.value, true
+}
+
+func (t *tokenCache) set(key string, token upstreamToken) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens[key] = token
+}
+
+// manifestDigest запрашивает у upstream только digest манифеста (HEAD)
+func (c *upstreamClient) manifestDigest(imageName, reference string) (string, error) {
+	resp, err := c.do(http.MethodHead, imageName, "/v2/%s/manifests/"+reference, manifestAcceptTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", i18n.Errorf("код ответа: %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// checkBlob проверяет, что blob есть в upstream (HEAD), не скачивая его
+func (c *upstreamClient) checkBlob(imageName, digest string) error {
+	resp, err := c.do(http.MethodHead, imageName, "/v2/%s/blobs/"+digest, nil)
+	if err != nil {
+		return i18n.Errorf("ошибка получения blob %s: %w", digest, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return i18n.Errorf("%w: %s", ErrBlobUnknown, digest)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return i18n.Errorf("ошибка получения blob %s, код ответа: %d", digest, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *upstreamClient) fetchManifest(imageName, reference string) ([]byte, string, error) {
+	resp, err := c.do(http.MethodGet, imageName, "/v2/%s/manifests/"+reference, manifestAcceptTypes)
+	if err != nil {
+		return nil, "", i18n.Errorf("ошибка получения манифеста: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", i18n.Errorf("%w: %s:%s", ErrManifestUnknown, imageName, reference)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", i18n.Errorf("ошибка получения манифеста, код ответа: %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, "", i18n.Errorf("ошибка чтения манифеста: %w", err)
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = strings.TrimSpace(mediaType[:i])
+	}
+	if mediaType == "" || mediaType == "application/json" || mediaType == "text/plain" {
+		mediaType = DetectManifestMediaType(content)
+	}
+
+	if mediaType == MediaTypeDockerManifestV1 {
+		return nil, "", i18n.Errorf("%w: upstream вернул устаревший манифест schema1", ErrManifestInvalid)
+	}
+
+	return content, mediaType, nil
+}
+
+// fetchBlob скачивает blob из upstream в общее хранилище, если его там еще нет.
+// Содержимое проверяется по digest до того, как blob станет доступен клиентам.
+func (s *DockerService) fetchBlob(client *upstreamClient, imageName, digest string) error {
+	digestHex, err := ParseDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	if blobStore.Exists(digestHex) {
+		return nil
+	}
+
+	_, err, _ = proxyFetches.Do("blob/"+digestHex, func() (interface{}, error) {
+		if blobStore.Exists(digestHex) {
+			return nil, nil
+		}
+
+		resp, err := client.do(http.MethodGet, imageName, "/v2/%s/blobs/"+digest, nil)
+		if err != nil {
+			return nil, i18n.Errorf("ошибка получения blob %s: %w", digest, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, i18n.Errorf("%w: %s", ErrBlobUnknown, digest)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, i18n.Errorf("ошибка получения blob %s, код ответа: %d", digest, resp.StatusCode)
+		}
+
+		tempFile, err := os.CreateTemp(config.Config.TempStorage, "docker-blob-")
+		if err != nil {
+			return nil, i18n.Errorf("ошибка создания временного файла: %w", err)
+		}
+		tempPath := tempFile.Name()
+
+		hasher := sha256.New()
+		size, err := io.Copy(io.MultiWriter(tempFile, hasher), resp.Body)
+		tempFile.Close()
+		if err != nil {
+			os.Remove(tempPath)
+			return nil, i18n.Errorf("ошибка записи blob %s: %w", digest, err)
+		}
+
+		if actualHex := hex.EncodeToString(hasher.Sum(nil)); actualHex != digestHex {
+			os.Remove(tempPath)
+			metrics.UpstreamError(FormatDocker, client.repository)
+			return nil, i18n.Errorf("%w: upstream вернул sha256:%s вместо %s", ErrDigestInvalid, actualHex, digest)
+		}
+
+		if err := blobStore.Commit(tempPath, digestHex); err != nil {
+			os.Remove(tempPath)
+			return nil, err
+		}
+
+		i18n.Logf("Blob %s (%d байт) получен из удаленного репозитория", digest, size)
+		return nil, nil
+	})
+	return err
+}
+
+// FetchBlobFromProxy докачивает отсутствующий в кеше blob прокси-репозитория
+func (s *DockerService) FetchBlobFromProxy(ctx context.Context, repoName, imageName, digest string) error {
+	repo, err := s.getRegistryRepository(ctx, repoName, ActionRead)
+	if err != nil {
+		return err
+	}
+
+	if repo.Type != models.TypeProxy || repo.URL == "" {
+		return i18n.Errorf("%w: %s", ErrBlobUnknown, digest)
+	}
+	if err := maintenance.check(); err != nil {
+		return err
+	}
+
+	client := newUpstreamClient(repo)
+	digestHex, err := ParseDigest(digest)
+	if err != nil {
+		return err
+	}
+	// blob уже скачан другим репозиторием: upstream должен подтвердить, что он у него есть
+	if blobStore.Exists(digestHex) {
+		err = client.checkBlob(imageName, digest)
+	} else {
+		err = s.fetchBlob(client, imageName, digest)
+	}
+	if err != nil {
+		return err
+	}
+	return cacheBlob(repo, imageName, digestHex)
+}
+
+// cacheBlob записывает полученный из upstream blob за прокси-репозиторием так же, как
+// загруженный или смонтированный blob, и увеличивает его счетчик ссылок: следующие запросы
+// отдаются из кеша без обращения к upstream, а сборщик мусора не удаляет blob
+func cacheBlob(repo *models.DockerRepository, imageName, digestHex string) error {
+	size, err := blobStore.Stat(digestHex)
+	if err != nil {
+		return i18n.Errorf("ошибка получения размера blob: %w", err)
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&models.DockerUpload{}).
+			Where("repository_id = ? AND digest = ? AND cached", repo.ID, "sha256:"+digestHex).
+			Count(&count).Error
+		if err != nil {
+			return i18n.Errorf("ошибка получения сессий загрузки: %w", err)
+		}
+		if count > 0 {
+			return nil
+		}
+
+		upload := models.DockerUpload{
+			ID:           newUUID(),
+			RepositoryID: repo.ID,
+			Name:         imageName,
+			Size:         size,
+			Digest:       "sha256:" + digestHex,
+			Cached:       true,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		if err := tx.Create(&upload).Error; err != nil {
+			return i18n.Errorf("ошибка сохранения сессии загрузки: %w", err)
+		}
+		return blobStore.Retain(tx, digestHex, size)
+	})
+}
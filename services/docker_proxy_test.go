@@ -0,0 +1,86 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAuthChallenge(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantScheme string
+		wantParams map[string]string
+	}{
+		{
+			name:       "docker hub",
+			header:     `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`,
+			wantScheme: "bearer",
+			wantParams: map[string]string{
+				"realm":   "https://auth.docker.io/token",
+				"service": "registry.docker.io",
+				"scope":   "repository:library/nginx:pull",
+			},
+		},
+		{
+			name:       "basic",
+			header:     `Basic realm="Registry"`,
+			wantScheme: "basic",
+			wantParams: map[string]string{"realm": "Registry"},
+		},
+		{
+			name:       "scheme only",
+			header:     "Bearer",
+			wantScheme: "bearer",
+			wantParams: map[string]string{},
+		},
+		{
+			name:       "spaces and case",
+			header:     `  BEARER Realm="https://auth.example.com/token" , Service="example"  `,
+			wantScheme: "bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "service": "example"},
+		},
+		{
+			name:       "unquoted values",
+			header:     `Bearer realm=https://auth.example.com/token,service=example`,
+			wantScheme: "bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "service": "example"},
+		},
+		{
+			name:       "comma in quoted value",
+			header:     `Bearer realm="https://auth.example.com/token",scope="repository:app:pull,push"`,
+			wantScheme: "bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "scope": "repository:app:pull,push"},
+		},
+		{
+			name:       "escaped quote",
+			header:     `Bearer realm="https://auth.example.com/token",error="say \"hi\""`,
+			wantScheme: "bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "error": `say "hi"`},
+		},
+		{
+			name:       "unterminated quote",
+			header:     `Bearer realm="https://auth.example.com/token`,
+			wantScheme: "bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token"},
+		},
+		{
+			name:       "parameter without value",
+			header:     `Bearer realm="https://auth.example.com/token",broken`,
+			wantScheme: "bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, params := parseAuthChallenge(tt.header)
+			if scheme != tt.wantScheme {
+				t.Errorf("parseAuthChallenge(%q) scheme = %q, want %q", tt.header, scheme, tt.wantScheme)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("parseAuthChallenge(%q) params = %v, want %v", tt.header, params, tt.wantParams)
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"gorm.io/gorm"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MediaTypeDockerManifestV1   = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+var (
+	ErrNameUnknown     = newError(ErrNotFound, "NAME_UNKNOWN", "репозиторий не найден")
+	ErrManifestUnknown = newError(ErrNotFound, "MANIFEST_UNKNOWN", "манифест не найден")
+	ErrBlobUnknown     = newError(ErrNotFound, "BLOB_UNKNOWN", "blob не найден")
+	ErrDigestInvalid   = newError(ErrInvalid, "DIGEST_INVALID", "неверный формат digest")
+
+	ErrManifestInvalid     = newError(ErrInvalid, "MANIFEST_INVALID", "неверный манифест")
+	ErrManifestBlobUnknown = newError(ErrInvalid, "MANIFEST_BLOB_UNKNOWN", "манифест ссылается на отсутствующий blob")
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:([a-f0-9]{64})$`)
+
+// ManifestContent - манифест в том виде, в котором он был загружен (байт в байт),
+// иначе digest не совпадет с тем, что ожидает клиент.
+type ManifestContent struct {
+	Digest    string
+	MediaType string
+	Content   []byte
+
+	download downloadEvent
+}
+
+// BlobContent - слой или конфигурация образа в общем хранилище
+type BlobContent struct {
+	Key  string
+	Size int64
+
+	download downloadEvent
+}
+
+// TrackDownload учитывает скачивание манифеста. Вызывается только для GET: HEAD-запросы,
+// которыми клиенты проверяют наличие манифеста, скачиванием не считаются.
+func (m *ManifestContent) TrackDownload() {
+	trackDownload(m.download)
+}
+
+// TrackDownload учитывает отдачу blob-а в объеме и времени доступа к образам, которым он принадлежит
+func (b *BlobContent) TrackDownload() {
+	trackDownload(b.download)
+}
+
+type manifestDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// imageManifest покрывает schema2, OCI манифест и списки манифестов (manifest list / OCI index)
+type imageManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Config        manifestDescriptor   `json:"config"`
+	Layers        []manifestDescriptor `json:"layers,omitempty"`
+	Manifests     []manifestDescriptor `json:"manifests,omitempty"`
+}
+
+func isManifestList(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// ParseDigest проверяет digest вида sha256:<hex> и возвращает hex-часть
+func ParseDigest(digest string) (string, error) {
+	match := digestRegexp.FindStringSubmatch(digest)
+	if match == nil {
+		return "", i18n.Errorf("%w: %s", ErrDigestInvalid, digest)
+	}
+	return match[1], nil
+}
+
+func isDigest(reference string) bool {
+	return strings.HasPrefix(reference, "sha256:")
+}
+
+// DetectManifestMediaType определяет тип манифеста по его содержимому,
+// если клиент или upstream не передали Content-Type
+func DetectManifestMediaType(content []byte) string {
+	var probe struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		Manifests     []json.RawMessage `json:"manifests"`
+		Config        json.RawMessage   `json:"config"`
+	}
+	if err := json.Unmarshal(content, &probe); err != nil {
+		return ""
+	}
+
+	switch {
+	case probe.MediaType != "":
+		return probe.MediaType
+	case probe.SchemaVersion == 1:
+		return MediaTypeDockerManifestV1
+	case probe.Manifests != nil:
+		return MediaTypeOCIIndex
+	default:
+		return MediaTypeOCIManifest
+	}
+}
+
+// getRegistryRepository находит репозиторий и проверяет право action на него
+func (s *DockerService) getRegistryRepository(ctx context.Context, repoName, action string) (*models.DockerRepository, error) {
+	repo, err := s.getRepository(repoName)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return nil, i18n.Errorf("%w: %s", ErrNameUnknown, repoName)
+		}
+		return nil, err
+	}
+
+	if err := authorize(ctx, FormatDocker, &repo.BaseRepository, action); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (s *DockerService) findImage(repo *models.DockerRepository, imageName, reference string) (*models.DockerImage, error) {
+	query := db.DB.Where("repository_id = ? AND name = ? AND sha256 <> ''", repo.ID, imageName)
+	if isDigest(reference) {
+		digestHex, err := ParseDigest(reference)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("sha256 = ?", digestHex)
+	} else {
+		query = query.Where("tag = ?", reference)
+	}
+
+	var image models.DockerImage
+	if err := query.Order("updated_at DESC").First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, i18n.Errorf("%w: %s:%s", ErrManifestUnknown, imageName, reference)
+		}
+		return nil, i18n.Errorf("ошибка поиска манифеста: %w", err)
+	}
+	return &image, nil
+}
+
+// GetManifest возвращает манифест образа по тегу или digest
+func (s *DockerService) GetManifest(ctx context.Context, repoName, imageName, reference string) (*ManifestContent, error) {
+	repo, err := s.getRegistryRepository(ctx, repoName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	var image *models.DockerImage
+	switch repo.Type {
+	case models.TypeGroup:
+		return s.getGroupManifest(ctx, repo, imageName, reference)
+	case models.TypeProxy:
+		image, err = s.FetchImageFromProxy(ctx, repoName, imageName, reference)
+	default:
+		image, err = s.findImage(repo, imageName, reference)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := blobStore.ReadAll(image.SHA256)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, i18n.Errorf("%w: %s:%s", ErrManifestUnknown, imageName, reference)
+		}
+		return nil, i18n.Errorf("ошибка чтения манифеста: %w", err)
+	}
+
+	mediaType := image.MediaType
+	if mediaType == "" {
+		mediaType = DetectManifestMediaType(content)
+	}
+
+	return &ManifestContent{
+		Digest:    "sha256:" + image.SHA256,
+		MediaType: mediaType,
+		Content:   content,
+		download: downloadEvent{
+			repoType:     FormatDocker,
+			repositoryID: repo.ID,
+			artifactID:   image.ID,
+			name:         image.Name,
+			version:      image.Version,
+			bytes:        int64(len(content)),
+		},
+	}, nil
+}
+
+// GetBlob возвращает файл слоя или конфигурации образа в общем хранилище
+func (s *DockerService) GetBlob(ctx context.Context, repoName, imageName, digest string) (*BlobContent, error) {
+	repo, err := s.getRegistryRepository(ctx, repoName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	digestHex, err := ParseDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.Type == models.TypeGroup {
+		return s.getGroupBlob(ctx, repo, imageName, digest)
+	}
+
+	linked, err := repositoryHasBlob(repo.ID, digestHex)
+	if err != nil {
+		return nil, err
+	}
+	if !linked {
+		if repo.Type != models.TypeProxy {
+			return nil, i18n.Errorf("%w: %s", ErrBlobUnknown, digest)
+		}
+		metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheMiss)
+		if err := s.FetchBlobFromProxy(ctx, repoName, imageName, digest); err != nil {
+			return nil, err
+		}
+	} else if repo.Type == models.TypeProxy {
+		metrics.ProxyCache(FormatDocker, repo.Name, metrics.CacheHit)
+	}
+
+	size, err := blobStore.Stat(digestHex)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, i18n.Errorf("%w: %s", ErrBlobUnknown, digest)
+		}
+		return nil, i18n.Errorf("ошибка чтения blob: %w", err)
+	}
+
+	return &BlobContent{
+		Key:  blobStore.Key(digestHex),
+		Size: size,
+		download: downloadEvent{
+			repoType:     FormatDocker,
+			repositoryID: repo.ID,
+			name:         imageName,
+			digest:       digest,
+			bytes:        size,
+		},
+	}, nil
+}
+
+// repositoryHasBlob сообщает, что blob принадлежит репозиторию: на него ссылается образ
+// репозитория или blob загружен (смонтирован) в репозиторий и ждет манифеста. Blob-ы общего
+// хранилища без такой связи репозиторию не отдаются, иначе по digest можно было бы получить
+// слои репозитория, к которому у пользователя нет доступа.
+func repositoryHasBlob(repoID int, digestHex string) (bool, error) {
+	var count int64
+	err := db.DB.Model(&models.StoredFile{}).
+		Joins("JOIN docker_images ON docker_images.id = stored_files.artifact_id").
+		Where("stored_files.repo_type = ? AND stored_files.sha256 = ? AND docker_images.repository_id = ?",
+			FormatDocker, digestHex, repoID).
+		Count(&count).Error
+	if err != nil {
+		return false, i18n.Errorf("ошибка проверки связи blob с репозиторием: %w", err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	err = db.DB.Model(&models.DockerUpload{}).
+		Where("repository_id = ? AND digest = ?", repoID, "sha256:"+digestHex).
+		Count(&count).Error
+	if err != nil {
+		return false, i18n.Errorf("ошибка проверки связи blob с репозиторием: %w", err)
+	}
+	return count > 0, nil
+}
+
+// manifestBlobKnown проверяет blob, на который ссылается сохраняемый манифест. Манифесты
+// прокси-репозитория получены из upstream вместе с blob-ами, в остальные репозитории
+// манифест может сослаться только на blob-ы самого репозитория.
+func manifestBlobKnown(repo *models.DockerRepository, digestHex string) (bool, error) {
+	if !blobStore.Exists(digestHex) {
+		return false, nil
+	}
+	if repo.Type == models.TypeProxy {
+		return true, nil
+	}
+	return repositoryHasBlob(repo.ID, digestHex)
+}
+
+// ListTags возвращает отсортированный список тегов образа
+func (s *DockerService) ListTags(ctx context.Context, repoName, imageName string) ([]string, error) {
+	repo, err := s.getRegistryRepository(ctx, repoName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.Type == models.TypeGroup {
+		return s.listGroupTags(ctx, repo, imageName)
+	}
+
+	var tags []string
+	err = db.DB.Model(&models.DockerImage{}).
+		Where("repository_id = ? AND name = ? AND tag <> '' AND sha256 <> ''", repo.ID, imageName).
+		Distinct().
+		Pluck("tag", &tags).Error
+	if err != nil {
+		return nil, i18n.Errorf("ошибка получения списка тегов: %w", err)
+	}
+
+	if len(tags) == 0 {
+		return nil, i18n.Errorf("%w: %s/%s", ErrNameUnknown, repoName, imageName)
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Catalog возвращает список образов в доступных пользователю Docker репозиториях
+// в формате <репозиторий>/<образ>
+func (s *DockerService) Catalog(ctx context.Context) ([]string, error) {
+	repos, err := s.ListRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repoIDs := make([]int, 0, len(repos))
+	for _, repo := range repos {
+		repoIDs = append(repoIDs, repo.ID)
+	}
+	if len(repoIDs) == 0 {
+		return []string{}, nil
+	}
+
+	var rows []struct {
+		RepoName  string
+		ImageName string
+	}
+	err = db.DB.Model(&models.DockerImage{}).
+		Select("DISTINCT docker_repositories.name AS repo_name, docker_images.name AS image_name").
+		Joins("JOIN docker_repositories ON docker_repositories.id = docker_images.repository_id").
+		Where("docker_images.sha256 <> '' AND docker_images.repository_id IN ?", repoIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, i18n.Errorf("ошибка получения каталога: %w", err)
+	}
+
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, row.RepoName+"/"+row.ImageName)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// PutManifest сохраняет манифест, загруженный клиентом, и привязывает его к тегу.
+// Все blob-ы, на которые ссылается манифест, должны быть загружены заранее.
+func (s *DockerService) PutManifest(ctx context.Context, repoName, imageName, reference, mediaType string, content []byte) (string, error) {
+	repo, err := s.getWritableRepository(ctx, repoName)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := s.storeManifest(repo, imageName, reference, mediaType, content)
+	if err != nil {
+		return "", err
+	}
+
+	i18n.Logf("Сохранен манифест %s:%s (%s) в репозиторий %s", imageName, reference, digest, repoName)
+	return digest, nil
+}
+
+// storeManifest проверяет манифест, сохраняет его в общее хранилище blob-ов и
+// записывает DockerImage вместе со ссылками на манифест, config и слои
+func (s *DockerService) storeManifest(repo *models.DockerRepository, imageName, reference, mediaType string, content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	digestHex := hex.EncodeToString(sum[:])
+	digest := "sha256:" + digestHex
+
+	if isDigest(reference) && reference != digest {
+		return "", i18n.Errorf("%w: ожидался %s, получен %s", ErrDigestInvalid, reference, digest)
+	}
+
+	var manifest imageManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return "", i18n.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
+
+	if mediaType == "" || mediaType == "application/json" {
+		mediaType = DetectManifestMediaType(content)
+	}
+
+	if manifest.SchemaVersion != 2 {
+		return "", i18n.Errorf("%w: поддерживается только schemaVersion 2", ErrManifestInvalid)
+	}
+
+	size := int64(len(content))
+	links := []BlobLink{{FileName: "manifest", Hex: digestHex, Size: size}}
+	var layers []string
+
+	if isManifestList(mediaType) {
+		for _, child := range manifest.Manifests {
+			childHex, err := ParseDigest(child.Digest)
+			if err != nil {
+				return "", err
+			}
+			known, err := manifestBlobKnown(repo, childHex)
+			if err != nil {
+				return "", err
+			}
+			if !known {
+				return "", i18n.Errorf("%w: %s", ErrManifestBlobUnknown, child.Digest)
+			}
+			links = append(links, BlobLink{FileName: "manifest", Hex: childHex, Size: child.Size})
+		}
+	} else {
+		if manifest.Config.Digest == "" {
+			return "", i18n.Errorf("%w: отсутствует config", ErrManifestInvalid)
+		}
+
+		for i, descriptor := range append([]manifestDescriptor{manifest.Config}, manifest.Layers...) {
+			blobHex, err := ParseDigest(descriptor.Digest)
+			if err != nil {
+				return "", err
+			}
+			known, err := manifestBlobKnown(repo, blobHex)
+			if err != nil {
+				return "", err
+			}
+			if !known {
+				return "", i18n.Errorf("%w: %s", ErrManifestBlobUnknown, descriptor.Digest)
+			}
+
+			fileName := "layer"
+			if i == 0 {
+				fileName = "config"
+			} else {
+				layers = append(layers, descriptor.Digest)
+			}
+			links = append(links, BlobLink{FileName: fileName, Hex: blobHex, Size: descriptor.Size})
+			size += descriptor.Size
+		}
+	}
+
+	if err := blobStore.WriteBytes(digestHex, content); err != nil {
+		return "", i18n.Errorf("ошибка записи манифеста: %w", err)
+	}
+
+	tag := ""
+	if !isDigest(reference) {
+		tag = reference
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var image models.DockerImage
+		query := tx.Where("repository_id = ? AND name = ?", repo.ID, imageName)
+		if tag != "" {
+			query = query.Where("tag = ?", tag)
+		} else {
+			query = query.Where("sha256 = ?", digestHex)
+		}
+		err := query.First(&image).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return i18n.Errorf("ошибка поиска образа: %w", err)
+		}
+
+		if image.ID != 0 {
+			if err := blobStore.Unlink(tx, image.ID, "docker"); err != nil {
+				return err
+			}
+		} else {
+			image.CreatedAt = time.Now()
+		}
+
+		image.RepositoryID = repo.ID
+		image.RepoType = "docker"
+		image.Name = imageName
+		image.Version = reference
+		image.Path = blobStore.Key(digestHex)
+		image.Size = size
+		image.SHA256 = digestHex
+		image.UpdatedAt = time.Now()
+		image.Tag = tag
+		image.MediaType = mediaType
+		image.Manifest = content
+		image.Layers = layers
+
+		if err := tx.Save(&image).Error; err != nil {
+			return i18n.Errorf("ошибка сохранения записи образа: %w", err)
+		}
+
+		return blobStore.Link(tx, image.ID, "docker", links)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDigest(t *testing.T) {
+	hex := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name    string
+		digest  string
+		want    string
+		wantErr bool
+	}{
+		{name: "sha256", digest: "sha256:" + hex, want: hex},
+		{name: "empty", digest: "", wantErr: true},
+		{name: "no algorithm", digest: hex, wantErr: true},
+		{name: "other algorithm", digest: "sha512:" + hex, wantErr: true},
+		{name: "uppercase hex", digest: "sha256:" + strings.ToUpper(hex), wantErr: true},
+		{name: "short hex", digest: "sha256:" + hex[:63], wantErr: true},
+		{name: "long hex", digest: "sha256:" + hex + "0", wantErr: true},
+		{name: "not hex", digest: "sha256:" + strings.Repeat("zz", 32), wantErr: true},
+		{name: "path traversal", digest: "sha256:../" + hex[:61], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDigest(tt.digest)
+			if tt.wantErr {
+				if !errors.Is(err, ErrDigestInvalid) {
+					t.Fatalf("ParseDigest(%q) error = %v, want ErrDigestInvalid", tt.digest, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDigest(%q) error = %v", tt.digest, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDigest(%q) = %q, want %q", tt.digest, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBlobUploadUnknown = newError(ErrNotFound, "BLOB_UPLOAD_UNKNOWN", "сессия загрузки не найдена")
+	ErrBlobUploadInvalid = newError(ErrInvalid, "BLOB_UPLOAD_INVALID", "неверный диапазон загрузки")
+	ErrDenied            = newError(ErrForbidden, "DENIED", "операция запрещена для этого репозитория")
+)
+
+func (s *DockerService) getWritableRepository(ctx context.Context, repoName string) (*models.DockerRepository, error) {
+	repo, err := s.getRegistryRepository(ctx, repoName, ActionWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.Type != models.TypeHosted {
+		return nil, i18n.Errorf("%w: загружать образы можно только в хостовый репозиторий", ErrDenied)
+	}
+	return repo, nil
+}
+
+// StartUpload открывает новую сессию загрузки blob
+func (s *DockerService) StartUpload(ctx context.Context, repoName, imageName string) (*models.DockerUpload, error) {
+	repo, err := s.getWritableRepository(ctx, repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadsDir := filepath.Join(config.Config.TempStorage, "uploads")
+	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+		return nil, i18n.Errorf("ошибка создания директории загрузок: %w", err)
+	}
+
+	id := newUUID()
+	uploadPath := filepath.Join(uploadsDir, id)
+	uploadFile, err := os.Create(uploadPath)
+	if err != nil {
+		return nil, i18n.Errorf("ошибка создания файла загрузки: %w", err)
+	}
+	uploadFile.Close()
+
+	upload := models.DockerUpload{
+		ID:           id,
+		RepositoryID: repo.ID,
+		Name:         imageName,
+		Path:         uploadPath,
+		Size:         0,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if err := db.DB.Create(&upload).Error; err != nil {
+		os.Remove(uploadPath)
+		return nil, i18n.Errorf("ошибка сохранения сессии загрузки: %w", err)
+	}
+
+	return &upload, nil
+}
+
+// GetUpload возвращает сессию загрузки, принадлежащую образу
+func (s *DockerService) GetUpload(ctx context.Context, repoName, imageName, uploadID string) (*models.DockerUpload, error) {
+	repo, err := s.getRegistryRepository(ctx, repoName, ActionWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	var upload models.DockerUpload
+	err = db.DB.Where("id = ? AND repository_id = ? AND name = ? AND digest = ''", uploadID, repo.ID, imageName).First(&upload).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, i18n.Errorf("%w: %s", ErrBlobUploadUnknown, uploadID)
+		}
+		return nil, i18n.Errorf("ошибка получения сессии загрузки: %w", err)
+	}
+	return &upload, nil
+}
+
+// AppendUpload дописывает очередной фрагмент в сессию загрузки.
+// offset - ожидаемое начало фрагмента из Content-Range, -1 если заголовок не передан
+func (s *DockerService) AppendUpload(ctx context.Context, repoName, imageName, uploadID string, offset int64, data io.Reader) (*models.DockerUpload, error) {
+	if _, err := s.getWritableRepository(ctx, repoName); err != nil {
+		return nil, err
+	}
+
+	upload, err := s.GetUpload(ctx, repoName, imageName, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset >= 0 && offset != upload.Size {
+		return upload, i18n.Errorf("%w: ожидалось начало %d, получено %d", ErrBlobUploadInvalid, upload.Size, offset)
+	}
+
+	uploadFile, err := os.OpenFile(upload.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, i18n.Errorf("ошибка открытия файла загрузки: %w", err)
+	}
+	defer uploadFile.Close()
+
+	written, err := io.Copy(uploadFile, data)
+	upload.Size += written
+	upload.UpdatedAt = time.Now()
+	if saveErr := db.DB.Save(upload).Error; saveErr != nil {
+		return nil, i18n.Errorf("ошибка обновления сессии загрузки: %w", saveErr)
+	}
+	if err != nil {
+		return upload, i18n.Errorf("ошибка записи данных загрузки: %w", err)
+	}
+
+	return upload, nil
+}
+
+// CompleteUpload дописывает последний фрагмент, сверяет digest и переносит blob в хранилище
+func (s *DockerService) CompleteUpload(ctx context.Context, repoName, imageName, uploadID, digest string, data io.Reader) error {
+	expectedHex, err := ParseDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	upload, err := s.AppendUpload(ctx, repoName, imageName, uploadID, -1, data)
+	if err != nil {
+		return err
+	}
+
+	actualHex, err := hashFile(upload.Path)
+	if err != nil {
+		return i18n.Errorf("ошибка вычисления digest: %w", err)
+	}
+
+	if actualHex != expectedHex {
+		s.removeUpload(upload)
+		return i18n.Errorf("%w: ожидался %s, получен sha256:%s", ErrDigestInvalid, digest, actualHex)
+	}
+
+	if err := blobStore.Commit(upload.Path, actualHex); err != nil {
+		return err
+	}
+
+	upload.Digest = "sha256:" + actualHex
+	if err := db.DB.Model(upload).Updates(map[string]interface{}{
+		"digest":     upload.Digest,
+		"path":       "",
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return i18n.Errorf("ошибка сохранения сессии загрузки: %w", err)
+	}
+	i18n.Logf("Загружен blob %s для образа %s в репозиторий %s", digest, imageName, repoName)
+	return nil
+}
+
+// PutBlob загружает blob целиком одним запросом (монолитная загрузка)
+func (s *DockerService) PutBlob(ctx context.Context, repoName, imageName, digest string, data io.Reader) error {
+	upload, err := s.StartUpload(ctx, repoName, imageName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.CompleteUpload(ctx, repoName, imageName, upload.ID, digest, data); err != nil {
+		s.removeUpload(upload)
+		return err
+	}
+	return nil
+}
+
+// MountBlob привязывает к репозиторию blob другого репозитория, чтобы клиент мог не загружать
+// его повторно (cross-repository blob mount). from - образ-источник в виде <репозиторий>/<образ>,
+// на его репозиторий у пользователя должно быть право чтения, а blob должен принадлежать ему.
+// Иначе возвращается false, и клиент загружает blob сам.
+func (s *DockerService) MountBlob(ctx context.Context, repoName, imageName, digest, from string) (bool, error) {
+	repo, err := s.getWritableRepository(ctx, repoName)
+	if err != nil {
+		return false, err
+	}
+
+	digestHex, err := ParseDigest(digest)
+	if err != nil {
+		return false, err
+	}
+
+	fromName, _, _ := strings.Cut(from, "/")
+	if fromName == "" {
+		return false, nil
+	}
+	fromRepo, err := s.getRegistryRepository(ctx, fromName, ActionRead)
+	if err != nil || fromRepo.Type == models.TypeGroup {
+		return false, nil
+	}
+	linked, err := repositoryHasBlob(fromRepo.ID, digestHex)
+	if err != nil {
+		return false, err
+	}
+	size, err := blobStore.Stat(digestHex)
+	if !linked || err != nil {
+		return false, nil
+	}
+
+	upload := models.DockerUpload{
+		ID:           newUUID(),
+		RepositoryID: repo.ID,
+		Name:         imageName,
+		Size:         size,
+		Digest:       "sha256:" + digestHex,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := db.DB.Create(&upload).Error; err != nil {
+		return false, i18n.Errorf("ошибка сохранения сессии загрузки: %w", err)
+	}
+	return true, nil
+}
+
+// CancelUpload отменяет сессию загрузки и удаляет загруженные данные
+func (s *DockerService) CancelUpload(ctx context.Context, repoName, imageName, uploadID string) error {
+	upload, err := s.GetUpload(ctx, repoName, imageName, uploadID)
+	if err != nil {
+		return err
+	}
+
+	s.removeUpload(upload)
+	return nil
+}
+
+func (s *DockerService) removeUpload(upload *models.DockerUpload) {
+	os.Remove(upload.Path)
+	if err := db.DB.Delete(upload).Error; err != nil {
+		i18n.Logf("Ошибка удаления сессии загрузки %s: %v", upload.ID, err)
+	}
+}
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	downloadQueueSize     = 10000
+	downloadFlushInterval = 5 * time.Second
+)
+
+// downloadEvent - скачивание артефакта. У blob-а образа docker artifactID не известен,
+// образы, которым принадлежит blob, определяются по digest при записи в базу
+type downloadEvent struct {
+	repoType     string
+	repositoryID int
+	artifactID   int
+	name         string
+	version      string
+	digest       string
+	bytes        int64
+	at           time.Time
+}
+
+// downloadKey - строка суточной статистики, в которую попадает скачивание
+type downloadKey struct {
+	repoType     string
+	repositoryID int
+	artifactID   int
+	name         string
+	version      string
+	digest       string
+	day          time.Time
+}
+
+type downloadTotals struct {
+	downloads int64
+	bytes     int64
+	last      time.Time
+}
+
+var (
+	downloadEvents   = make(chan downloadEvent, downloadQueueSize)
+	droppedDownloads atomic.Int64
+)
+
+// trackDownload ставит скачивание в очередь учета без обращения к базе. При переполненной
+// очереди событие отбрасывается: учет не должен задерживать отдачу артефактов.
+func trackDownload(event downloadEvent) {
+	event.at = time.Now()
+	select {
+	case downloadEvents <- event:
+	default:
+		droppedDownloads.Add(1)
+	}
+}
+
+// StartDownloadTracking запускает запись накопленных скачиваний в базу раз в downloadFlushInterval
+func StartDownloadTracking(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(downloadFlushInterval)
+		defer ticker.Stop()
+
+		batch := make(map[downloadKey]*downloadTotals)
+		for {
+			select {
+			case <-ctx.Done():
+				flushDownloads(batch)
+				return
+			case event := <-downloadEvents:
+				addDownload(batch, event)
+			case <-ticker.C:
+				flushDownloads(batch)
+				batch = make(map[downloadKey]*downloadTotals)
+			}
+		}
+	}()
+
+	i18n.Logf("Учет скачиваний запущен")
+}
+
+func addDownload(batch map[downloadKey]*downloadTotals, event downloadEvent) {
+	at := event.at.UTC()
+	key := downloadKey{
+		repoType:     event.repoType,
+		repositoryID: event.repositoryID,
+		artifactID:   event.artifactID,
+		name:         event.name,
+		version:      event.version,
+		digest:       event.digest,
+		day:          time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC),
+	}
+
+	totals, ok := batch[key]
+	if !ok {
+		totals = &downloadTotals{}
+		batch[key] = totals
+	}
+	// blob-ы образа учитываются только в объеме и времени доступа: образ скачивается
+	// вместе со всеми своими слоями, и число скачиваний считается по манифесту
+	if event.digest == "" {
+		totals.downloads++
+	}
+	totals.bytes += event.bytes
+	totals.last = event.at
+}
+
+func flushDownloads(batch map[downloadKey]*downloadTotals) {
+	if dropped := droppedDownloads.Swap(0); dropped > 0 {
+		i18n.Logf("Очередь учета скачиваний переполнена, пропущено скачиваний: %d", dropped)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	stats := make(map[downloadKey]*downloadTotals, len(batch))
+	for key, totals := range batch {
+		if key.artifactID == 0 && key.version != "" {
+			key.artifactID = findArtifactID(key.repoType, key.repositoryID, key.name, key.version)
+		}
+		if key.artifactID != 0 {
+			if err := updateArtifactDownloads(key.repoType, key.artifactID, totals); err != nil {
+				i18n.Logf("Ошибка учета скачивания %s %s:%s: %v", key.repoType, key.name, key.version, err)
+			}
+		}
+		if key.digest != "" {
+			if err := updateBlobAccess(key.repositoryID, key.name, key.digest, totals.last); err != nil {
+				i18n.Logf("Ошибка учета скачивания blob %s образа %s: %v", key.digest, key.name, err)
+			}
+		}
+		mergeDownloadStat(stats, key, totals)
+	}
+
+	for key, totals := range stats {
+		if err := upsertDownloadStat(key, totals); err != nil {
+			i18n.Logf("Ошибка записи статистики скачиваний %s %s:%s: %v", key.repoType, key.name, key.version, err)
+		}
+	}
+}
+
+// mergeDownloadStat добавляет итоги в строку суточной статистики. blob-ы одного образа
+// за сутки сводятся в одну строку без версии: digest в статистике не хранится.
+func mergeDownloadStat(stats map[downloadKey]*downloadTotals, key downloadKey, totals *downloadTotals) {
+	key.digest = ""
+	merged, ok := stats[key]
+	if !ok {
+		merged = &downloadTotals{}
+		stats[key] = merged
+	}
+	merged.downloads += totals.downloads
+	merged.bytes += totals.bytes
+	if totals.last.After(merged.last) {
+		merged.last = totals.last
+	}
+}
+
+// updateArtifactDownloads увеличивает счетчик скачиваний артефакта и запоминает время
+// последнего скачивания. updated_at не меняется: по нему считается срок жизни кеша прокси.
+func updateArtifactDownloads(repoType string, artifactID int, totals *downloadTotals) error {
+	model, err := artifactModel(repoType)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Model(model).Where("id = ?", artifactID).UpdateColumns(map[string]interface{}{
+		"download_count":     gorm.Expr("download_count + ?", totals.downloads),
+		"last_downloaded_at": totals.last,
+	}).Error
+}
+
+// findArtifactID находит артефакт по имени и версии, 0 - артефакт не найден
+func findArtifactID(repoType string, repositoryID int, name, version string) int {
+	model, err := artifactModel(repoType)
+	if err != nil {
+		return 0
+	}
+
+	var ids []int
+	err = db.DB.Model(model).Where("repository_id = ? AND name = ? AND version = ?", repositoryID, name, version).
+		Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0
+	}
+	return ids[0]
+}
+
+// updateBlobAccess обновляет время последнего скачивания образов, в которые входит blob
+func updateBlobAccess(repositoryID int, imageName, digest string, at time.Time) error {
+	digestHex, err := ParseDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	var images []models.DockerImage
+	err = db.DB.Select("id", "sha256", "layers", "manifest").
+		Where("repository_id = ? AND name = ?", repositoryID, imageName).
+		Find(&images).Error
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for _, image := range images {
+		if imageContainsBlob(&image, digest, digestHex) {
+			ids = append(ids, image.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return db.DB.Model(&models.DockerImage{}).Where("id IN ?", ids).
+		UpdateColumn("last_downloaded_at", at).Error
+}
+
+// imageContainsBlob проверяет, является ли blob манифестом, конфигурацией или слоем образа
+func imageContainsBlob(image *models.DockerImage, digest, digestHex string) bool {
+	if image.SHA256 == digestHex {
+		return true
+	}
+	for _, layer := range image.Layers {
+		if layer == digest {
+			return true
+		}
+	}
+
+	var manifest imageManifest
+	return json.Unmarshal(image.Manifest, &manifest) == nil && manifest.Config.Digest == digest
+}
+
+func upsertDownloadStat(key downloadKey, totals *downloadTotals) error {
+	stat := models.DownloadStat{
+		RepoType:         key.repoType,
+		RepositoryID:     key.repositoryID,
+		ArtifactID:       key.artifactID,
+		Name:             key.name,
+		Version:          key.version,
+		Day:              key.day,
+		Downloads:        totals.downloads,
+		Bytes:            totals.bytes,
+		LastDownloadedAt: totals.last,
+	}
+
+	return db.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "repo_type"}, {Name: "repository_id"}, {Name: "artifact_id"},
+			{Name: "name"}, {Name: "version"}, {Name: "day"},
+		},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "downloads"}, Value: gorm.Expr("download_stats.downloads + excluded.downloads")},
+			{Column: clause.Column{Name: "bytes"}, Value: gorm.Expr("download_stats.bytes + excluded.bytes")},
+			{Column: clause.Column{Name: "last_downloaded_at"}, Value: gorm.Expr("excluded.last_downloaded_at")},
+		},
+	}).Create(&stat).Error
+}
+
+func artifactModel(repoType string) (interface{}, error) {
+	switch repoType {
+	case FormatDocker:
+		return &models.DockerImage{}, nil
+	case FormatHelm:
+		return &models.HelmChart{}, nil
+	default:
+		return nil, i18n.Errorf("формат %s не хранит артефакты", repoType)
+	}
+}
+
+// DownloadDay - скачивания за сутки
+type DownloadDay struct {
+	Day       string `json:"day"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// ArtifactDownloads - статистика скачиваний версии артефакта за период. Для скачиваний
+// без версии (клонирование git, blob-ы образа) ArtifactID равен 0, а Version пуст
+type ArtifactDownloads struct {
+	ArtifactID       int           `json:"artifact_id"`
+	Name             string        `json:"name"`
+	Version          string        `json:"version"`
+	Downloads        int64         `json:"downloads"`
+	Bytes            int64         `json:"bytes"`
+	LastDownloadedAt time.Time     `json:"last_downloaded_at"`
+	Daily            []DownloadDay `json:"daily"`
+}
+
+// DownloadReport - статистика скачиваний репозитория за последние Days суток
+type DownloadReport struct {
+	RepoType   string              `json:"repo_type"`
+	Repository string              `json:"repository"`
+	Days       int                 `json:"days"`
+	Downloads  int64               `json:"downloads"`
+	Bytes      int64               `json:"bytes"`
+	Artifacts  []ArtifactDownloads `json:"artifacts"`
+}
+
+// DownloadFilter - выборка статистики скачиваний. Пустые Name и Version не ограничивают выборку
+type DownloadFilter struct {
+	RepoType   string
+	Repository string
+	Name       string
+	Version    string
+	Days       int
+}
+
+const defaultDownloadDays = 30
+
+var ErrDownloadFilterInvalid = newError(ErrInvalid, "DOWNLOAD_FILTER_INVALID", "недопустимые параметры статистики скачиваний")
+
+type DownloadService struct{}
+
+// GetStats возвращает статистику скачиваний артефактов репозитория по суткам.
+// Скачивания последних секунд появляются в статистике после очередной записи в базу.
+func (s *DownloadService) GetStats(ctx context.Context, filter DownloadFilter) (*DownloadReport, error) {
+	if _, err := repositoryModel(filter.RepoType); err != nil {
+		return nil, i18n.Errorf("%w: %v", ErrDownloadFilterInvalid, err)
+	}
+	if filter.Repository == "" {
+		return nil, i18n.Errorf("%w: не указан репозиторий", ErrDownloadFilterInvalid)
+	}
+
+	repo, err := scheduleRepository(ctx, filter.RepoType, filter.Repository, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	days := filter.Days
+	if days <= 0 {
+		days = defaultDownloadDays
+	}
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+
+	query := db.DB.Where("repo_type = ? AND repository_id = ? AND day >= ?", filter.RepoType, repo.ID, since)
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.Version != "" {
+		query = query.Where("version = ?", filter.Version)
+	}
+
+	var stats []models.DownloadStat
+	if err := query.Order("day").Find(&stats).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения статистики скачиваний: %w", err)
+	}
+
+	report := &DownloadReport{
+		RepoType:   filter.RepoType,
+		Repository: repo.Name,
+		Days:       days,
+		Artifacts:  []ArtifactDownloads{},
+	}
+
+	type artifactKey struct {
+		id            int
+		name, version string
+	}
+	artifacts := make(map[artifactKey]*ArtifactDownloads)
+	for _, stat := range stats {
+		key := artifactKey{stat.ArtifactID, stat.Name, stat.Version}
+		artifact, ok := artifacts[key]
+		if !ok {
+			artifact = &ArtifactDownloads{ArtifactID: stat.ArtifactID, Name: stat.Name, Version: stat.Version}
+			artifacts[key] = artifact
+		}
+
+		artifact.Downloads += stat.Downloads
+		artifact.Bytes += stat.Bytes
+		if stat.LastDownloadedAt.After(artifact.LastDownloadedAt) {
+			artifact.LastDownloadedAt = stat.LastDownloadedAt
+		}
+		artifact.Daily = append(artifact.Daily, DownloadDay{
+			Day:       stat.Day.UTC().Format("2006-01-02"),
+			Downloads: stat.Downloads,
+			Bytes:     stat.Bytes,
+		})
+
+		report.Downloads += stat.Downloads
+		report.Bytes += stat.Bytes
+	}
+
+	for _, artifact := range artifacts {
+		report.Artifacts = append(report.Artifacts, *artifact)
+	}
+	sort.Slice(report.Artifacts, func(i, j int) bool {
+		a, b := report.Artifacts[i], report.Artifacts[j]
+		if a.Downloads != b.Downloads {
+			return a.Downloads > b.Downloads
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+
+	return report, nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddDownload(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	first := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	events := []downloadEvent{
+		{repoType: FormatHelm, repositoryID: 1, artifactID: 5, name: "app", version: "1.0.0", bytes: 100, at: first},
+		{repoType: FormatHelm, repositoryID: 1, artifactID: 5, name: "app", version: "1.0.0", bytes: 100, at: first.Add(time.Hour)},
+		// 2 июня по Москве, но 1 июня по UTC: сутки статистики считаются в UTC
+		{repoType: FormatHelm, repositoryID: 1, artifactID: 5, name: "app", version: "1.0.0", bytes: 100, at: time.Date(2024, 6, 2, 1, 0, 0, 0, moscow)},
+		{repoType: FormatHelm, repositoryID: 1, artifactID: 5, name: "app", version: "1.0.0", bytes: 100, at: first.Add(24 * time.Hour)},
+		{repoType: FormatHelm, repositoryID: 2, artifactID: 5, name: "app", version: "1.0.0", bytes: 100, at: first},
+		{repoType: FormatDocker, repositoryID: 1, name: "web", version: "latest", bytes: 10, at: first},
+		{repoType: FormatDocker, repositoryID: 1, name: "web", digest: "sha256:aa", bytes: 1000, at: first.Add(time.Minute)},
+		{repoType: FormatDocker, repositoryID: 1, name: "web", digest: "sha256:bb", bytes: 2000, at: first.Add(2 * time.Minute)},
+		{repoType: FormatDocker, repositoryID: 1, name: "web", digest: "sha256:aa", bytes: 1000, at: first.Add(3 * time.Minute)},
+	}
+
+	batch := make(map[downloadKey]*downloadTotals)
+	for _, event := range events {
+		addDownload(batch, event)
+	}
+
+	chart := downloadKey{repoType: FormatHelm, repositoryID: 1, artifactID: 5, name: "app", version: "1.0.0", day: day}
+	blobA := downloadKey{repoType: FormatDocker, repositoryID: 1, name: "web", digest: "sha256:aa", day: day}
+	blobB := downloadKey{repoType: FormatDocker, repositoryID: 1, name: "web", digest: "sha256:bb", day: day}
+	nextDay := chart
+	nextDay.day = day.AddDate(0, 0, 1)
+	otherRepo := chart
+	otherRepo.repositoryID = 2
+
+	tests := []struct {
+		name string
+		key  downloadKey
+		want downloadTotals
+	}{
+		{"same day", chart, downloadTotals{downloads: 3, bytes: 300, last: time.Date(2024, 6, 2, 1, 0, 0, 0, moscow)}},
+		{"next day", nextDay, downloadTotals{downloads: 1, bytes: 100, last: first.Add(24 * time.Hour)}},
+		{"other repository", otherRepo, downloadTotals{downloads: 1, bytes: 100, last: first}},
+		{"manifest", downloadKey{repoType: FormatDocker, repositoryID: 1, name: "web", version: "latest", day: day}, downloadTotals{downloads: 1, bytes: 10, last: first}},
+		// blob-ы не увеличивают число скачиваний
+		{"blob", blobA, downloadTotals{downloads: 0, bytes: 2000, last: first.Add(3 * time.Minute)}},
+		{"other blob", blobB, downloadTotals{downloads: 0, bytes: 2000, last: first.Add(2 * time.Minute)}},
+	}
+
+	if len(batch) != len(tests) {
+		t.Errorf("batch has %d keys, want %d", len(batch), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := batch[tt.key]
+			if !ok {
+				t.Fatalf("no totals for %+v", tt.key)
+			}
+			if got.downloads != tt.want.downloads || got.bytes != tt.want.bytes || !got.last.Equal(tt.want.last) {
+				t.Errorf("totals = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeDownloadStat(t *testing.T) {
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	image := downloadKey{repoType: FormatDocker, repositoryID: 1, name: "web", day: day}
+	blobA, blobB := image, image
+	blobA.digest = "sha256:aa"
+	blobB.digest = "sha256:bb"
+	manifest := image
+	manifest.version = "latest"
+	manifest.artifactID = 3
+
+	batch := map[downloadKey]*downloadTotals{
+		blobA:    {bytes: 1000, last: at.Add(time.Minute)},
+		blobB:    {bytes: 2000, last: at.Add(5 * time.Minute)},
+		manifest: {downloads: 2, bytes: 20, last: at},
+	}
+
+	stats := make(map[downloadKey]*downloadTotals)
+	for key, totals := range batch {
+		mergeDownloadStat(stats, key, totals)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("stats has %d rows, want 2: %v", len(stats), stats)
+	}
+	blobs, ok := stats[image]
+	if !ok {
+		t.Fatalf("no merged row for blobs of image %s", image.name)
+	}
+	if blobs.downloads != 0 || blobs.bytes != 3000 || !blobs.last.Equal(at.Add(5*time.Minute)) {
+		t.Errorf("blobs = %+v, want 0 downloads, 3000 bytes, last %v", *blobs, at.Add(5*time.Minute))
+	}
+	if got := stats[manifest]; got == nil || got.downloads != 2 || got.bytes != 20 {
+		t.Errorf("manifest = %+v, want 2 downloads, 20 bytes", got)
+	}
+
+	// итоги исходного пакета не меняются
+	if batch[blobA].bytes != 1000 {
+		t.Errorf("batch totals changed: %+v", *batch[blobA])
+	}
+}
+
+func TestFlushDownloadsEmpty(t *testing.T) {
+	droppedDownloads.Store(3)
+	// пустой пакет не обращается к базе, но сбрасывает счетчик пропущенных скачиваний
+	flushDownloads(map[downloadKey]*downloadTotals{})
+	if dropped := droppedDownloads.Load(); dropped != 0 {
+		t.Errorf("droppedDownloads = %d, want 0", dropped)
+	}
+}
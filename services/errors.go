@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"github.com/Viste/larets/i18n"
+	"gorm.io/gorm"
+)
+
+// Категории ошибок сервисов. По ним API выбирает HTTP статус ответа, например
+// errors.Is(err, ErrNotFound) - 404. Отсутствие записи в базе (gorm.ErrRecordNotFound)
+// тоже считается ErrNotFound. Права доступа - ErrUnauthorized и ErrForbidden из access.go.
+var (
+	ErrNotFound = errors.New("не найдено")
+	ErrConflict = errors.New("конфликт")
+	ErrInvalid  = errors.New("недопустимый запрос")
+)
+
+// Error - ошибка сервиса с машиночитаемым кодом. Ошибки создаются один раз как переменные
+// пакета и дополняются подробностями через i18n.Errorf("%w: ...").
+type Error struct {
+	Kind    error  // категория: ErrNotFound, ErrConflict, ErrInvalid, ErrForbidden, ErrUnauthorized
+	Code    string // код для клиентов API, например CHART_EXISTS
+	Message string
+}
+
+func newError(kind error, code, message string) error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is позволяет проверять категорию ошибки: errors.Is(ErrChartExists, ErrConflict)
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+var (
+	ErrRepositoryNotFound  = newError(ErrNotFound, "REPOSITORY_NOT_FOUND", "репозиторий не найден")
+	ErrRepositoryExists    = newError(ErrConflict, "REPOSITORY_EXISTS", "репозиторий с таким именем уже существует")
+	ErrRepositoryNotHosted = newError(ErrInvalid, "REPOSITORY_NOT_HOSTED", "операция доступна только для хостового репозитория")
+	ErrRepositoryNotProxy  = newError(ErrInvalid, "REPOSITORY_NOT_PROXY", "репозиторий не является прокси")
+	ErrRemoteURLMissing    = newError(ErrInvalid, "REMOTE_URL_MISSING", "URL удаленного репозитория не указан")
+)
+
+// repositoryLookupError переводит отсутствие записи репозитория в ErrRepositoryNotFound
+func repositoryLookupError(name string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return i18n.Errorf("%w: %s", ErrRepositoryNotFound, name)
+	}
+	return i18n.Errorf("ошибка получения репозитория %s: %w", name, err)
+}
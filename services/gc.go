@@ -0,0 +1,492 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// сколько объектов каждой категории перечисляется в отчете, остальные только учитываются
+const gcReportItems = 1000
+
+// GCOptions - параметры задачи сборки мусора
+type GCOptions struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// GCCategory - удаленные объекты одной категории (при dry_run - объекты, которые были бы удалены)
+type GCCategory struct {
+	Count int      `json:"count"`
+	Size  int64    `json:"size"`
+	Items []string `json:"items"`
+}
+
+func (c *GCCategory) add(item string, size int64) {
+	c.Count++
+	c.Size += size
+	if len(c.Items) < gcReportItems {
+		c.Items = append(c.Items, item)
+	}
+}
+
+// GCReport - отчет сборки мусора, сохраняется в результате задачи
+type GCReport struct {
+	DryRun      bool       `json:"dry_run"`
+	Blobs       GCCategory `json:"blobs"`
+	Uploads     GCCategory `json:"uploads"`
+	OrphanFiles GCCategory `json:"orphan_files"`
+	TotalSize   int64      `json:"total_size"`
+	Errors      []string   `json:"errors,omitempty"`
+}
+
+type GCService struct{}
+
+// StartGC ставит в очередь задачу сборки мусора. При dryRun ничего не удаляется,
+// а отчет задачи содержит то, что было бы удалено.
+func (s *GCService) StartGC(ctx context.Context, dryRun bool) (*models.Task, error) {
+	return submitTask(ctx, models.Task{Type: TaskGC}, GCOptions{DryRun: dryRun})
+}
+
+type garbageCollector struct {
+	run    *TaskRun
+	dryRun bool
+	// удаляются только объекты старше этого момента: blob-ы только что загруженного
+	// образа еще не связаны с манифестом, а загрузка может продолжаться
+	cutoff time.Time
+	report GCReport
+	// hex digest-ов, на которые ссылаются образы и StoredFile
+	digests map[string]bool
+}
+
+// gcRepository - поля репозитория любого формата, нужные для поиска файлов без ссылок
+type gcRepository struct {
+	ID          int
+	Name        string
+	StoragePath string
+}
+
+// collectGarbage - обработчик задачи сборки мусора. Сначала отмечаются blob-ы, на которые
+// ссылаются манифесты и StoredFile, затем удаляются остальные blob-ы, брошенные загрузки и
+// файлы без записей в базе. На время удаления сервер переводится в режим только для чтения.
+func collectGarbage(ctx context.Context, run *TaskRun) error {
+	var options GCOptions
+	if err := run.Params(&options); err != nil {
+		return i18n.Errorf("неверные параметры задачи: %w", err)
+	}
+
+	if !options.DryRun {
+		if !maintenance.begin("сборка мусора") {
+			return errors.New("обслуживание хранилища уже выполняется")
+		}
+		defer maintenance.end()
+		run.Logf("Запись в хранилище приостановлена на время сборки мусора")
+	}
+
+	gc := &garbageCollector{
+		run:     run,
+		dryRun:  options.DryRun,
+		cutoff:  time.Now().Add(-time.Duration(config.Config.GCGracePeriod) * time.Minute),
+		report:  GCReport{DryRun: options.DryRun},
+		digests: make(map[string]bool),
+	}
+
+	steps := []struct {
+		name i18n.Message
+		fn   func(context.Context) error
+	}{
+		{"Поиск используемых blob-ов", gc.markBlobs},
+		{"Удаление blob-ов без ссылок", gc.sweepBlobs},
+		{"Удаление незавершенных загрузок", gc.sweepUploads},
+		{"Удаление временных файлов", gc.sweepTemp},
+		{"Удаление файлов без ссылок в репозиториях", gc.sweepRepositories},
+	}
+
+	var err error
+	for i, step := range steps {
+		run.Logf("%s", step.name)
+		if err = step.fn(ctx); err != nil {
+			break
+		}
+		run.SetProgress((i + 1) * 100 / len(steps))
+	}
+
+	report := &gc.report
+	report.TotalSize = report.Blobs.Size + report.Uploads.Size + report.OrphanFiles.Size
+	run.SetResult(report)
+	if err != nil {
+		return err
+	}
+
+	summary := i18n.Sprintf(i18n.LogLanguage(), "blob-ов %d (%d байт), загрузок %d (%d байт), файлов без ссылок %d (%d байт)",
+		report.Blobs.Count, report.Blobs.Size, report.Uploads.Count, report.Uploads.Size,
+		report.OrphanFiles.Count, report.OrphanFiles.Size)
+	if gc.dryRun {
+		run.Logf("Будет удалено: %s", summary)
+		i18n.Logf("Пробная сборка мусора: будет удалено %s", summary)
+	} else {
+		run.Logf("Удалено: %s", summary)
+		i18n.Logf("Сборка мусора завершена: удалено %s", summary)
+	}
+	return nil
+}
+
+func (gc *garbageCollector) fail(format string, args ...interface{}) {
+	message := i18n.Sprintf(i18n.LogLanguage(), format, args...)
+	gc.report.Errors = append(gc.report.Errors, message)
+	gc.run.Logf("%s", message)
+}
+
+func (gc *garbageCollector) markDigest(digest string) {
+	if digestHex, err := ParseDigest(digest); err == nil {
+		gc.digests[digestHex] = true
+	}
+}
+
+// markBlobs отмечает blob-ы, на которые ссылаются StoredFile, манифесты образов (сам манифест,
+// config, слои и вложенные манифесты manifest list) и завершенные сессии загрузки
+func (gc *garbageCollector) markBlobs(ctx context.Context) error {
+	var storedFiles []models.StoredFile
+	err := db.DB.Select("id", "sha256").FindInBatches(&storedFiles, 1000, func(tx *gorm.DB, batch int) error {
+		for _, storedFile := range storedFiles {
+			if storedFile.SHA256 != "" {
+				gc.digests[storedFile.SHA256] = true
+			}
+		}
+		return ctx.Err()
+	}).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения связей с blob: %w", err)
+	}
+
+	var images []models.DockerImage
+	err = db.DB.Select("id", "sha256", "manifest", "layers").FindInBatches(&images, 500, func(tx *gorm.DB, batch int) error {
+		for _, image := range images {
+			if image.SHA256 != "" {
+				gc.digests[image.SHA256] = true
+			}
+			for _, layer := range image.Layers {
+				gc.markDigest(layer)
+			}
+
+			var manifest imageManifest
+			if json.Unmarshal(image.Manifest, &manifest) != nil {
+				continue
+			}
+			gc.markDigest(manifest.Config.Digest)
+			for _, descriptor := range append(manifest.Layers, manifest.Manifests...) {
+				gc.markDigest(descriptor.Digest)
+			}
+		}
+		return ctx.Err()
+	}).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения образов: %w", err)
+	}
+
+	// blob-ы, загруженные в репозиторий и еще ждущие манифеста
+	var uploaded []string
+	if err := db.DB.Model(&models.DockerUpload{}).Where("digest <> ''").Pluck("digest", &uploaded).Error; err != nil {
+		return i18n.Errorf("ошибка получения сессий загрузки: %w", err)
+	}
+	for _, digest := range uploaded {
+		gc.markDigest(digest)
+	}
+
+	gc.run.Logf("Используемых blob-ов: %d", len(gc.digests))
+	return nil
+}
+
+// sweepBlobs удаляет blob-ы с нулевым счетчиком ссылок, которые не отмечены, а затем
+// файлы в хранилище blob-ов, для которых нет записи в базе
+func (gc *garbageCollector) sweepBlobs(ctx context.Context) error {
+	var blobs []models.Blob
+	err := db.DB.Where("ref_count = 0 AND updated_at < ?", gc.cutoff).
+		FindInBatches(&blobs, 1000, func(tx *gorm.DB, batch int) error {
+			for _, blob := range blobs {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				gc.sweepBlob(&blob)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения blob-ов: %w", err)
+	}
+
+	err = storage.Store.Walk(ctx, "blobs/sha256/", func(info storage.Info) error {
+		if info.ModTime.After(gc.cutoff) {
+			return nil
+		}
+
+		name := path.Base(info.Key)
+		if !strings.Contains(name, ".tmp-") {
+			if gc.digests[name] {
+				return nil
+			}
+			var count int64
+			if err := db.DB.Model(&models.Blob{}).Where("digest = ?", "sha256:"+name).Count(&count).Error; err != nil {
+				return i18n.Errorf("ошибка поиска записи blob: %w", err)
+			}
+			if count > 0 {
+				return nil
+			}
+		}
+
+		gc.removeObject(info.Key, info.Size)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		gc.fail("Ошибка обхода хранилища blob-ов: %v", err)
+		return nil
+	}
+	return err
+}
+
+func (gc *garbageCollector) sweepBlob(blob *models.Blob) {
+	digestHex := strings.TrimPrefix(blob.Digest, "sha256:")
+	if len(digestHex) != 64 {
+		return
+	}
+	if gc.digests[digestHex] {
+		gc.run.Logf("Blob %s используется, но его счетчик ссылок равен нулю", blob.Digest)
+		return
+	}
+
+	key := blobStore.Key(digestHex)
+	size := blob.Size
+	if info, err := storage.Store.Stat(context.Background(), key); err == nil {
+		if info.ModTime.After(gc.cutoff) {
+			return
+		}
+		size = info.Size
+	}
+
+	if !gc.dryRun {
+		// условие на счетчик защищает blob, на который успели сослаться после отметки
+		result := db.DB.Where("digest = ? AND ref_count = 0", blob.Digest).Delete(&models.Blob{})
+		if result.Error != nil {
+			gc.fail("Ошибка удаления записи blob %s: %v", blob.Digest, result.Error)
+			return
+		}
+		if result.RowsAffected == 0 {
+			return
+		}
+		if err := storage.Store.Delete(context.Background(), key); err != nil {
+			gc.fail("Ошибка удаления blob %s: %v", blob.Digest, err)
+			return
+		}
+	}
+	gc.report.Blobs.add(blob.Digest, size)
+}
+
+// sweepUploads удаляет сессии загрузки, которые не обновлялись дольше GC_GRACE_PERIOD,
+// и файлы загрузок, для которых нет сессии. Записи о blob-ах, скачанных прокси-репозиториями,
+// держат ссылку на blob и удаляются вместе с репозиторием.
+func (gc *garbageCollector) sweepUploads(ctx context.Context) error {
+	var uploads []models.DockerUpload
+	if err := db.DB.Where("updated_at < ? AND NOT cached", gc.cutoff).Find(&uploads).Error; err != nil {
+		return i18n.Errorf("ошибка получения сессий загрузки: %w", err)
+	}
+
+	for _, upload := range uploads {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		size := upload.Size
+		if info, err := os.Stat(upload.Path); err == nil {
+			size = info.Size()
+		}
+		if !gc.dryRun {
+			if err := db.DB.Delete(&upload).Error; err != nil {
+				gc.fail("Ошибка удаления сессии загрузки %s: %v", upload.ID, err)
+				continue
+			}
+			if err := os.Remove(upload.Path); err != nil && !os.IsNotExist(err) {
+				gc.fail("Ошибка удаления файла загрузки %s: %v", upload.Path, err)
+			}
+		}
+		gc.report.Uploads.add(upload.ID, size)
+	}
+
+	var ids []string
+	if err := db.DB.Model(&models.DockerUpload{}).Pluck("id", &ids).Error; err != nil {
+		return i18n.Errorf("ошибка получения сессий загрузки: %w", err)
+	}
+	sessions := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		sessions[id] = true
+	}
+
+	return gc.sweepDir(ctx, filepath.Join(config.Config.TempStorage, "uploads"), func(name string) bool {
+		return sessions[name]
+	})
+}
+
+// sweepTemp удаляет временные файлы и директории, оставшиеся после прерванных операций
+func (gc *garbageCollector) sweepTemp(ctx context.Context) error {
+	return gc.sweepDir(ctx, config.Config.TempStorage, func(name string) bool {
+		return name == "uploads"
+	})
+}
+
+// sweepRepositories удаляет директории репозиториев, которых нет в базе, и файлы чартов
+// Helm, на которые не ссылается ни одна запись HelmChart (например, перезаписанные в кеше прокси)
+func (gc *garbageCollector) sweepRepositories(ctx context.Context) error {
+	roots := []struct {
+		format string
+		root   string
+		model  interface{}
+	}{
+		{FormatDocker, config.Config.DockerStorage, &models.DockerRepository{}},
+		{FormatGit, config.Config.GitStorage, &models.GitRepository{}},
+		{FormatHelm, config.Config.HelmStorage, &models.HelmRepository{}},
+	}
+
+	// временные клоны .mirror-* репозиториев, для которых выполняется задача, не трогаем
+	var busy []string
+	err := db.DB.Model(&models.Task{}).
+		Where("repo_type = ? AND status IN ?", FormatGit, []string{TaskStatusPending, TaskStatusRunning}).
+		Pluck("repository_name", &busy).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения задач: %w", err)
+	}
+
+	for _, root := range roots {
+		var repos []gcRepository
+		if err := db.DB.Model(root.model).Find(&repos).Error; err != nil {
+			return i18n.Errorf("ошибка получения %s репозиториев: %w", root.format, err)
+		}
+
+		known := make(map[string]bool)
+		for _, repo := range repos {
+			known[repo.Name] = true
+			if abs, err := filepath.Abs(repo.StoragePath); err == nil && repo.StoragePath != "" {
+				known[abs] = true
+			}
+		}
+		if root.format == FormatGit {
+			for _, name := range busy {
+				known[name] = true
+			}
+		}
+
+		err := gc.sweepDir(ctx, root.root, func(name string) bool {
+			if abs, err := filepath.Abs(filepath.Join(root.root, name)); err == nil && known[abs] {
+				return true
+			}
+			if i := strings.Index(name, ".mirror-"); i > 0 {
+				name = name[:i]
+			}
+			return known[name]
+		})
+		if err != nil {
+			return err
+		}
+
+		if root.format == FormatHelm {
+			for _, repo := range repos {
+				if err := gc.sweepCharts(ctx, repo); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (gc *garbageCollector) sweepCharts(ctx context.Context, repo gcRepository) error {
+	if repo.StoragePath == "" {
+		return nil
+	}
+
+	var paths []string
+	err := db.DB.Model(&models.HelmChart{}).Where("repository_id = ?", repo.ID).Pluck("path", &paths).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения чартов репозитория %s: %w", repo.Name, err)
+	}
+	charts := make(map[string]bool, len(paths))
+	for _, chartPath := range paths {
+		charts[path.Base(filepath.ToSlash(chartPath))] = true
+	}
+
+	prefix := chartKey(repo.StoragePath, "") + "/"
+	err = storage.Store.Walk(ctx, prefix, func(info storage.Info) error {
+		if charts[path.Base(info.Key)] || info.ModTime.After(gc.cutoff) {
+			return nil
+		}
+		gc.removeObject(info.Key, info.Size)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		gc.fail("Ошибка обхода чартов репозитория %s: %v", repo.Name, err)
+		return nil
+	}
+	return err
+}
+
+// sweepDir удаляет элементы директории старше GC_GRACE_PERIOD, для которых keep возвращает false
+func (gc *garbageCollector) sweepDir(ctx context.Context, dir string, keep func(name string) bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			gc.fail("Ошибка чтения %s: %v", dir, err)
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if keep(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(gc.cutoff) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		size := info.Size()
+		if entry.IsDir() {
+			size = dirSize(path)
+		}
+		gc.removeOrphan(path, size)
+	}
+	return nil
+}
+
+func (gc *garbageCollector) removeOrphan(path string, size int64) {
+	if !gc.dryRun {
+		if err := os.RemoveAll(path); err != nil {
+			gc.fail("Ошибка удаления %s: %v", path, err)
+			return
+		}
+	}
+	gc.report.OrphanFiles.add(path, size)
+}
+
+// removeObject удаляет объект хранилища артефактов, на который нет ссылок
+func (gc *garbageCollector) removeObject(key string, size int64) {
+	if !gc.dryRun {
+		if err := storage.Store.Delete(context.Background(), key); err != nil {
+			gc.fail("Ошибка удаления %s: %v", key, err)
+			return
+		}
+	}
+	gc.report.OrphanFiles.add(key, size)
+}
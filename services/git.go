@@ -1,39 +1,56 @@
 package services
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Viste/larets/config"
 	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
 	"github.com/Viste/larets/models"
-	"log"
+	"gorm.io/gorm"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type GitService struct{}
 
-func (s *GitService) CreateRepository(name, description string, repoType models.RepositoryType, url, branch string) error {
+// CreateRepository создает Git репозиторий. Прокси-репозиторий клонируется в фоновой задаче,
+// которая и возвращается; для остальных типов задача равна nil. Группа создается сразу
+// с участниками members.
+func (s *GitService) CreateRepository(ctx context.Context, name, description string, repoType models.RepositoryType, url, branch string, anonymousRead bool, members []GroupMemberSpec) (*models.Task, error) {
+	if err := authorizeName(ctx, FormatGit, name, ActionAdmin); err != nil {
+		return nil, err
+	}
+
 	var count int64
 	db.DB.Model(&models.GitRepository{}).Where("name = ?", name).Count(&count)
 	if count > 0 {
-		return errors.New("репозиторий с таким именем уже существует")
+		return nil, i18n.Errorf("%w: %s", ErrRepositoryExists, name)
 	}
 
 	storagePath := filepath.Join(config.Config.GitStorage, name)
 	if err := os.MkdirAll(storagePath, 0755); err != nil {
-		return fmt.Errorf("ошибка создания директории хранилища: %w", err)
+		return nil, i18n.Errorf("ошибка создания директории хранилища: %w", err)
 	}
 
 	repo := models.GitRepository{
 		BaseRepository: models.BaseRepository{
-			Name:        name,
-			Description: description,
-			Type:        repoType,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
+			Name:          name,
+			Description:   description,
+			Type:          repoType,
+			AnonymousRead: anonymousRead,
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
 		},
 		URL:          url,
 		Branch:       branch,
@@ -42,10 +59,10 @@ func (s *GitService) CreateRepository(name, description string, repoType models.
 		StoragePath:  storagePath,
 	}
 
-	if err := db.DB.Create(&repo).Error; err != nil {
+	if err := createRepositoryRecord(ctx, FormatGit, &repo, &repo.BaseRepository, members); err != nil {
 		// Очищаем созданную директорию в случае ошибки
 		os.RemoveAll(storagePath)
-		return fmt.Errorf("ошибка сохранения репозитория: %w", err)
+		return nil, err
 	}
 
 	if repoType == models.TypeHosted {
@@ -54,86 +71,359 @@ func (s *GitService) CreateRepository(name, description string, repoType models.
 		if err := cmd.Run(); err != nil {
 			db.DB.Delete(&repo)
 			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка инициализации Git репозитория: %w", err)
+			return nil, i18n.Errorf("ошибка инициализации Git репозитория: %w", err)
+		}
+
+		// HEAD указывает на основную ветку, чтобы git clone по HTTP сразу ее извлекал
+		if branch != "" {
+			cmd = exec.Command("git", "symbolic-ref", "HEAD", "refs/heads/"+branch)
+			cmd.Dir = storagePath
+			if err := cmd.Run(); err != nil {
+				i18n.Logf("Ошибка установки основной ветки %s для репозитория %s: %v", branch, name, err)
+			}
 		}
 	} else if repoType == models.TypeProxy && url != "" {
-		cmd := exec.Command("git", "clone", "--mirror", url, ".")
-		cmd.Dir = storagePath
-		if err := cmd.Run(); err != nil {
+		// клонирование может занять долгое время и выполняется в фоновой задаче
+		task, err := submitTask(ctx, models.Task{
+			Type:           TaskMirror,
+			RepoType:       FormatGit,
+			RepositoryID:   repo.ID,
+			RepositoryName: repo.Name,
+		}, nil)
+		if err != nil {
 			db.DB.Delete(&repo)
 			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка клонирования удаленного репозитория: %w", err)
+			return nil, err
 		}
+
+		i18n.Logf("Создан Git репозиторий: %s, тип: %s, клонирование в задаче %d", name, repoType, task.ID)
+		return task, nil
 	}
 
-	log.Printf("Создан Git репозиторий: %s, тип: %s", name, repoType)
-	return nil
+	i18n.Logf("Создан Git репозиторий: %s, тип: %s", name, repoType)
+	return nil, nil
 }
 
-func (s *GitService) ListRepositories() ([]models.GitRepository, error) {
+// ListRepositories возвращает репозитории, доступные пользователю на чтение
+func (s *GitService) ListRepositories(ctx context.Context) ([]models.GitRepository, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var repos []models.GitRepository
-	err := db.DB.Find(&repos).Error
-	return repos, err
+	if err := db.DB.Find(&repos).Error; err != nil {
+		return nil, err
+	}
+
+	readable := repos[:0]
+	for _, repo := range repos {
+		if scope.check(FormatGit, &repo.BaseRepository, ActionRead) == nil {
+			readable = append(readable, repo)
+		}
+	}
+	return readable, nil
+}
+
+// getRepositoryFor находит репозиторий и проверяет право action на него
+func (s *GitService) getRepositoryFor(ctx context.Context, name, action string) (*models.GitRepository, error) {
+	repo, err := s.getRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, FormatGit, &repo.BaseRepository, action); err != nil {
+		return nil, err
+	}
+	return repo, nil
 }
 
-func (s *GitService) GetRepository(name string) (*models.GitRepository, error) {
+func (s *GitService) GetRepository(ctx context.Context, name string) (*models.GitRepository, error) {
+	return s.getRepositoryFor(ctx, name, ActionRead)
+}
+
+func (s *GitService) getRepository(name string) (*models.GitRepository, error) {
 	var repo models.GitRepository
 	err := db.DB.Where("name = ?", name).First(&repo).Error
 	if err != nil {
-		return nil, fmt.Errorf("репозиторий не найден: %w", err)
+		return nil, repositoryLookupError(name, err)
 	}
 	return &repo, nil
 }
 
-func (s *GitService) SyncRepository(name string) error {
-	repo, err := s.GetRepository(name)
+// DeleteRepository удаляет Git репозиторий, его участие в группах и рабочую копию на диске.
+// В режиме dryRun ничего не удаляется, а возвращается отчет о том, что будет удалено.
+func (s *GitService) DeleteRepository(ctx context.Context, name string, dryRun, force bool) (*DeleteReport, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionAdmin)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	report, err := newDeleteReport(FormatGit, &repo.BaseRepository, repo.StoragePath, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	db.DB.Model(&models.Artifact{}).Where("repository_id = ? AND repo_type = ?", repo.ID, FormatGit).Count(&report.Artifacts)
+
+	if err := report.checkGroupMembership(force); err != nil || dryRun {
+		return report, err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteRepositoryRecords(tx, FormatGit, repo.ID); err != nil {
+			return err
+		}
+		return tx.Delete(repo).Error
+	})
+	if err != nil {
+		return nil, i18n.Errorf("ошибка удаления репозитория: %w", err)
+	}
+
+	removeStorage(config.Config.GitStorage, repo.StoragePath)
+
+	i18n.Logf("Удален Git репозиторий %s", name)
+	return report, nil
+}
+
+// mirrorParams - параметры задачи клонирования. URL задается при смене адреса прокси-репозитория:
+// зеркало клонируется с нового адреса, и адрес сохраняется только после успешного клонирования.
+// Без URL задача выполняет первичное клонирование созданного репозитория.
+type mirrorParams struct {
+	URL string `json:"url,omitempty"`
+}
+
+// UpdateRepository изменяет настройки Git репозитория. При смене URL прокси-репозиторий заново
+// клонируется с нового адреса в фоновой задаче, которая и возвращается; в остальных случаях
+// задача равна nil. При смене основной ветки хостового репозитория обновляется HEAD.
+func (s *GitService) UpdateRepository(ctx context.Context, name string, update RepositoryUpdate) (*models.GitRepository, *models.Task, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionAdmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := update.validate(FormatGit, repo.Type); err != nil {
+		return nil, nil, err
+	}
+
+	if update.Branch != nil {
+		cmd := exec.Command("git", "check-ref-format", "--branch", *update.Branch)
+		if err := cmd.Run(); err != nil {
+			return nil, nil, i18n.Errorf("%w: недопустимое имя ветки %s", ErrRepositoryUpdateInvalid, *update.Branch)
+		}
+	}
+
+	remirror := update.URL != nil && *update.URL != repo.URL
+	if remirror {
+		active, err := activeTask(TaskMirror, FormatGit, repo.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if active != nil {
+			return nil, nil, i18n.Errorf("%w: клонирование (задача %d)", ErrTaskActive, active.ID)
+		}
+	}
+
+	if update.Branch != nil && *update.Branch != repo.Branch {
+		if repo.Type == models.TypeHosted {
+			cmd := exec.Command("git", "symbolic-ref", "HEAD", "refs/heads/"+*update.Branch)
+			cmd.Dir = repo.StoragePath
+			if err := cmd.Run(); err != nil {
+				return nil, nil, i18n.Errorf("ошибка установки основной ветки: %w", err)
+			}
+		}
+		repo.Branch = *update.Branch
+	}
+
+	update.applyBase(&repo.BaseRepository)
+	if update.CloneEnabled != nil {
+		repo.CloneEnabled = *update.CloneEnabled
+	}
+	if update.PushEnabled != nil {
+		repo.PushEnabled = *update.PushEnabled
+	}
+
+	if err := db.DB.Save(repo).Error; err != nil {
+		return nil, nil, i18n.Errorf("ошибка сохранения репозитория: %w", err)
+	}
+
+	if !remirror {
+		i18n.Logf("Изменены настройки Git репозитория %s", name)
+		return repo, nil, nil
+	}
+
+	// клонирование может занять долгое время и выполняется в фоновой задаче, которая
+	// выполняется по очереди с синхронизацией того же репозитория
+	task, err := submitTask(ctx, models.Task{
+		Type:           TaskMirror,
+		RepoType:       FormatGit,
+		RepositoryID:   repo.ID,
+		RepositoryName: repo.Name,
+	}, mirrorParams{URL: *update.URL})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i18n.Logf("Изменены настройки Git репозитория %s, клонирование с %s в задаче %d", name, *update.URL, task.ID)
+	return repo, task, nil
+}
+
+// remirror клонирует прокси-репозиторий с адреса url во временную директорию
+// и заменяет ею текущее зеркало, чтобы при ошибке клонирования зеркало осталось прежним
+func (s *GitService) remirror(ctx context.Context, repo *models.GitRepository, url string, run *TaskRun) error {
+	mirrorPath := repo.StoragePath + ".mirror-" + newUUID()
+	cmd := exec.CommandContext(ctx, "git", "clone", "--mirror", "--progress", url, mirrorPath)
+	if err := runGitCommand(cmd, run); err != nil {
+		os.RemoveAll(mirrorPath)
+		if ctx.Err() == nil {
+			metrics.UpstreamError(FormatGit, repo.Name)
+		}
+		return i18n.Errorf("ошибка клонирования удаленного репозитория: %w", err)
+	}
+
+	oldPath := repo.StoragePath + ".old-" + newUUID()
+	if err := os.Rename(repo.StoragePath, oldPath); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(mirrorPath)
+		return i18n.Errorf("ошибка замены зеркала репозитория: %w", err)
+	}
+	if err := os.Rename(mirrorPath, repo.StoragePath); err != nil {
+		os.Rename(oldPath, repo.StoragePath)
+		os.RemoveAll(mirrorPath)
+		return i18n.Errorf("ошибка замены зеркала репозитория: %w", err)
+	}
+	os.RemoveAll(oldPath)
+
+	i18n.Logf("Git репозиторий %s клонирован с %s", repo.Name, url)
+	return nil
+}
+
+// mirrorRepository выполняет задачу клонирования прокси-репозитория. Если первичное клонирование
+// не удалось или отменено, репозиторий удаляется, как при ошибке создания. При смене адреса
+// ошибка клонирования оставляет прежнее зеркало и прежний адрес.
+func (s *GitService) mirrorRepository(ctx context.Context, run *TaskRun) error {
+	var repo models.GitRepository
+	if err := db.DB.First(&repo, run.Task.RepositoryID).Error; err != nil {
+		return i18n.Errorf("репозиторий не найден: %w", err)
+	}
+
+	var params mirrorParams
+	if err := run.Params(&params); err != nil {
+		return i18n.Errorf("неверные параметры задачи: %w", err)
+	}
+	if params.URL != "" {
+		run.Logf("Клонирование с нового адреса %s", params.URL)
+		if err := s.remirror(ctx, &repo, params.URL, run); err != nil {
+			return err
+		}
+		err := db.DB.Model(&repo).Updates(map[string]interface{}{"url": params.URL, "updated_at": time.Now()}).Error
+		if err != nil {
+			return i18n.Errorf("ошибка сохранения репозитория: %w", err)
+		}
+		return nil
+	}
+
+	run.Logf("Клонирование %s", repo.URL)
+	err := s.remirror(ctx, &repo, repo.URL, run)
+	if err == nil {
+		return nil
+	}
+
+	// при остановке сервера задача будет возобновлена, репозиторий не удаляется
+	if ctx.Err() == nil || errors.Is(context.Cause(ctx), ErrTaskCanceled) {
+		s.discardMirror(run)
+	}
+	return err
+}
+
+// discardMirror удаляет прокси-репозиторий, первичное клонирование которого не выполнено или отменено
+func (s *GitService) discardMirror(run *TaskRun) {
+	// при смене адреса репозиторий уже клонирован и остается с прежним зеркалом
+	var params mirrorParams
+	if run.Params(&params) != nil || params.URL != "" {
+		return
+	}
+
+	var repo models.GitRepository
+	if err := db.DB.First(&repo, run.Task.RepositoryID).Error; err != nil {
+		return
+	}
+
+	db.DB.Delete(&repo)
+	os.RemoveAll(repo.StoragePath)
+	run.Logf("Репозиторий %s удален, так как клонирование не выполнено", repo.Name)
+}
+
+// SyncRepository ставит в очередь задачу синхронизации прокси-репозитория с удаленным источником
+func (s *GitService) SyncRepository(ctx context.Context, name string) (*models.Task, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionWrite)
+	if err != nil {
+		return nil, err
 	}
 
 	if repo.Type != models.TypeProxy {
-		return errors.New("репозиторий не является прокси")
+		return nil, i18n.Errorf("%w: %s", ErrRepositoryNotProxy, repo.Name)
 	}
 
 	if repo.URL == "" {
-		return errors.New("URL удаленного репозитория не указан")
+		return nil, i18n.Errorf("%w: %s", ErrRemoteURLMissing, repo.Name)
+	}
+
+	return submitTask(ctx, models.Task{
+		Type:           TaskSync,
+		RepoType:       FormatGit,
+		RepositoryID:   repo.ID,
+		RepositoryName: repo.Name,
+	}, nil)
+}
+
+// syncRepository выполняет задачу синхронизации: git fetch в зеркале прокси-репозитория
+func (s *GitService) syncRepository(ctx context.Context, run *TaskRun) error {
+	var repo models.GitRepository
+	if err := db.DB.First(&repo, run.Task.RepositoryID).Error; err != nil {
+		return i18n.Errorf("репозиторий не найден: %w", err)
 	}
 
-	log.Printf("Синхронизация Git репозитория %s с удаленным источником %s", name, repo.URL)
+	i18n.Logf("Синхронизация Git репозитория %s с удаленным источником %s", repo.Name, repo.URL)
+	run.Logf("Синхронизация с удаленным источником %s", repo.URL)
 
-	cmd := exec.Command("git", "fetch", "--all")
+	cmd := exec.CommandContext(ctx, "git", "fetch", "--all", "--progress")
 	cmd.Dir = repo.StoragePath
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ошибка выполнения git fetch: %w", err)
+	if err := runGitCommand(cmd, run); err != nil {
+		if ctx.Err() == nil {
+			metrics.UpstreamError(FormatGit, repo.Name)
+		}
+		return i18n.Errorf("ошибка выполнения git fetch: %w", err)
 	}
 
 	repo.UpdatedAt = time.Now()
-	if err := db.DB.Save(repo).Error; err != nil {
-		return fmt.Errorf("ошибка обновления записи репозитория: %w", err)
+	if err := db.DB.Save(&repo).Error; err != nil {
+		return i18n.Errorf("ошибка обновления записи репозитория: %w", err)
 	}
 
-	log.Printf("Git репозиторий %s успешно синхронизирован", name)
+	i18n.Logf("Git репозиторий %s успешно синхронизирован", repo.Name)
 	return nil
 }
 
-func (s *GitService) GetRepoInfo(name string) (map[string]interface{}, error) {
-	repo, err := s.GetRepository(name)
+func (s *GitService) GetRepoInfo(ctx context.Context, name string) (map[string]interface{}, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	dataRepo, err := s.resolveReadRepository(repo)
 	if err != nil {
 		return nil, err
 	}
 
 	branchesCmd := exec.Command("git", "branch", "--list")
-	branchesCmd.Dir = repo.StoragePath
+	branchesCmd.Dir = dataRepo.StoragePath
 	branchesOutput, err := branchesCmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения списка веток: %w", err)
+		return nil, i18n.Errorf("ошибка получения списка веток: %w", err)
 	}
 
 	logsCmd := exec.Command("git", "log", "--oneline", "-n", "10")
-	logsCmd.Dir = repo.StoragePath
+	logsCmd.Dir = dataRepo.StoragePath
 	logsOutput, err := logsCmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения истории коммитов: %w", err)
+		return nil, i18n.Errorf("ошибка получения истории коммитов: %w", err)
 	}
 
 	// Собираем информацию
@@ -152,42 +442,305 @@ func (s *GitService) GetRepoInfo(name string) (map[string]interface{}, error) {
 	return info, nil
 }
 
-func (s *GitService) CreateBranch(repoName, branchName, baseBranch string) error {
-	repo, err := s.GetRepository(repoName)
+func (s *GitService) CreateBranch(ctx context.Context, repoName, branchName, baseBranch string) error {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionWrite)
 	if err != nil {
 		return err
 	}
 
 	if repo.Type != models.TypeHosted {
-		return errors.New("нельзя создавать ветки в репозитории, который не является хостовым")
+		return i18n.Errorf("%w: нельзя создавать ветки в репозитории %s", ErrRepositoryNotHosted, repo.Name)
 	}
 
 	cmd := exec.Command("git", "branch", branchName, baseBranch)
 	cmd.Dir = repo.StoragePath
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ошибка создания ветки: %w", err)
+		return i18n.Errorf("ошибка создания ветки: %w", err)
 	}
 
-	log.Printf("Создана ветка %s в репозитории %s", branchName, repoName)
+	i18n.Logf("Создана ветка %s в репозитории %s", branchName, repoName)
 	return nil
 }
 
-func (s *GitService) DeleteBranch(repoName, branchName string) error {
-	repo, err := s.GetRepository(repoName)
+func (s *GitService) DeleteBranch(ctx context.Context, repoName, branchName string) error {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionDelete)
 	if err != nil {
 		return err
 	}
 
 	if repo.Type != models.TypeHosted {
-		return errors.New("нельзя удалять ветки в репозитории, который не является хостовым")
+		return i18n.Errorf("%w: нельзя удалять ветки в репозитории %s", ErrRepositoryNotHosted, repo.Name)
 	}
 
 	cmd := exec.Command("git", "branch", "-D", branchName)
 	cmd.Dir = repo.StoragePath
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ошибка удаления ветки: %w", err)
+		return i18n.Errorf("ошибка удаления ветки: %w", err)
+	}
+
+	i18n.Logf("Удалена ветка %s в репозитории %s", branchName, repoName)
+	return nil
+}
+
+var (
+	ErrGitServiceInvalid = newError(ErrInvalid, "GIT_SERVICE_INVALID", "неподдерживаемая служба git")
+	ErrCloneDisabled     = newError(ErrForbidden, "CLONE_DISABLED", "клонирование репозитория запрещено")
+	ErrPushDisabled      = newError(ErrForbidden, "PUSH_DISABLED", "push в репозиторий запрещен")
+)
+
+// checkGitService проверяет, что служба разрешена для репозитория:
+// git-upload-pack (clone/fetch) - CloneEnabled, git-receive-pack (push) - PushEnabled и только для хостовых
+func (s *GitService) checkGitService(repo *models.GitRepository, service string) error {
+	switch service {
+	case "git-upload-pack":
+		if !repo.CloneEnabled {
+			return ErrCloneDisabled
+		}
+	case "git-receive-pack":
+		if !repo.PushEnabled || repo.Type != models.TypeHosted {
+			return ErrPushDisabled
+		}
+	default:
+		return i18n.Errorf("%w: %s", ErrGitServiceInvalid, service)
+	}
+	return nil
+}
+
+// resolveReadRepository возвращает репозиторий, из которого читаются данные.
+// Группа Git репозиториев доступна только для чтения: запросы обслуживает первый по приоритету
+// участник, из которого разрешено клонирование и который уже содержит данные.
+func (s *GitService) resolveReadRepository(repo *models.GitRepository) (*models.GitRepository, error) {
+	if repo.Type != models.TypeGroup {
+		return repo, nil
+	}
+
+	members, err := groupMembers(FormatGit, repo.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		memberRepo, err := s.getRepository(member.MemberName)
+		if err != nil {
+			i18n.Logf("Участник %s группы %s недоступен: %v", member.MemberName, repo.Name, err)
+			continue
+		}
+		if !memberRepo.CloneEnabled {
+			continue
+		}
+		if !hasRefs(memberRepo.StoragePath) {
+			continue
+		}
+		return memberRepo, nil
+	}
+	return nil, i18n.Errorf("в группе %s нет доступных для чтения репозиториев: %w", repo.Name, gorm.ErrRecordNotFound)
+}
+
+// hasRefs сообщает, что в репозитории есть хотя бы одна ссылка
+func hasRefs(storagePath string) bool {
+	cmd := exec.Command("git", "for-each-ref", "--count=1")
+	cmd.Dir = storagePath
+	output, err := cmd.Output()
+	return err == nil && len(output) > 0
+}
+
+// serviceRepository находит репозиторий, в котором будет запущена служба git.
+// Для push требуется право записи, для clone и fetch - чтения.
+func (s *GitService) serviceRepository(ctx context.Context, name, service string) (*models.GitRepository, error) {
+	action := ActionRead
+	if service == "git-receive-pack" {
+		action = ActionWrite
+	}
+
+	repo, err := s.getRepositoryFor(ctx, name, action)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkGitService(repo, service); err != nil {
+		return nil, err
+	}
+	return s.resolveReadRepository(repo)
+}
+
+// PrepareService проверяет, что служба может быть запущена для репозитория, и возвращает
+// репозиторий, в котором ее нужно запустить. Вызывается до отправки заголовков ответа,
+// чтобы вернуть клиенту корректный код ошибки.
+func (s *GitService) PrepareService(ctx context.Context, name, service string) (*models.GitRepository, error) {
+	return s.serviceRepository(ctx, name, service)
+}
+
+// AdvertiseRefs отдает список ссылок репозитория для /info/refs (smart HTTP).
+// repo - результат PrepareService, protocol - значение заголовка Git-Protocol клиента
+func (s *GitService) AdvertiseRefs(ctx context.Context, repo *models.GitRepository, service, protocol string, out io.Writer) error {
+	// в protocol v2 заголовок службы не отправляется, как и в git http-backend
+	if !strings.Contains(protocol, "version=2") {
+		header := fmt.Sprintf("# service=%s\n", service)
+		if _, err := fmt.Fprintf(out, "%04x%s0000", len(header)+4, header); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", strings.TrimPrefix(service, "git-"), "--stateless-rpc", "--advertise-refs", ".")
+	cmd.Dir = repo.StoragePath
+	cmd.Env = gitServiceEnv(protocol)
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		return i18n.Errorf("ошибка выполнения %s: %w", service, err)
+	}
+	return nil
+}
+
+// ServiceRPC выполняет git-upload-pack или git-receive-pack, передавая тело запроса на stdin
+// и ответ службы клиенту без буферизации. repo - результат PrepareService
+func (s *GitService) ServiceRPC(ctx context.Context, repo *models.GitRepository, service, protocol string, in io.Reader, out io.Writer) error {
+	request := &packRequestReader{reader: in}
+	response := &countingWriter{writer: out}
+
+	cmd := exec.CommandContext(ctx, "git", strings.TrimPrefix(service, "git-"), "--stateless-rpc", ".")
+	cmd.Dir = repo.StoragePath
+	cmd.Env = gitServiceEnv(protocol)
+	cmd.Stdin = request
+	cmd.Stdout = response
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return i18n.Errorf("ошибка выполнения %s: %w: %s", service, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if service == "git-receive-pack" {
+		repo.UpdatedAt = time.Now()
+		if err := db.DB.Model(repo).Update("updated_at", repo.UpdatedAt).Error; err != nil {
+			i18n.Logf("Ошибка обновления записи репозитория %s: %v", repo.Name, err)
+		}
+		i18n.Logf("Выполнен push в Git репозиторий %s", repo.Name)
+	}
+
+	// клон или fetch завершается запросом с done, остальные запросы upload-pack -
+	// список ссылок (protocol v2) и раунды согласования общих коммитов
+	if service == "git-upload-pack" && request.done {
+		trackDownload(downloadEvent{
+			repoType:     FormatGit,
+			repositoryID: repo.ID,
+			name:         repo.Name,
+			bytes:        response.written,
+		})
+	}
+	return nil
+}
+
+// packDoneLine - pkt-line, которым клиент завершает согласование и запрашивает packfile
+const packDoneLine = "0009done\n"
+
+// packRequestReader передает тело запроса upload-pack и отмечает, содержит ли оно done
+type packRequestReader struct {
+	reader io.Reader
+	tail   []byte
+	done   bool
+}
+
+func (r *packRequestReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && !r.done {
+		// хвост предыдущего чтения нужен, если pkt-line разрезан между чтениями
+		data := append(r.tail, p[:n]...)
+		r.done = bytes.Contains(data, []byte(packDoneLine))
+		if len(data) > len(packDoneLine) {
+			data = data[len(data)-len(packDoneLine):]
+		}
+		r.tail = append(r.tail[:0], data...)
+	}
+	return n, err
+}
+
+// countingWriter считает объем ответа, отправленного клиенту
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func gitServiceEnv(protocol string) []string {
+	env := os.Environ()
+	if protocol != "" {
+		env = append(env, "GIT_PROTOCOL="+protocol)
+	}
+	return env
+}
+
+var gitProgressPattern = regexp.MustCompile(`^(Receiving objects|Resolving deltas):\s+(\d+)%`)
+
+// runGitCommand выполняет команду git с --progress, передавая ее вывод в журнал задачи.
+// Получение объектов соответствует 0-90% прогресса задачи, разрешение дельт - 90-100%.
+func runGitCommand(cmd *exec.Cmd, run *TaskRun) error {
+	// git запускает дочерние процессы (git-remote-http), которые держат вывод открытым
+	// и после отмены команды, поэтому ожидание вывода ограничено
+	cmd.WaitDelay = 5 * time.Second
+	reader, writer := io.Pipe()
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		return err
 	}
 
-	log.Printf("Удалена ветка %s в репозитории %s", branchName, repoName)
+	var lastLine string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(scanGitOutput)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			lastLine = line
+
+			if match := gitProgressPattern.FindStringSubmatch(line); match != nil {
+				percent, _ := strconv.Atoi(match[2])
+				if match[1] == "Receiving objects" {
+					run.SetProgress(percent * 9 / 10)
+				} else {
+					run.SetProgress(90 + percent/10)
+				}
+			}
+
+			// промежуточные строки индикаторов в журнал не пишутся
+			if strings.Contains(line, "%") && !strings.HasSuffix(line, "done.") {
+				continue
+			}
+			run.Logf("%s", line)
+		}
+		io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Wait()
+	writer.Close()
+	<-done
+	if err != nil {
+		if lastLine != "" {
+			return i18n.Errorf("%w: %s", err, lastLine)
+		}
+		return err
+	}
 	return nil
 }
+
+// scanGitOutput разбивает вывод git на строки: индикаторы прогресса обновляются через \r
+func scanGitOutput(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
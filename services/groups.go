@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"gorm.io/gorm"
+)
+
+// Форматы репозиториев. Участники группы всегда того же формата, что и группа,
+// формат хранится в GroupMember.MemberType, так как ID репозиториев разных форматов пересекаются.
+const (
+	FormatDocker = "docker"
+	FormatGit    = "git"
+	FormatHelm   = "helm"
+)
+
+var (
+	ErrNotGroup           = newError(ErrInvalid, "NOT_GROUP", "репозиторий не является группой")
+	ErrGroupMemberInvalid = newError(ErrInvalid, "GROUP_MEMBER_INVALID", "недопустимый участник группы")
+)
+
+// GroupMemberSpec - участник группы в запросе на изменение ее состава.
+// Чем меньше Priority, тем раньше участник опрашивается при поиске артефакта.
+type GroupMemberSpec struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+}
+
+type GroupService struct{}
+
+func repositoryModel(format string) (interface{}, error) {
+	switch format {
+	case FormatDocker:
+		return &models.DockerRepository{}, nil
+	case FormatGit:
+		return &models.GitRepository{}, nil
+	case FormatHelm:
+		return &models.HelmRepository{}, nil
+	}
+	return nil, i18n.Errorf("неизвестный формат репозитория: %s", format)
+}
+
+func findBaseRepository(format, name string) (*models.BaseRepository, error) {
+	model, err := repositoryModel(format)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo models.BaseRepository
+	if err := db.DB.Model(model).Where("name = ?", name).Take(&repo).Error; err != nil {
+		return nil, repositoryLookupError(name, err)
+	}
+	return &repo, nil
+}
+
+// getGroup находит группу и проверяет право action на нее
+func (s *GroupService) getGroup(ctx context.Context, format, name, action string) (*models.BaseRepository, error) {
+	group, err := findBaseRepository(format, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorize(ctx, format, group, action); err != nil {
+		return nil, err
+	}
+
+	if group.Type != models.TypeGroup {
+		return nil, i18n.Errorf("%w: %s", ErrNotGroup, name)
+	}
+	return group, nil
+}
+
+// groupMembers возвращает участников группы в порядке приоритета
+func groupMembers(format string, groupID int) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	err := db.DB.Where("group_id = ? AND member_type = ?", groupID, format).
+		Order("priority, id").
+		Find(&members).Error
+	if err != nil {
+		return nil, i18n.Errorf("ошибка получения участников группы: %w", err)
+	}
+	return members, nil
+}
+
+// newMember проверяет участника и строит запись о нем. Вложенные группы не допускаются,
+// чтобы поиск артефакта не зацикливался. Включить репозиторий в группу можно, только
+// имея право чтения на него: группа отдает артефакты участников без проверки прав на них.
+func newMember(ctx context.Context, format string, groupName string, groupID int, spec GroupMemberSpec) (*models.GroupMember, error) {
+	if spec.Name == groupName {
+		return nil, i18n.Errorf("%w: группа не может входить в саму себя", ErrGroupMemberInvalid)
+	}
+
+	member, err := findBaseRepository(format, spec.Name)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return nil, i18n.Errorf("%w: репозиторий %s не найден", ErrGroupMemberInvalid, spec.Name)
+		}
+		return nil, err
+	}
+
+	if member.Type == models.TypeGroup {
+		return nil, i18n.Errorf("%w: %s является группой", ErrGroupMemberInvalid, spec.Name)
+	}
+
+	if err := authorize(ctx, format, member, ActionRead); err != nil {
+		return nil, err
+	}
+
+	return &models.GroupMember{
+		GroupID:    groupID,
+		MemberID:   member.ID,
+		MemberName: member.Name,
+		MemberType: format,
+		Priority:   spec.Priority,
+	}, nil
+}
+
+// ValidateMembers проверяет список участников до создания группы
+func (s *GroupService) ValidateMembers(ctx context.Context, format, groupName string, specs []GroupMemberSpec) error {
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		if seen[spec.Name] {
+			return i18n.Errorf("%w: %s указан дважды", ErrGroupMemberInvalid, spec.Name)
+		}
+		seen[spec.Name] = true
+
+		if _, err := newMember(ctx, format, groupName, 0, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveMembers сохраняет участников группы в транзакции tx
+func saveMembers(ctx context.Context, tx *gorm.DB, format, groupName string, groupID int, specs []GroupMemberSpec) error {
+	for _, spec := range specs {
+		member, err := newMember(ctx, format, groupName, groupID, spec)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return i18n.Errorf("ошибка сохранения участника группы: %w", err)
+		}
+	}
+	return nil
+}
+
+// createRepositoryRecord сохраняет запись нового репозитория repo, base - его BaseRepository.
+// Участники группы сохраняются в той же транзакции, поэтому при ошибке в их составе группа не
+// создается; для остальных типов members не используется.
+func createRepositoryRecord(ctx context.Context, format string, repo interface{}, base *models.BaseRepository, members []GroupMemberSpec) error {
+	if base.Type != models.TypeGroup {
+		members = nil
+	}
+	if err := (&GroupService{}).ValidateMembers(ctx, format, base.Name, members); err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(repo).Error; err != nil {
+			return i18n.Errorf("ошибка сохранения репозитория: %w", err)
+		}
+		return saveMembers(ctx, tx, format, base.Name, base.ID, members)
+	})
+}
+
+func (s *GroupService) ListMembers(ctx context.Context, format, groupName string) ([]models.GroupMember, error) {
+	group, err := s.getGroup(ctx, format, groupName, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+	return groupMembers(format, group.ID)
+}
+
+// SetMembers заменяет состав группы целиком
+func (s *GroupService) SetMembers(ctx context.Context, format, groupName string, specs []GroupMemberSpec) error {
+	group, err := s.getGroup(ctx, format, groupName, ActionAdmin)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ValidateMembers(ctx, format, groupName, specs); err != nil {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND member_type = ?", group.ID, format).Delete(&models.GroupMember{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления участников группы: %w", err)
+		}
+		return saveMembers(ctx, tx, format, groupName, group.ID, specs)
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == FormatHelm {
+		helmIndexes.Changed()
+	}
+
+	i18n.Logf("Обновлен состав группы %s (%s): %d участников", groupName, format, len(specs))
+	return nil
+}
+
+// AddMember добавляет участника в группу
+func (s *GroupService) AddMember(ctx context.Context, format, groupName string, spec GroupMemberSpec) error {
+	group, err := s.getGroup(ctx, format, groupName, ActionAdmin)
+	if err != nil {
+		return err
+	}
+
+	member, err := newMember(ctx, format, groupName, group.ID, spec)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	db.DB.Model(&models.GroupMember{}).
+		Where("group_id = ? AND member_type = ? AND member_id = ?", group.ID, format, member.MemberID).
+		Count(&count)
+	if count > 0 {
+		return i18n.Errorf("%w: %s уже входит в группу", ErrGroupMemberInvalid, spec.Name)
+	}
+
+	if err := db.DB.Create(member).Error; err != nil {
+		return i18n.Errorf("ошибка сохранения участника группы: %w", err)
+	}
+
+	if format == FormatHelm {
+		helmIndexes.Changed()
+	}
+
+	i18n.Logf("Репозиторий %s добавлен в группу %s (%s)", spec.Name, groupName, format)
+	return nil
+}
+
+// RemoveMember исключает участника из группы
+func (s *GroupService) RemoveMember(ctx context.Context, format, groupName, memberName string) error {
+	group, err := s.getGroup(ctx, format, groupName, ActionAdmin)
+	if err != nil {
+		return err
+	}
+
+	result := db.DB.Where("group_id = ? AND member_type = ? AND member_name = ?", group.ID, format, memberName).
+		Delete(&models.GroupMember{})
+	if result.Error != nil {
+		return i18n.Errorf("ошибка удаления участника группы: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return i18n.Errorf("участник %s не найден в группе %s: %w", memberName, groupName, gorm.ErrRecordNotFound)
+	}
+
+	if format == FormatHelm {
+		helmIndexes.Changed()
+	}
+
+	i18n.Logf("Репозиторий %s исключен из группы %s (%s)", memberName, groupName, format)
+	return nil
+}
@@ -1,42 +1,60 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Viste/larets/config"
 	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
 	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"gorm.io/gorm"
 	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"time"
 )
 
 type HelmService struct{}
 
-func (s *HelmService) CreateRepository(name, description string, repoType models.RepositoryType, url string) error {
+// helmUpstreamClient - клиент удаленных Helm репозиториев. Запросы выполняются с контекстом
+// HTTP запроса или задачи, таймаут ограничивает зависшие соединения с удаленным репозиторием.
+var helmUpstreamClient = &http.Client{Timeout: 10 * time.Minute}
+
+// CreateRepository создает Helm репозиторий. Индекс прокси-репозитория загружается в фоновой
+// задаче синхронизации, которая и возвращается; для остальных типов задача равна nil. Группа
+// создается сразу с участниками members.
+func (s *HelmService) CreateRepository(ctx context.Context, name, description string, repoType models.RepositoryType, url string, anonymousRead bool, members []GroupMemberSpec) (*models.Task, error) {
+	if err := authorizeName(ctx, FormatHelm, name, ActionAdmin); err != nil {
+		return nil, err
+	}
+
 	var count int64
 	db.DB.Model(&models.HelmRepository{}).Where("name = ?", name).Count(&count)
 	if count > 0 {
-		return errors.New("репозиторий с таким именем уже существует")
+		return nil, i18n.Errorf("%w: %s", ErrRepositoryExists, name)
 	}
 
 	storagePath := filepath.Join(config.Config.HelmStorage, name)
 	if err := os.MkdirAll(storagePath, 0755); err != nil {
-		return fmt.Errorf("ошибка создания директории хранилища: %w", err)
+		return nil, i18n.Errorf("ошибка создания директории хранилища: %w", err)
 	}
 
 	repo := models.HelmRepository{
 		BaseRepository: models.BaseRepository{
-			Name:        name,
-			Description: description,
-			Type:        repoType,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
+			Name:          name,
+			Description:   description,
+			Type:          repoType,
+			AnonymousRead: anonymousRead,
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
 		},
 		URL:          url,
 		IndexPath:    "index.yaml",
@@ -45,320 +63,703 @@ func (s *HelmService) CreateRepository(name, description string, repoType models
 		StoragePath:  storagePath,
 	}
 
-	if err := db.DB.Create(&repo).Error; err != nil {
+	if err := createRepositoryRecord(ctx, FormatHelm, &repo, &repo.BaseRepository, members); err != nil {
 		os.RemoveAll(storagePath)
-		return fmt.Errorf("ошибка сохранения репозитория: %w", err)
+		return nil, err
 	}
 
-	if repoType == models.TypeHosted {
-		indexPath := filepath.Join(storagePath, "index.yaml")
-		// пустой index.yaml с базовой структурой
-		indexContent := `apiVersion: v1
-entries: {}
-generated: "%s"
-`
-		// RFC3339
-		indexContent = fmt.Sprintf(indexContent, time.Now().Format(time.RFC3339))
-
-		if err := ioutil.WriteFile(indexPath, []byte(indexContent), 0644); err != nil {
-			db.DB.Delete(&repo)
-			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка создания индексного файла: %w", err)
-		}
-	} else if repoType == models.TypeProxy && url != "" {
-		indexURL := fmt.Sprintf("%s/index.yaml", url)
-		resp, err := http.Get(indexURL)
+	// index.yaml хостового репозитория формируется из записей чартов при запросе,
+	// индекс прокси-репозитория загружается из удаленного репозитория в фоновой задаче
+	if repoType == models.TypeProxy && url != "" {
+		task, err := submitTask(ctx, models.Task{
+			Type:           TaskSync,
+			RepoType:       FormatHelm,
+			RepositoryID:   repo.ID,
+			RepositoryName: repo.Name,
+		}, nil)
 		if err != nil {
 			db.DB.Delete(&repo)
 			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка получения индексного файла: %w", err)
+			return nil, err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			db.DB.Delete(&repo)
-			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка получения индексного файла, код ответа: %d", resp.StatusCode)
-		}
+		i18n.Logf("Создан Helm репозиторий: %s, тип: %s, загрузка индекса в задаче %d", name, repoType, task.ID)
+		return task, nil
+	}
 
-		indexPath := filepath.Join(storagePath, "index.yaml")
-		indexFile, err := os.Create(indexPath)
-		if err != nil {
-			db.DB.Delete(&repo)
-			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка создания индексного файла: %w", err)
-		}
-		defer indexFile.Close()
+	i18n.Logf("Создан Helm репозиторий: %s, тип: %s", name, repoType)
+	return nil, nil
+}
 
-		if _, err := io.Copy(indexFile, resp.Body); err != nil {
-			db.DB.Delete(&repo)
-			os.RemoveAll(storagePath)
-			return fmt.Errorf("ошибка записи индексного файла: %w", err)
+// ListRepositories возвращает репозитории, доступные пользователю на чтение
+func (s *HelmService) ListRepositories(ctx context.Context) ([]models.HelmRepository, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []models.HelmRepository
+	if err := db.DB.Find(&repos).Error; err != nil {
+		return nil, err
+	}
+
+	readable := repos[:0]
+	for _, repo := range repos {
+		if scope.check(FormatHelm, &repo.BaseRepository, ActionRead) == nil {
+			readable = append(readable, repo)
 		}
 	}
+	return readable, nil
+}
 
-	log.Printf("Создан Helm репозиторий: %s, тип: %s", name, repoType)
-	return nil
+func (s *HelmService) GetRepository(ctx context.Context, name string) (*models.HelmRepository, error) {
+	return s.getRepositoryFor(ctx, name, ActionRead)
 }
 
-func (s *HelmService) ListRepositories() ([]models.HelmRepository, error) {
-	var repos []models.HelmRepository
-	err := db.DB.Find(&repos).Error
-	return repos, err
+// getRepositoryFor находит репозиторий и проверяет право action на него
+func (s *HelmService) getRepositoryFor(ctx context.Context, name, action string) (*models.HelmRepository, error) {
+	repo, err := s.getRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, FormatHelm, &repo.BaseRepository, action); err != nil {
+		return nil, err
+	}
+	return repo, nil
 }
 
-func (s *HelmService) GetRepository(name string) (*models.HelmRepository, error) {
+func (s *HelmService) getRepository(name string) (*models.HelmRepository, error) {
 	var repo models.HelmRepository
 	err := db.DB.Where("name = ?", name).First(&repo).Error
 	if err != nil {
-		return nil, fmt.Errorf("репозиторий не найден: %w", err)
+		return nil, repositoryLookupError(name, err)
 	}
 	return &repo, nil
 }
 
-func (s *HelmService) UploadChart(repoName string, chartData io.Reader, filename string) error {
-	repo, err := s.GetRepository(repoName)
+// DeleteRepository удаляет Helm репозиторий вместе с записями чартов, участием в группах
+// и файлами на диске. В режиме dryRun ничего не удаляется, а возвращается отчет о том, что будет удалено.
+func (s *HelmService) DeleteRepository(ctx context.Context, name string, dryRun, force bool) (*DeleteReport, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := newDeleteReport(FormatHelm, &repo.BaseRepository, repo.StoragePath, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	var chartIDs []int
+	db.DB.Model(&models.HelmChart{}).Where("repository_id = ?", repo.ID).Pluck("id", &chartIDs)
+	report.Artifacts = int64(len(chartIDs))
+	if len(chartIDs) > 0 {
+		db.DB.Model(&models.StoredFile{}).Where("artifact_id IN ? AND repo_type = ?", chartIDs, "helm").Count(&report.StoredFiles)
+	}
+
+	if err := report.checkGroupMembership(force); err != nil || dryRun {
+		return report, err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if len(chartIDs) > 0 {
+			if err := tx.Where("artifact_id IN ? AND repo_type = ?", chartIDs, "helm").Delete(&models.StoredFile{}).Error; err != nil {
+				return i18n.Errorf("ошибка удаления записей файлов: %w", err)
+			}
+		}
+		if err := tx.Where("repository_id = ?", repo.ID).Delete(&models.HelmChart{}).Error; err != nil {
+			return i18n.Errorf("ошибка удаления записей чартов: %w", err)
+		}
+		if err := deleteRepositoryRecords(tx, FormatHelm, repo.ID); err != nil {
+			return err
+		}
+		return tx.Delete(repo).Error
+	})
+	if err != nil {
+		return nil, i18n.Errorf("ошибка удаления репозитория: %w", err)
+	}
+
+	helmIndexes.Forget(repo.ID)
+	if repo.StoragePath != "" {
+		removeObjects(ctx, chartKey(repo.StoragePath, "")+"/")
+		if repo.Type == models.TypeProxy {
+			storage.Store.Delete(ctx, indexKey(repo.StoragePath, repo.IndexPath))
+		}
+	}
+	removeStorage(config.Config.HelmStorage, repo.StoragePath)
+
+	i18n.Logf("Удален Helm репозиторий %s: чартов %d", name, report.Artifacts)
+	return report, nil
+}
+
+// UpdateRepository изменяет настройки Helm репозитория. При смене URL или IndexPath
+// прокси-репозитория индекс заново загружается из удаленного репозитория в фоновой задаче,
+// которая и возвращается; в остальных случаях задача равна nil.
+func (s *HelmService) UpdateRepository(ctx context.Context, name string, update RepositoryUpdate) (*models.HelmRepository, *models.Task, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionAdmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := update.validate(FormatHelm, repo.Type); err != nil {
+		return nil, nil, err
+	}
+
+	refetch := repo.Type == models.TypeProxy &&
+		((update.URL != nil && *update.URL != repo.URL) || (update.IndexPath != nil && *update.IndexPath != repo.IndexPath))
+	if refetch {
+		// ожидающая синхронизация прочитает новые настройки при запуске, а выполняемая - уже нет
+		active, err := activeTask(TaskSync, FormatHelm, repo.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if active != nil && active.Status == TaskStatusRunning {
+			return nil, nil, i18n.Errorf("%w: синхронизация (задача %d)", ErrTaskActive, active.ID)
+		}
+	}
+
+	oldIndexKey := indexKey(repo.StoragePath, repo.IndexPath)
+	update.applyBase(&repo.BaseRepository)
+	if update.URL != nil {
+		repo.URL = *update.URL
+	}
+	if update.IndexPath != nil {
+		repo.IndexPath = *update.IndexPath
+	}
+	if update.CacheEnabled != nil {
+		repo.CacheEnabled = *update.CacheEnabled
+	}
+	if update.CacheTTL != nil {
+		repo.CacheTTL = *update.CacheTTL
+	}
+
+	if err := db.DB.Save(repo).Error; err != nil {
+		return nil, nil, i18n.Errorf("ошибка сохранения репозитория: %w", err)
+	}
+	helmIndexes.Forget(repo.ID)
+	if newIndexKey := indexKey(repo.StoragePath, repo.IndexPath); repo.Type == models.TypeProxy && newIndexKey != oldIndexKey {
+		// индекс по новому пути загрузит задача синхронизации
+		if err := storage.Store.Delete(ctx, oldIndexKey); err != nil {
+			i18n.Logf("Ошибка удаления объекта %s: %v", oldIndexKey, err)
+		}
+	}
+
+	if !refetch {
+		i18n.Logf("Изменены настройки Helm репозитория %s", name)
+		return repo, nil, nil
+	}
+
+	task, err := submitTask(ctx, models.Task{
+		Type:           TaskSync,
+		RepoType:       FormatHelm,
+		RepositoryID:   repo.ID,
+		RepositoryName: repo.Name,
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i18n.Logf("Изменены настройки Helm репозитория %s, загрузка индекса в задаче %d", name, task.ID)
+	return repo, task, nil
+}
+
+func (s *HelmService) UploadChart(ctx context.Context, repoName string, chartData io.Reader, filename string) error {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionWrite)
 	if err != nil {
 		return err
 	}
 
 	if repo.Type != models.TypeHosted {
-		return errors.New("нельзя загружать чарты в репозиторий, который не является хостовым")
+		return i18n.Errorf("%w: нельзя загружать чарты в репозиторий %s", ErrRepositoryNotHosted, repo.Name)
 	}
 
-	tempDir, err := ioutil.TempDir(config.Config.TempStorage, "helm-chart-")
+	tempDir, err := os.MkdirTemp(config.Config.TempStorage, "helm-chart-")
 	if err != nil {
-		return fmt.Errorf("ошибка создания временной директории: %w", err)
+		return i18n.Errorf("ошибка создания временной директории: %w", err)
 	}
 	defer os.RemoveAll(tempDir)
 
-	tempChartPath := filepath.Join(tempDir, filename)
+	tempChartPath := filepath.Join(tempDir, "chart.tgz")
 	tempChartFile, err := os.Create(tempChartPath)
 	if err != nil {
-		return fmt.Errorf("ошибка создания временного файла: %w", err)
+		return i18n.Errorf("ошибка создания временного файла: %w", err)
 	}
-	defer tempChartFile.Close()
 
-	size, err := io.Copy(tempChartFile, chartData)
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempChartFile, hasher), chartData)
+	tempChartFile.Close()
 	if err != nil {
-		return fmt.Errorf("ошибка записи данных чарта: %w", err)
+		return i18n.Errorf("ошибка записи данных чарта: %w", err)
 	}
+	digest := hex.EncodeToString(hasher.Sum(nil))
 
-	chartsDir := filepath.Join(repo.StoragePath, "charts")
-	if err := os.MkdirAll(chartsDir, 0755); err != nil {
-		return fmt.Errorf("ошибка создания директории чартов: %w", err)
+	metadata, err := ParseChartArchive(tempChartPath)
+	if err != nil {
+		return err
 	}
 
-	chartPath := filepath.Join(chartsDir, filename)
-	if err := copyFile(tempChartPath, chartPath); err != nil {
-		return fmt.Errorf("ошибка копирования чарта в хранилище: %w", err)
+	chartFileName := ChartFileName(metadata.Name, metadata.Version)
+	if filename != chartFileName {
+		return i18n.Errorf("%w: имя файла %s не соответствует Chart.yaml, ожидалось %s", ErrChartInvalid, filename, chartFileName)
 	}
 
-	indexPath := filepath.Join(repo.StoragePath, repo.IndexPath)
-	cmd := exec.Command("helm", "repo", "index", chartsDir, "--url", config.Config.BaseURL+"/helm/"+repoName+"/charts", "--merge", indexPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ошибка обновления индекса репозитория: %w", err)
+	var count int64
+	err = db.DB.Model(&models.HelmChart{}).
+		Where("repository_id = ? AND name = ? AND version = ?", repo.ID, metadata.Name, metadata.Version).
+		Count(&count).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения записи чарта: %w", err)
+	}
+	if count > 0 {
+		return i18n.Errorf("%w: %s версии %s", ErrChartExists, metadata.Name, metadata.Version)
 	}
 
-	// example получаем информацию о чарте
-	// для этого нужно распаковать архив и прочитать Chart.yaml
-	chartName := filepath.Base(filename)
-	chartName = chartName[:len(chartName)-len(filepath.Ext(chartName))]
-	chartVersion := "0.1.0" // todo извлечь из Chart.yaml
-
+	key := chartKey(repo.StoragePath, chartFileName)
 	chartRecord := models.HelmChart{
 		Artifact: models.Artifact{
 			RepositoryID:  repo.ID,
 			RepoType:      "helm",
-			Name:          chartName,
-			Version:       chartVersion,
-			Path:          chartPath,
+			Path:          key,
 			Size:          size,
+			SHA256:        digest,
 			CreatedAt:     time.Now(),
 			UpdatedAt:     time.Now(),
 			DownloadCount: 0,
 		},
-		AppVersion:  "1.0.0",          // todo извлечь из Chart.yaml
-		Description: "Uploaded chart", // todo извлечь из Chart.yaml
+	}
+	if err := fillChartRecord(&chartRecord, metadata); err != nil {
+		return err
 	}
 
-	if err := db.DB.Create(&chartRecord).Error; err != nil {
-		return fmt.Errorf("ошибка сохранения записи чарта: %w", err)
+	// запись создается до сохранения архива: конкурентная загрузка той же версии
+	// упирается в уникальный индекс и не перезаписывает уже загруженный архив
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&chartRecord).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return i18n.Errorf("%w: %s версии %s", ErrChartExists, metadata.Name, metadata.Version)
+			}
+			return i18n.Errorf("ошибка сохранения записи чарта: %w", err)
+		}
+		if err := storage.Store.PutFile(ctx, key, tempChartPath); err != nil {
+			return i18n.Errorf("ошибка сохранения чарта в хранилище: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	helmIndexes.Add(repo, &chartRecord)
 
-	log.Printf("Загружен Helm чарт: %s в репозиторий %s", filename, repoName)
+	i18n.Logf("Загружен Helm чарт: %s в репозиторий %s", filename, repoName)
 	return nil
 }
 
-func (s *HelmService) SyncRepository(name string) error {
-	repo, err := s.GetRepository(name)
+// DeleteChart удаляет версию чарта из репозитория и из его индекса.
+// Для прокси-репозитория удаляется только кешированная копия.
+func (s *HelmService) DeleteChart(ctx context.Context, repoName, chartName, version string) error {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionDelete)
 	if err != nil {
 		return err
 	}
 
-	if repo.Type != models.TypeProxy {
-		return errors.New("репозиторий не является прокси")
+	var chart models.HelmChart
+	err = db.DB.Where("repository_id = ? AND name = ? AND version = ?", repo.ID, chartName, version).First(&chart).Error
+	if err != nil {
+		return i18n.Errorf("чарт не найден: %w", err)
 	}
 
-	if repo.URL == "" {
-		return errors.New("URL удаленного репозитория не указан")
+	if err := db.DB.Delete(&chart).Error; err != nil {
+		return i18n.Errorf("ошибка удаления записи чарта: %w", err)
 	}
 
-	log.Printf("Синхронизация Helm репозитория %s с удаленным источником %s", name, repo.URL)
+	key := chartKey(repo.StoragePath, ChartFileName(chartName, version))
+	if err := storage.Store.Delete(ctx, key); err != nil {
+		i18n.Logf("Ошибка удаления архива чарта %s: %v", key, err)
+	}
 
-	indexURL := fmt.Sprintf("%s/index.yaml", repo.URL)
-	resp, err := http.Get(indexURL)
+	if repo.Type == models.TypeHosted {
+		helmIndexes.Remove(repo, chartName, version)
+	}
+
+	i18n.Logf("Удален Helm чарт %s-%s из репозитория %s", chartName, version, repoName)
+	return nil
+}
+
+// GetIndex возвращает index.yaml репозитория: для хостового он формируется из записей чартов,
+// для прокси отдается сохраненный индекс удаленного репозитория
+func (s *HelmService) GetIndex(ctx context.Context, repoName string) ([]byte, error) {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionRead)
 	if err != nil {
-		return fmt.Errorf("ошибка получения индексного файла: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ошибка получения индексного файла, код ответа: %d", resp.StatusCode)
+	switch repo.Type {
+	case models.TypeHosted:
+		return helmIndexes.Get(repo)
+	case models.TypeGroup:
+		return helmIndexes.Group(repo)
 	}
 
-	indexPath := filepath.Join(repo.StoragePath, repo.IndexPath)
-	indexFile, err := os.Create(indexPath)
+	return readProxyIndex(ctx, repo)
+}
+
+// fillChartRecord заполняет поля записи чарта из Chart.yaml
+func fillChartRecord(chart *models.HelmChart, metadata *ChartMetadata) error {
+	chart.Name = metadata.Name
+	chart.Version = metadata.Version
+	chart.AppVersion = metadata.AppVersion
+	chart.Description = metadata.Description
+	chart.Keywords = metadata.Keywords
+
+	dependencies, err := json.Marshal(metadata.Dependencies)
+	if err != nil {
+		return i18n.Errorf("ошибка сериализации зависимостей чарта: %w", err)
+	}
+	chart.Dependencies = dependencies
+
+	content, err := json.Marshal(metadata)
 	if err != nil {
-		return fmt.Errorf("ошибка создания индексного файла: %w", err)
+		return i18n.Errorf("ошибка сериализации метаданных чарта: %w", err)
 	}
-	defer indexFile.Close()
+	chart.Metadata = content
+	return nil
+}
 
-	if _, err := io.Copy(indexFile, resp.Body); err != nil {
-		return fmt.Errorf("ошибка записи индексного файла: %w", err)
+// SyncRepository ставит в очередь задачу загрузки индекса прокси-репозитория из удаленного источника
+func (s *HelmService) SyncRepository(ctx context.Context, name string) (*models.Task, error) {
+	repo, err := s.getRepositoryFor(ctx, name, ActionWrite)
+	if err != nil {
+		return nil, err
 	}
 
+	if repo.Type != models.TypeProxy {
+		return nil, i18n.Errorf("%w: %s", ErrRepositoryNotProxy, repo.Name)
+	}
+
+	if repo.URL == "" {
+		return nil, i18n.Errorf("%w: %s", ErrRemoteURLMissing, repo.Name)
+	}
+
+	return submitTask(ctx, models.Task{
+		Type:           TaskSync,
+		RepoType:       FormatHelm,
+		RepositoryID:   repo.ID,
+		RepositoryName: repo.Name,
+	}, nil)
+}
+
+// syncRepository выполняет задачу синхронизации: загружает index.yaml удаленного репозитория
+func (s *HelmService) syncRepository(ctx context.Context, run *TaskRun) error {
+	var repo models.HelmRepository
+	if err := db.DB.First(&repo, run.Task.RepositoryID).Error; err != nil {
+		return i18n.Errorf("репозиторий не найден: %w", err)
+	}
+
+	i18n.Logf("Синхронизация Helm репозитория %s с удаленным источником %s", repo.Name, repo.URL)
+	run.Logf("Загрузка %s/index.yaml", repo.URL)
+
+	if err := downloadProxyIndex(ctx, &repo); err != nil {
+		return err
+	}
+
+	helmIndexes.Changed()
+
 	repo.UpdatedAt = time.Now()
-	if err := db.DB.Save(repo).Error; err != nil {
-		return fmt.Errorf("ошибка обновления записи репозитория: %w", err)
+	if err := db.DB.Save(&repo).Error; err != nil {
+		return i18n.Errorf("ошибка обновления записи репозитория: %w", err)
+	}
+
+	i18n.Logf("Helm репозиторий %s успешно синхронизирован", repo.Name)
+	return nil
+}
+
+// downloadProxyIndex загружает index.yaml удаленного репозитория в хранилище артефактов
+func downloadProxyIndex(ctx context.Context, repo *models.HelmRepository) error {
+	indexURL := fmt.Sprintf("%s/index.yaml", repo.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, indexURL, nil)
+	if err != nil {
+		return i18n.Errorf("ошибка создания запроса: %w", err)
+	}
+	resp, err := helmUpstreamClient.Do(req)
+	if err != nil {
+		metrics.UpstreamError(FormatHelm, repo.Name)
+		return i18n.Errorf("ошибка получения индексного файла: %w", err)
 	}
+	defer resp.Body.Close()
 
-	log.Printf("Helm репозиторий %s успешно синхронизирован", name)
+	if resp.StatusCode != http.StatusOK {
+		metrics.UpstreamError(FormatHelm, repo.Name)
+		return i18n.Errorf("ошибка получения индексного файла, код ответа: %d", resp.StatusCode)
+	}
+
+	// хранилище заменяет объект целиком, поэтому ошибка загрузки не портит текущий индекс
+	if err := storage.Store.Put(ctx, indexKey(repo.StoragePath, repo.IndexPath), resp.Body, resp.ContentLength); err != nil {
+		return i18n.Errorf("ошибка сохранения индексного файла: %w", err)
+	}
 	return nil
 }
 
-func (s *HelmService) FetchChartFromProxy(repoName, chartName, version string) (string, error) {
-	repo, err := s.GetRepository(repoName)
+// readProxyIndex читает сохраненный index.yaml прокси-репозитория из хранилища артефактов
+func readProxyIndex(ctx context.Context, repo *models.HelmRepository) ([]byte, error) {
+	reader, _, err := storage.Store.Open(ctx, indexKey(repo.StoragePath, repo.IndexPath))
 	if err != nil {
-		return "", err
+		// индекс загружается задачей синхронизации после создания репозитория
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, i18n.Errorf("%w: %s", ErrIndexNotFound, repo.Name)
+		}
+		return nil, i18n.Errorf("ошибка чтения индексного файла: %w", err)
 	}
+	defer reader.Close()
 
-	if repo.Type != models.TypeProxy {
-		return "", errors.New("репозиторий не является прокси")
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, i18n.Errorf("ошибка чтения индексного файла: %w", err)
 	}
+	return content, nil
+}
 
-	chartsDir := filepath.Join(repo.StoragePath, "charts")
-	if err := os.MkdirAll(chartsDir, 0755); err != nil {
-		return "", fmt.Errorf("ошибка создания директории чартов: %w", err)
+func (s *HelmService) FetchChartFromProxy(ctx context.Context, repoName, chartName, version string) (storage.Info, error) {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionRead)
+	if err != nil {
+		return storage.Info{}, err
 	}
 
-	chartFileName := fmt.Sprintf("%s-%s.tgz", chartName, version)
-	chartPath := filepath.Join(chartsDir, chartFileName)
+	if repo.Type != models.TypeProxy {
+		return storage.Info{}, i18n.Errorf("%w: %s", ErrRepositoryNotProxy, repo.Name)
+	}
+
+	chartFileName := ChartFileName(chartName, version)
+	key := chartKey(repo.StoragePath, chartFileName)
 
 	if repo.CacheEnabled {
-		info, err := os.Stat(chartPath)
+		info, err := storage.Store.Stat(ctx, key)
 		if err == nil {
-			modTime := info.ModTime()
 			cacheDuration := time.Duration(repo.CacheTTL) * time.Minute
-			if time.Since(modTime) < cacheDuration {
-				log.Printf("Используем кешированный чарт: %s-%s", chartName, version)
-				return chartPath, nil
+			if time.Since(info.ModTime) < cacheDuration {
+				i18n.Logf("Используем кешированный чарт: %s-%s", chartName, version)
+				metrics.ProxyCache(FormatHelm, repo.Name, metrics.CacheHit)
+				return info, nil
 			}
 		}
 	}
 
-	log.Printf("Получение чарта %s-%s из удаленного репозитория %s", chartName, version, repo.URL)
+	i18n.Logf("Получение чарта %s-%s из удаленного репозитория %s", chartName, version, repo.URL)
+	metrics.ProxyCache(FormatHelm, repo.Name, metrics.CacheMiss)
 
-	chartURL := fmt.Sprintf("%s/charts/%s", repo.URL, chartFileName)
-	resp, err := http.Get(chartURL)
+	// адрес архива берется из индекса удаленного репозитория, архивы могут лежать не в /charts
+	downloadURL, expectedDigest, ok := helmIndexes.ProxyChartURL(repo, chartName, version)
+	if !ok {
+		downloadURL = fmt.Sprintf("%s/charts/%s", repo.URL, chartFileName)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return storage.Info{}, i18n.Errorf("ошибка создания запроса: %w", err)
+	}
+	resp, err := helmUpstreamClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("ошибка получения чарта: %w", err)
+		if ctx.Err() == nil {
+			metrics.UpstreamError(FormatHelm, repo.Name)
+		}
+		return storage.Info{}, i18n.Errorf("ошибка получения чарта: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return storage.Info{}, i18n.Errorf("%w: %s в удаленном репозитории", ErrChartNotFound, chartFileName)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ошибка получения чарта, код ответа: %d", resp.StatusCode)
+		metrics.UpstreamError(FormatHelm, repo.Name)
+		return storage.Info{}, i18n.Errorf("ошибка получения чарта, код ответа: %d", resp.StatusCode)
 	}
 
-	chartFile, err := os.Create(chartPath)
+	chartFile, err := os.CreateTemp(config.Config.TempStorage, "helm-chart-")
 	if err != nil {
-		return "", fmt.Errorf("ошибка создания файла чарта: %w", err)
+		return storage.Info{}, i18n.Errorf("ошибка создания файла чарта: %w", err)
 	}
-	defer chartFile.Close()
+	tempChartPath := chartFile.Name()
 
-	size, err := io.Copy(chartFile, resp.Body)
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(chartFile, hasher), resp.Body)
+	chartFile.Close()
 	if err != nil {
-		return "", fmt.Errorf("ошибка записи данных чарта: %w", err)
+		os.Remove(tempChartPath)
+		return storage.Info{}, i18n.Errorf("ошибка записи данных чарта: %w", err)
 	}
+	digest := hex.EncodeToString(hasher.Sum(nil))
 
-	chartRecord := models.HelmChart{
-		Artifact: models.Artifact{
-			RepositoryID:  repo.ID,
-			RepoType:      "helm",
-			Name:          chartName,
-			Version:       version,
-			Path:          chartPath,
-			Size:          size,
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
-			DownloadCount: 0,
-		},
-		AppVersion:  "unknown",     // todo извлечь из Chart.yaml
-		Description: "Proxy chart", // todo Chart.yaml
+	metadata, err := ParseChartArchive(tempChartPath)
+	if err != nil {
+		os.Remove(tempChartPath)
+		return storage.Info{}, err
 	}
 
-	var count int64
-	db.DB.Model(&models.HelmChart{}).
-		Joins("JOIN artifacts ON helm_charts.artifact_id = artifacts.id").
-		Where("artifacts.repository_id = ? AND artifacts.name = ? AND artifacts.version = ?",
-			repo.ID, chartName, version).
-		Count(&count)
+	if expectedDigest != "" && expectedDigest != digest {
+		os.Remove(tempChartPath)
+		metrics.UpstreamError(FormatHelm, repo.Name)
+		return storage.Info{}, i18n.Errorf("%w: sha256 архива %s не совпадает с индексом удаленного репозитория", ErrChartInvalid, chartFileName)
+	}
 
-	if count > 0 {
-		db.DB.Model(&models.HelmChart{}).
-			Joins("JOIN artifacts ON helm_charts.artifact_id = artifacts.id").
-			Where("artifacts.repository_id = ? AND artifacts.name = ? AND artifacts.version = ?",
-				repo.ID, chartName, version).
-			Updates(map[string]interface{}{
-				"updated_at": time.Now(),
-			})
-	} else {
-		if err := db.DB.Create(&chartRecord).Error; err != nil {
-			return "", fmt.Errorf("ошибка сохранения записи чарта: %w", err)
+	if metadata.Name != chartName || metadata.Version != version {
+		os.Remove(tempChartPath)
+		return storage.Info{}, i18n.Errorf("%w: удаленный репозиторий вернул чарт %s версии %s", ErrChartInvalid, metadata.Name, metadata.Version)
+	}
+
+	if err := storage.Store.PutFile(ctx, key, tempChartPath); err != nil {
+		os.Remove(tempChartPath)
+		return storage.Info{}, i18n.Errorf("ошибка сохранения чарта: %w", err)
+	}
+
+	var chartRecord models.HelmChart
+	err = db.DB.Where("repository_id = ? AND name = ? AND version = ?", repo.ID, chartName, version).
+		First(&chartRecord).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return storage.Info{}, i18n.Errorf("ошибка получения записи чарта: %w", err)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		chartRecord = models.HelmChart{
+			Artifact: models.Artifact{
+				RepositoryID:  repo.ID,
+				RepoType:      "helm",
+				CreatedAt:     time.Now(),
+				DownloadCount: 0,
+			},
+		}
+	}
+
+	chartRecord.Path = key
+	chartRecord.Size = size
+	chartRecord.SHA256 = digest
+	chartRecord.UpdatedAt = time.Now()
+	if err := fillChartRecord(&chartRecord, metadata); err != nil {
+		return storage.Info{}, err
+	}
+
+	if err := db.DB.Save(&chartRecord).Error; err != nil {
+		return storage.Info{}, i18n.Errorf("ошибка сохранения записи чарта: %w", err)
+	}
+
+	i18n.Logf("Чарт %s-%s получен из удаленного репозитория и сохранен в кеше", chartName, version)
+	return storage.Info{Key: key, Size: size, ModTime: time.Now()}, nil
+}
+
+// GetChartFile возвращает объект архива чарта в хранилище. Прокси-репозиторий при отсутствии архива в кеше
+// получает его из удаленного репозитория, группа ищет архив у участников в порядке приоритета.
+func (s *HelmService) GetChartFile(ctx context.Context, repoName, fileName string) (storage.Info, error) {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionRead)
+	if err != nil {
+		return storage.Info{}, err
+	}
+
+	chartName, version, ok := SplitChartFileName(fileName)
+	if !ok {
+		return storage.Info{}, i18n.Errorf("%w: неверное имя файла чарта %s", ErrChartNotFound, fileName)
+	}
+
+	switch repo.Type {
+	case models.TypeGroup:
+		members, err := groupMembers(FormatHelm, repo.ID)
+		if err != nil {
+			return storage.Info{}, err
 		}
+
+		for _, member := range members {
+			info, err := s.GetChartFile(withSystemAccess(ctx), member.MemberName, fileName)
+			if err == nil {
+				return info, nil
+			}
+			if !errors.Is(err, ErrChartNotFound) {
+				i18n.Logf("Ошибка получения чарта %s из репозитория %s группы %s: %v", fileName, member.MemberName, repoName, err)
+			}
+		}
+		return storage.Info{}, i18n.Errorf("%w: %s", ErrChartNotFound, fileName)
+
+	case models.TypeProxy:
+		info, err := s.FetchChartFromProxy(ctx, repoName, chartName, version)
+		if err != nil {
+			return storage.Info{}, err
+		}
+		trackChartDownload(repo, chartName, version, info.Size)
+		return info, nil
+
+	default:
+		info, err := storage.Store.Stat(ctx, chartKey(repo.StoragePath, ChartFileName(chartName, version)))
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return storage.Info{}, i18n.Errorf("%w: %s", ErrChartNotFound, fileName)
+			}
+			return storage.Info{}, i18n.Errorf("ошибка чтения чарта: %w", err)
+		}
+		trackChartDownload(repo, chartName, version, info.Size)
+		return info, nil
 	}
+}
 
-	log.Printf("Чарт %s-%s получен из удаленного репозитория и сохранен в кеше", chartName, version)
-	return chartPath, nil
+// indexKey - ключ index.yaml прокси-репозитория в хранилище артефактов: helm/<директория
+// репозитория>/<IndexPath>. В файловом хранилище это прежнее расположение индекса на диске.
+func indexKey(storagePath, indexPath string) string {
+	return path.Join("helm", filepath.Base(storagePath), filepath.ToSlash(indexPath))
 }
 
-func (s *HelmService) ListCharts(repoName string) ([]models.HelmChart, error) {
-	repo, err := s.GetRepository(repoName)
+// chartKey - ключ архива чарта в хранилище артефактов: helm/<директория репозитория>/charts/<файл>
+func chartKey(storagePath, fileName string) string {
+	return path.Join("helm", filepath.Base(storagePath), "charts", fileName)
+}
+
+// trackChartDownload учитывает скачивание архива чарта. Запись чарта находится по имени
+// и версии при сохранении статистики, чтобы не обращаться к базе при отдаче архива.
+func trackChartDownload(repo *models.HelmRepository, chartName, version string, size int64) {
+	trackDownload(downloadEvent{
+		repoType:     FormatHelm,
+		repositoryID: repo.ID,
+		name:         chartName,
+		version:      version,
+		bytes:        size,
+	})
+}
+
+func (s *HelmService) ListCharts(ctx context.Context, repoName string) ([]models.HelmChart, error) {
+	repo, err := s.getRepositoryFor(ctx, repoName, ActionRead)
 	if err != nil {
 		return nil, err
 	}
 
+	if repo.Type == models.TypeGroup {
+		return s.listGroupCharts(ctx, repo)
+	}
+
 	var charts []models.HelmChart
-	err = db.DB.Joins("JOIN artifacts ON helm_charts.artifact_id = artifacts.id").
-		Where("artifacts.repository_id = ?", repo.ID).
+	err = db.DB.Where("repository_id = ?", repo.ID).
+		Order("name, created_at").
 		Find(&charts).Error
 
 	return charts, err
 }
 
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
+// listGroupCharts объединяет чарты участников группы; одинаковые версии берутся
+// у участника с наивысшим приоритетом
+func (s *HelmService) listGroupCharts(ctx context.Context, group *models.HelmRepository) ([]models.HelmChart, error) {
+	members, err := groupMembers(FormatHelm, group.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
+	seen := make(map[string]bool)
+	var charts []models.HelmChart
+	for _, member := range members {
+		memberCharts, err := s.ListCharts(withSystemAccess(ctx), member.MemberName)
+		if err != nil {
+			i18n.Logf("Ошибка получения списка чартов репозитория %s группы %s: %v", member.MemberName, group.Name, err)
+			continue
+		}
 
-	_, err = io.Copy(destFile, sourceFile)
-	return err
+		for _, chart := range memberCharts {
+			key := ChartFileName(chart.Name, chart.Version)
+			if !seen[key] {
+				seen[key] = true
+				charts = append(charts, chart)
+			}
+		}
+	}
+	return charts, nil
 }
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/Viste/larets/i18n"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrChartInvalid  = newError(ErrInvalid, "CHART_INVALID", "архив не является корректным Helm чартом")
+	ErrChartExists   = newError(ErrConflict, "CHART_EXISTS", "чарт уже существует")
+	ErrChartNotFound = newError(ErrNotFound, "CHART_NOT_FOUND", "чарт не найден")
+	ErrIndexNotFound = newError(ErrNotFound, "INDEX_NOT_FOUND", "индекс репозитория еще не загружен")
+)
+
+// максимальный размер Chart.yaml и связанных файлов внутри архива
+const maxChartFileSize = 1 << 20
+
+var chartNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// ChartMetadata - содержимое Chart.yaml
+type ChartMetadata struct {
+	APIVersion   string             `json:"apiVersion" yaml:"apiVersion"`
+	Name         string             `json:"name" yaml:"name"`
+	Version      string             `json:"version" yaml:"version"`
+	KubeVersion  string             `json:"kubeVersion,omitempty" yaml:"kubeVersion,omitempty"`
+	Description  string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Type         string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Keywords     []string           `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Home         string             `json:"home,omitempty" yaml:"home,omitempty"`
+	Sources      []string           `json:"sources,omitempty" yaml:"sources,omitempty"`
+	Dependencies []*ChartDependency `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	Maintainers  []*ChartMaintainer `json:"maintainers,omitempty" yaml:"maintainers,omitempty"`
+	Icon         string             `json:"icon,omitempty" yaml:"icon,omitempty"`
+	AppVersion   string             `json:"appVersion,omitempty" yaml:"appVersion,omitempty"`
+	Deprecated   bool               `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Annotations  map[string]string  `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+type ChartDependency struct {
+	Name         string        `json:"name" yaml:"name"`
+	Version      string        `json:"version,omitempty" yaml:"version,omitempty"`
+	Repository   string        `json:"repository,omitempty" yaml:"repository,omitempty"`
+	Condition    string        `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Tags         []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Enabled      bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	ImportValues []interface{} `json:"import-values,omitempty" yaml:"import-values,omitempty"`
+	Alias        string        `json:"alias,omitempty" yaml:"alias,omitempty"`
+	// версия, зафиксированная в Chart.lock (requirements.lock для apiVersion v1)
+	LockedVersion string `json:"locked_version,omitempty" yaml:"-"`
+}
+
+type ChartMaintainer struct {
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+	URL   string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// chartLock - содержимое Chart.lock/requirements.lock и requirements.yaml
+type chartLock struct {
+	Dependencies []*ChartDependency `yaml:"dependencies"`
+}
+
+// ChartFileName возвращает имя архива чарта, принятое в Helm
+func ChartFileName(name, version string) string {
+	return fmt.Sprintf("%s-%s.tgz", name, version)
+}
+
+// SplitChartFileName разбирает имя архива <name>-<version>.tgz. Версия может содержать дефисы
+// (1.0.0-rc.1), поэтому выбирается первое разбиение, при котором остаток является версией SemVer.
+func SplitChartFileName(fileName string) (string, string, bool) {
+	base := strings.TrimSuffix(fileName, ".tgz")
+	if base == fileName || strings.Contains(base, "/") {
+		return "", "", false
+	}
+
+	for i := 1; i < len(base)-1; i++ {
+		if base[i] != '-' {
+			continue
+		}
+		if _, err := semver.StrictNewVersion(base[i+1:]); err == nil {
+			return base[:i], base[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// Validate проверяет обязательные поля Chart.yaml
+func (m *ChartMetadata) Validate() error {
+	switch m.APIVersion {
+	case "v1", "v2":
+	case "":
+		return i18n.Errorf("%w: в Chart.yaml не указан apiVersion", ErrChartInvalid)
+	default:
+		return i18n.Errorf("%w: неподдерживаемый apiVersion %q", ErrChartInvalid, m.APIVersion)
+	}
+
+	if m.Name == "" {
+		return i18n.Errorf("%w: в Chart.yaml не указано имя чарта", ErrChartInvalid)
+	}
+	if !chartNameRegexp.MatchString(m.Name) {
+		return i18n.Errorf("%w: недопустимое имя чарта %q", ErrChartInvalid, m.Name)
+	}
+
+	if m.Version == "" {
+		return i18n.Errorf("%w: в Chart.yaml не указана версия чарта", ErrChartInvalid)
+	}
+	if _, err := semver.StrictNewVersion(m.Version); err != nil {
+		return i18n.Errorf("%w: версия %q не соответствует SemVer 2", ErrChartInvalid, m.Version)
+	}
+
+	switch m.Type {
+	case "", "application", "library":
+	default:
+		return i18n.Errorf("%w: неизвестный тип чарта %q", ErrChartInvalid, m.Type)
+	}
+
+	for _, dependency := range m.Dependencies {
+		if dependency == nil || dependency.Name == "" {
+			return i18n.Errorf("%w: у зависимости не указано имя", ErrChartInvalid)
+		}
+	}
+	return nil
+}
+
+// ParseChartArchive читает метаданные чарта из .tgz архива: Chart.yaml, зависимости из
+// requirements.yaml (apiVersion v1) и зафиксированные версии из Chart.lock/requirements.lock
+func ParseChartArchive(chartPath string) (*ChartMetadata, error) {
+	chartFile, err := os.Open(chartPath)
+	if err != nil {
+		return nil, i18n.Errorf("ошибка открытия архива чарта: %w", err)
+	}
+	defer chartFile.Close()
+
+	gzipReader, err := gzip.NewReader(chartFile)
+	if err != nil {
+		return nil, i18n.Errorf("%w: %v", ErrChartInvalid, err)
+	}
+	defer gzipReader.Close()
+
+	// файлы верхнего уровня каталога чарта; вложенные charts/ не учитываются
+	files := make(map[string][]byte)
+	chartDir := ""
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, i18n.Errorf("%w: %v", ErrChartInvalid, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		parts := strings.Split(name, "/")
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[1] {
+		case "Chart.yaml", "Chart.lock", "requirements.yaml", "requirements.lock":
+		default:
+			continue
+		}
+
+		if chartDir == "" {
+			chartDir = parts[0]
+		} else if chartDir != parts[0] {
+			return nil, i18n.Errorf("%w: архив содержит несколько каталогов чартов", ErrChartInvalid)
+		}
+
+		if header.Size > maxChartFileSize {
+			return nil, i18n.Errorf("%w: файл %s слишком большой", ErrChartInvalid, name)
+		}
+
+		content, err := io.ReadAll(io.LimitReader(tarReader, maxChartFileSize))
+		if err != nil {
+			return nil, i18n.Errorf("%w: %v", ErrChartInvalid, err)
+		}
+		files[parts[1]] = content
+	}
+
+	chartYaml, ok := files["Chart.yaml"]
+	if !ok {
+		return nil, i18n.Errorf("%w: в архиве нет Chart.yaml", ErrChartInvalid)
+	}
+
+	var metadata ChartMetadata
+	if err := yaml.Unmarshal(chartYaml, &metadata); err != nil {
+		return nil, i18n.Errorf("%w: ошибка разбора Chart.yaml: %v", ErrChartInvalid, err)
+	}
+
+	// в apiVersion v1 зависимости описываются в requirements.yaml
+	if requirements, ok := files["requirements.yaml"]; ok && len(metadata.Dependencies) == 0 {
+		var parsed chartLock
+		if err := yaml.Unmarshal(requirements, &parsed); err != nil {
+			return nil, i18n.Errorf("%w: ошибка разбора requirements.yaml: %v", ErrChartInvalid, err)
+		}
+		metadata.Dependencies = parsed.Dependencies
+	}
+
+	if err := metadata.Validate(); err != nil {
+		return nil, err
+	}
+
+	lockContent, ok := files["Chart.lock"]
+	if !ok {
+		lockContent, ok = files["requirements.lock"]
+	}
+	if ok {
+		var lock chartLock
+		if err := yaml.Unmarshal(lockContent, &lock); err != nil {
+			return nil, i18n.Errorf("%w: ошибка разбора Chart.lock: %v", ErrChartInvalid, err)
+		}
+
+		for _, dependency := range metadata.Dependencies {
+			for _, locked := range lock.Dependencies {
+				if locked != nil && locked.Name == dependency.Name && locked.Repository == dependency.Repository {
+					dependency.LockedVersion = locked.Version
+					break
+				}
+			}
+		}
+	}
+
+	return &metadata, nil
+}
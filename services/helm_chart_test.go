@@ -0,0 +1,229 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitChartFileName(t *testing.T) {
+	tests := []struct {
+		fileName    string
+		wantName    string
+		wantVersion string
+		wantOK      bool
+	}{
+		{"nginx-1.2.3.tgz", "nginx", "1.2.3", true},
+		{"my-app-0.1.0.tgz", "my-app", "0.1.0", true},
+		{"my-app-1.0.0-rc.1.tgz", "my-app", "1.0.0-rc.1", true},
+		{"app-1.0.0+build.5.tgz", "app", "1.0.0+build.5", true},
+		{"a-b-c-2.0.0-beta-2.tgz", "a-b-c", "2.0.0-beta-2", true},
+		{"nginx-1.2.tgz", "", "", false},
+		{"nginx-v1.2.3.tgz", "", "", false},
+		{"nginx.tgz", "", "", false},
+		{"nginx-1.2.3.tar.gz", "", "", false},
+		{"nginx-1.2.3", "", "", false},
+		{"-1.2.3.tgz", "", "", false},
+		{"charts/nginx-1.2.3.tgz", "", "", false},
+		{".tgz", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			name, version, ok := SplitChartFileName(tt.fileName)
+			if ok != tt.wantOK || name != tt.wantName || version != tt.wantVersion {
+				t.Errorf("SplitChartFileName(%q) = %q, %q, %v, want %q, %q, %v",
+					tt.fileName, name, version, ok, tt.wantName, tt.wantVersion, tt.wantOK)
+			}
+			if ok && ChartFileName(name, version) != tt.fileName {
+				t.Errorf("ChartFileName(%q, %q) = %q, want %q", name, version, ChartFileName(name, version), tt.fileName)
+			}
+		})
+	}
+}
+
+// writeChartArchive собирает .tgz архив из файлов и возвращает путь к нему
+func writeChartArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	chartPath := filepath.Join(t.TempDir(), "chart.tgz")
+	if err := os.WriteFile(chartPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return chartPath
+}
+
+func TestParseChartArchive(t *testing.T) {
+	const chartYaml = "apiVersion: v2\nname: app\nversion: 1.0.0\nappVersion: \"2.3\"\ndescription: test\n"
+
+	tests := []struct {
+		name        string
+		files       map[string]string
+		wantErr     bool
+		wantVersion string
+		wantDeps    map[string]string // имя зависимости -> зафиксированная версия
+	}{
+		{
+			name:        "chart yaml",
+			files:       map[string]string{"app/Chart.yaml": chartYaml, "app/values.yaml": "replicas: 1\n"},
+			wantVersion: "1.0.0",
+		},
+		{
+			name:        "dot prefix",
+			files:       map[string]string{"./app/Chart.yaml": chartYaml},
+			wantVersion: "1.0.0",
+		},
+		{
+			name: "dependencies with lock",
+			files: map[string]string{
+				"app/Chart.yaml": chartYaml + "dependencies:\n- name: redis\n  version: ^17.0.0\n  repository: https://charts.example.com\n",
+				"app/Chart.lock": "dependencies:\n- name: redis\n  version: 17.3.2\n  repository: https://charts.example.com\n",
+			},
+			wantVersion: "1.0.0",
+			wantDeps:    map[string]string{"redis": "17.3.2"},
+		},
+		{
+			name: "v1 requirements",
+			files: map[string]string{
+				"app/Chart.yaml":        "apiVersion: v1\nname: app\nversion: 0.1.0\n",
+				"app/requirements.yaml": "dependencies:\n- name: mysql\n  version: 1.x\n  repository: https://charts.example.com\n",
+				"app/requirements.lock": "dependencies:\n- name: mysql\n  version: 1.6.9\n  repository: https://charts.example.com\n",
+			},
+			wantVersion: "0.1.0",
+			wantDeps:    map[string]string{"mysql": "1.6.9"},
+		},
+		{
+			name: "lock from other repository",
+			files: map[string]string{
+				"app/Chart.yaml": chartYaml + "dependencies:\n- name: redis\n  version: ^17.0.0\n  repository: https://charts.example.com\n",
+				"app/Chart.lock": "dependencies:\n- name: redis\n  version: 17.3.2\n  repository: https://other.example.com\n",
+			},
+			wantVersion: "1.0.0",
+			wantDeps:    map[string]string{"redis": ""},
+		},
+		{
+			name: "subchart chart yaml ignored",
+			files: map[string]string{
+				"app/Chart.yaml":              chartYaml,
+				"app/charts/redis/Chart.yaml": "apiVersion: v2\nname: redis\nversion: 17.3.2\n",
+			},
+			wantVersion: "1.0.0",
+		},
+		{
+			name:    "no chart yaml",
+			files:   map[string]string{"app/values.yaml": "replicas: 1\n"},
+			wantErr: true,
+		},
+		{
+			name:    "chart yaml at root",
+			files:   map[string]string{"Chart.yaml": chartYaml},
+			wantErr: true,
+		},
+		{
+			name:    "several charts",
+			files:   map[string]string{"app/Chart.yaml": chartYaml, "other/Chart.yaml": chartYaml},
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			files:   map[string]string{"app/Chart.yaml": "name: [app\n"},
+			wantErr: true,
+		},
+		{
+			name:    "no api version",
+			files:   map[string]string{"app/Chart.yaml": "name: app\nversion: 1.0.0\n"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			files:   map[string]string{"app/Chart.yaml": "apiVersion: v2\nname: app\nversion: 1.0\n"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			files:   map[string]string{"app/Chart.yaml": "apiVersion: v2\nname: ../app\nversion: 1.0.0\n"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			files:   map[string]string{"app/Chart.yaml": chartYaml + "type: plugin\n"},
+			wantErr: true,
+		},
+		{
+			name:    "dependency without name",
+			files:   map[string]string{"app/Chart.yaml": chartYaml + "dependencies:\n- version: 1.0.0\n"},
+			wantErr: true,
+		},
+		{
+			name:    "chart yaml too large",
+			files:   map[string]string{"app/Chart.yaml": chartYaml + "# " + strings.Repeat("x", maxChartFileSize) + "\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := ParseChartArchive(writeChartArchive(t, tt.files))
+			if tt.wantErr {
+				if !errors.Is(err, ErrChartInvalid) {
+					t.Fatalf("ParseChartArchive() error = %v, want ErrChartInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseChartArchive() error = %v", err)
+			}
+
+			if metadata.Version != tt.wantVersion {
+				t.Errorf("Version = %q, want %q", metadata.Version, tt.wantVersion)
+			}
+			if len(metadata.Dependencies) != len(tt.wantDeps) {
+				t.Fatalf("Dependencies = %d, want %d", len(metadata.Dependencies), len(tt.wantDeps))
+			}
+			for _, dependency := range metadata.Dependencies {
+				locked, ok := tt.wantDeps[dependency.Name]
+				if !ok {
+					t.Errorf("unexpected dependency %q", dependency.Name)
+					continue
+				}
+				if dependency.LockedVersion != locked {
+					t.Errorf("dependency %q LockedVersion = %q, want %q", dependency.Name, dependency.LockedVersion, locked)
+				}
+			}
+		})
+	}
+}
+
+func TestParseChartArchiveNotGzip(t *testing.T) {
+	chartPath := filepath.Join(t.TempDir(), "chart.tgz")
+	if err := os.WriteFile(chartPath, []byte("not a chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseChartArchive(chartPath); !errors.Is(err, ErrChartInvalid) {
+		t.Fatalf("ParseChartArchive() error = %v, want ErrChartInvalid", err)
+	}
+}
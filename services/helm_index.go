@@ -0,0 +1,397 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexFile - index.yaml Helm репозитория
+type IndexFile struct {
+	APIVersion string                     `yaml:"apiVersion"`
+	Entries    map[string][]*ChartVersion `yaml:"entries"`
+	Generated  time.Time                  `yaml:"generated"`
+}
+
+// ChartVersion - запись о версии чарта в index.yaml
+type ChartVersion struct {
+	ChartMetadata `yaml:",inline"`
+	URLs          []string  `yaml:"urls"`
+	Created       time.Time `yaml:"created"`
+	Digest        string    `yaml:"digest,omitempty"`
+}
+
+// helmIndexCache хранит сгенерированные индексы хостовых репозиториев в памяти.
+// Индекс строится из записей HelmChart при первом запросе и дальше обновляется
+// при загрузке и удалении чартов без повторного чтения всех записей.
+// Объединенные индексы групп пересобираются, только если с момента сборки
+// изменился какой-либо индекс (generation).
+type helmIndexCache struct {
+	mu         sync.Mutex
+	indexes    map[int]*cachedIndex
+	groups     map[int]*cachedIndex
+	proxies    map[int]*proxyIndex
+	generation uint64
+}
+
+type cachedIndex struct {
+	file       *IndexFile
+	content    []byte
+	generation uint64
+}
+
+// proxyIndex - разобранный index.yaml удаленного репозитория
+type proxyIndex struct {
+	file    *IndexFile
+	modTime time.Time
+}
+
+var helmIndexes = &helmIndexCache{
+	indexes: make(map[int]*cachedIndex),
+	groups:  make(map[int]*cachedIndex),
+	proxies: make(map[int]*proxyIndex),
+}
+
+// chartURL возвращает адрес архива чарта, по которому его скачивает Helm
+func chartURL(repoName, name, version string) string {
+	return fmt.Sprintf("%s/helm/%s/charts/%s", config.Config.BaseURL, repoName, ChartFileName(name, version))
+}
+
+// newChartVersion строит запись индекса из записи чарта
+func newChartVersion(repo *models.HelmRepository, chart *models.HelmChart) *ChartVersion {
+	entry := &ChartVersion{
+		URLs:    []string{chartURL(repo.Name, chart.Name, chart.Version)},
+		Created: chart.CreatedAt,
+		Digest:  chart.SHA256,
+	}
+
+	if len(chart.Metadata) > 0 {
+		if err := json.Unmarshal(chart.Metadata, &entry.ChartMetadata); err != nil {
+			i18n.Logf("Ошибка чтения метаданных чарта %s-%s: %v", chart.Name, chart.Version, err)
+		}
+	}
+
+	// записи, сохраненные до разбора Chart.yaml, содержат только основные поля
+	if entry.APIVersion == "" {
+		entry.APIVersion = "v1"
+	}
+	entry.Name = chart.Name
+	entry.Version = chart.Version
+	if entry.AppVersion == "" {
+		entry.AppVersion = chart.AppVersion
+	}
+	if entry.Description == "" {
+		entry.Description = chart.Description
+	}
+	if len(entry.Keywords) == 0 {
+		entry.Keywords = chart.Keywords
+	}
+	return entry
+}
+
+// sortChartVersions сортирует версии чарта от новой к старой, как это делает helm repo index
+func sortChartVersions(versions []*ChartVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		left, leftErr := semver.NewVersion(versions[i].Version)
+		right, rightErr := semver.NewVersion(versions[j].Version)
+		if leftErr != nil || rightErr != nil {
+			return versions[i].Version > versions[j].Version
+		}
+		return left.GreaterThan(right)
+	})
+}
+
+func (c *cachedIndex) render() error {
+	c.file.Generated = time.Now()
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.file); err != nil {
+		return i18n.Errorf("ошибка формирования index.yaml: %w", err)
+	}
+	encoder.Close()
+	c.content = buf.Bytes()
+	return nil
+}
+
+// Get возвращает index.yaml хостового репозитория, при необходимости строя его из базы
+func (h *helmIndexCache) Get(repo *models.HelmRepository) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cached, err := h.hosted(repo)
+	if err != nil {
+		return nil, err
+	}
+	return cached.content, nil
+}
+
+func (h *helmIndexCache) hosted(repo *models.HelmRepository) (*cachedIndex, error) {
+	if cached, ok := h.indexes[repo.ID]; ok {
+		return cached, nil
+	}
+
+	var charts []models.HelmChart
+	if err := db.DB.Where("repository_id = ?", repo.ID).Find(&charts).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения списка чартов: %w", err)
+	}
+
+	index := &IndexFile{
+		APIVersion: "v1",
+		Entries:    make(map[string][]*ChartVersion),
+	}
+	for i := range charts {
+		ensureChartDigest(repo.StoragePath, &charts[i])
+		index.Entries[charts[i].Name] = append(index.Entries[charts[i].Name], newChartVersion(repo, &charts[i]))
+	}
+	for _, versions := range index.Entries {
+		sortChartVersions(versions)
+	}
+
+	cached := &cachedIndex{file: index}
+	if err := cached.render(); err != nil {
+		return nil, err
+	}
+	h.indexes[repo.ID] = cached
+	return cached, nil
+}
+
+// proxy возвращает разобранный index.yaml прокси-репозитория, перечитывая файл после синхронизации
+func (h *helmIndexCache) proxy(repo *models.HelmRepository) (*IndexFile, error) {
+	info, err := storage.Store.Stat(context.Background(), indexKey(repo.StoragePath, repo.IndexPath))
+	if err != nil {
+		return nil, i18n.Errorf("ошибка чтения индексного файла: %w", err)
+	}
+
+	if cached, ok := h.proxies[repo.ID]; ok && cached.modTime.Equal(info.ModTime) {
+		return cached.file, nil
+	}
+
+	content, err := readProxyIndex(context.Background(), repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var index IndexFile
+	if err := yaml.Unmarshal(content, &index); err != nil {
+		return nil, i18n.Errorf("ошибка разбора индексного файла %s: %w", repo.Name, err)
+	}
+
+	h.proxies[repo.ID] = &proxyIndex{file: &index, modTime: info.ModTime}
+	return &index, nil
+}
+
+// ProxyChartURL возвращает адрес архива версии чарта из индекса удаленного репозитория
+func (h *helmIndexCache) ProxyChartURL(repo *models.HelmRepository, name, version string) (string, string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index, err := h.proxy(repo)
+	if err != nil {
+		return "", "", false
+	}
+
+	for _, entry := range index.Entries[name] {
+		if entry == nil || entry.Version != version || len(entry.URLs) == 0 {
+			continue
+		}
+
+		base, err := url.Parse(strings.TrimSuffix(repo.URL, "/") + "/")
+		if err != nil {
+			return "", "", false
+		}
+		ref, err := url.Parse(entry.URLs[0])
+		if err != nil {
+			return "", "", false
+		}
+		return base.ResolveReference(ref).String(), entry.Digest, true
+	}
+	return "", "", false
+}
+
+// Group возвращает объединенный index.yaml группы. Версии чартов берутся у участников
+// в порядке приоритета, а ссылки на архивы указывают на группу, чтобы Helm скачивал чарты через нее.
+func (h *helmIndexCache) Group(group *models.HelmRepository) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cached, ok := h.groups[group.ID]; ok && cached.generation == h.generation {
+		return cached.content, nil
+	}
+
+	members, err := groupMembers(FormatHelm, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &IndexFile{
+		APIVersion: "v1",
+		Entries:    make(map[string][]*ChartVersion),
+	}
+	seen := make(map[string]bool)
+
+	for _, member := range members {
+		var repo models.HelmRepository
+		if err := db.DB.First(&repo, member.MemberID).Error; err != nil {
+			i18n.Logf("Участник %s группы %s недоступен: %v", member.MemberName, group.Name, err)
+			continue
+		}
+
+		var memberIndex *IndexFile
+		switch repo.Type {
+		case models.TypeHosted:
+			cached, err := h.hosted(&repo)
+			if err != nil {
+				i18n.Logf("Ошибка получения индекса репозитория %s группы %s: %v", repo.Name, group.Name, err)
+				continue
+			}
+			memberIndex = cached.file
+		case models.TypeProxy:
+			memberIndex, err = h.proxy(&repo)
+			if err != nil {
+				i18n.Logf("Ошибка получения индекса репозитория %s группы %s: %v", repo.Name, group.Name, err)
+				continue
+			}
+		default:
+			continue
+		}
+
+		for name, versions := range memberIndex.Entries {
+			for _, version := range versions {
+				if version == nil {
+					continue
+				}
+
+				key := ChartFileName(name, version.Version)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				entry := *version
+				entry.URLs = []string{chartURL(group.Name, name, version.Version)}
+				index.Entries[name] = append(index.Entries[name], &entry)
+			}
+		}
+	}
+
+	for _, versions := range index.Entries {
+		sortChartVersions(versions)
+	}
+
+	cached := &cachedIndex{file: index, generation: h.generation}
+	if err := cached.render(); err != nil {
+		return nil, err
+	}
+	h.groups[group.ID] = cached
+	return cached.content, nil
+}
+
+// Changed сообщает, что изменился индекс прокси-репозитория или состав группы
+func (h *helmIndexCache) Changed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.generation++
+}
+
+// Forget удаляет из кеша индексы удаленного репозитория
+func (h *helmIndexCache) Forget(repoID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.generation++
+	delete(h.indexes, repoID)
+	delete(h.groups, repoID)
+	delete(h.proxies, repoID)
+}
+
+// Add добавляет или заменяет версию чарта в построенном индексе.
+// Если индекс еще не строился, он будет построен из базы при первом запросе.
+func (h *helmIndexCache) Add(repo *models.HelmRepository, chart *models.HelmChart) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.generation++
+	cached, ok := h.indexes[repo.ID]
+	if !ok {
+		return
+	}
+
+	versions := cached.file.Entries[chart.Name]
+	for i, version := range versions {
+		if version.Version == chart.Version {
+			versions = append(versions[:i], versions[i+1:]...)
+			break
+		}
+	}
+	versions = append(versions, newChartVersion(repo, chart))
+	sortChartVersions(versions)
+	cached.file.Entries[chart.Name] = versions
+
+	if err := cached.render(); err != nil {
+		i18n.Logf("Ошибка обновления индекса репозитория %s: %v", repo.Name, err)
+		delete(h.indexes, repo.ID)
+	}
+}
+
+// Remove удаляет версию чарта из построенного индекса
+func (h *helmIndexCache) Remove(repo *models.HelmRepository, name, version string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.generation++
+	cached, ok := h.indexes[repo.ID]
+	if !ok {
+		return
+	}
+
+	versions := cached.file.Entries[name]
+	for i, entry := range versions {
+		if entry.Version == version {
+			versions = append(versions[:i], versions[i+1:]...)
+			break
+		}
+	}
+	if len(versions) == 0 {
+		delete(cached.file.Entries, name)
+	} else {
+		cached.file.Entries[name] = versions
+	}
+
+	if err := cached.render(); err != nil {
+		i18n.Logf("Ошибка обновления индекса репозитория %s: %v", repo.Name, err)
+		delete(h.indexes, repo.ID)
+	}
+}
+
+// ensureChartDigest вычисляет sha256 архива для записей, сохраненных без него
+func ensureChartDigest(storagePath string, chart *models.HelmChart) {
+	if chart.SHA256 != "" {
+		return
+	}
+
+	digest, _, err := hashObject(context.Background(), chartKey(storagePath, ChartFileName(chart.Name, chart.Version)))
+	if err != nil {
+		i18n.Logf("Ошибка вычисления sha256 чарта %s-%s: %v", chart.Name, chart.Version, err)
+		return
+	}
+
+	chart.SHA256 = digest
+	if err := db.DB.Model(chart).UpdateColumn("sha256", digest).Error; err != nil {
+		i18n.Logf("Ошибка сохранения sha256 чарта %s-%s: %v", chart.Name, chart.Version, err)
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"github.com/Viste/larets/i18n"
+	"sync"
+	"time"
+)
+
+// ErrMaintenance - запись отклонена, пока выполняется обслуживание хранилища
+var ErrMaintenance = errors.New("выполняется обслуживание хранилища, запись временно недоступна")
+
+// maintenanceLock переводит сервер в режим только для чтения на время сборки мусора.
+// Блокировка действует в пределах одного экземпляра сервера.
+type maintenanceLock struct {
+	mu     sync.RWMutex
+	reason i18n.Message
+	since  time.Time
+}
+
+var maintenance = &maintenanceLock{}
+
+// begin включает режим только для чтения. Возвращает false, если он уже включен
+func (m *maintenanceLock) begin(reason i18n.Message) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reason != "" {
+		return false
+	}
+	m.reason = reason
+	m.since = time.Now()
+	return true
+}
+
+func (m *maintenanceLock) end() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reason = ""
+	m.since = time.Time{}
+}
+
+// check возвращает ErrMaintenance, если запись сейчас запрещена
+func (m *maintenanceLock) check() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.reason == "" {
+		return nil
+	}
+	return i18n.Errorf("%w: %s с %s", ErrMaintenance, m.reason, m.since.Format(time.RFC3339))
+}
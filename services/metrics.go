@@ -0,0 +1,123 @@
+package services
+
+import (
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
+	"github.com/Viste/larets/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// storageUsageInterval - как часто пересчитывается объем хранилища репозиториев.
+// Prometheus опрашивает /metrics каждые несколько секунд, а для Git репозиториев
+// объем считается обходом директории.
+const storageUsageInterval = time.Minute
+
+var (
+	storageBytesDesc = prometheus.NewDesc("larets_repository_storage_bytes",
+		"Объем артефактов репозитория в байтах, для Git - размер директории репозитория.",
+		[]string{"format", "repository"}, nil)
+	storageArtifactsDesc = prometheus.NewDesc("larets_repository_artifacts",
+		"Количество артефактов репозитория: образов, чартов.",
+		[]string{"format", "repository"}, nil)
+)
+
+// RepositoryUsage - объем хранилища, занятый репозиторием
+type RepositoryUsage struct {
+	Format     string
+	Repository string
+	Artifacts  int64
+	Size       int64
+}
+
+// storageUsageCollector отдает в метрики объем хранилища по репозиториям
+type storageUsageCollector struct {
+	mu      sync.Mutex
+	updated time.Time
+	usage   []RepositoryUsage
+}
+
+var registerMetricsOnce sync.Once
+
+// RegisterMetrics добавляет в метрики сервера объем хранилища по репозиториям
+func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		metrics.Registry.MustRegister(&storageUsageCollector{})
+	})
+}
+
+func (c *storageUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storageBytesDesc
+	ch <- storageArtifactsDesc
+}
+
+func (c *storageUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.updated) >= storageUsageInterval {
+		usage, err := StorageUsage()
+		if err != nil {
+			// до следующей попытки отдаются прежние значения
+			i18n.Logf("Ошибка расчета объема хранилища для метрик: %v", err)
+		} else {
+			c.usage = usage
+		}
+		c.updated = time.Now()
+	}
+
+	for _, repo := range c.usage {
+		ch <- prometheus.MustNewConstMetric(storageBytesDesc, prometheus.GaugeValue, float64(repo.Size), repo.Format, repo.Repository)
+		ch <- prometheus.MustNewConstMetric(storageArtifactsDesc, prometheus.GaugeValue, float64(repo.Artifacts), repo.Format, repo.Repository)
+	}
+}
+
+// StorageUsage считает объем хранилища репозиториев, кроме групп: для Docker и Helm -
+// по записям образов и чартов, для Git - по размеру директории репозитория
+func StorageUsage() ([]RepositoryUsage, error) {
+	var usage []RepositoryUsage
+
+	artifactTables := []struct {
+		format       string
+		repositories string
+		artifacts    string
+	}{
+		{FormatDocker, "docker_repositories", "docker_images"},
+		{FormatHelm, "helm_repositories", "helm_charts"},
+	}
+	for _, source := range artifactTables {
+		var rows []RepositoryUsage
+		err := db.DB.Table(source.repositories+" AS r").
+			Select("r.name AS repository, COUNT(a.id) AS artifacts, COALESCE(SUM(a.size), 0) AS size").
+			Joins("LEFT JOIN "+source.artifacts+" AS a ON a.repository_id = r.id").
+			Where("r.type <> ?", models.TypeGroup).
+			Group("r.name").
+			Order("r.name").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, i18n.Errorf("ошибка получения %s репозиториев: %w", source.format, err)
+		}
+		for _, row := range rows {
+			row.Format = source.format
+			usage = append(usage, row)
+		}
+	}
+
+	var gitRepos []models.GitRepository
+	if err := db.DB.Where("type <> ?", models.TypeGroup).Order("name").Find(&gitRepos).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения %s репозиториев: %w", FormatGit, err)
+	}
+	for _, repo := range gitRepos {
+		var artifacts int64
+		db.DB.Model(&models.Artifact{}).Where("repository_id = ? AND repo_type = ?", repo.ID, FormatGit).Count(&artifacts)
+		usage = append(usage, RepositoryUsage{
+			Format:     FormatGit,
+			Repository: repo.Name,
+			Artifacts:  artifacts,
+			Size:       dirSize(repo.StoragePath),
+		})
+	}
+	return usage, nil
+}
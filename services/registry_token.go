@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"sync"
+	"time"
+)
+
+// издатель токенов Docker Registry (iss)
+const registryTokenIssuer = "larets"
+
+var ErrRegistryTokenInvalid = newError(ErrUnauthorized, "REGISTRY_TOKEN_INVALID", "неверный токен доступа к реестру")
+
+// registryActions сопоставляет действия из scope токена правам на репозиторий
+var registryActions = map[string]string{
+	"pull":   ActionRead,
+	"push":   ActionWrite,
+	"delete": ActionDelete,
+	"*":      ActionAdmin,
+}
+
+// RegistryAccess - разрешенные действия над ресурсом, поле access токена
+// (https://distribution.github.io/distribution/spec/auth/jwt/)
+type RegistryAccess struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+type RegistryClaims struct {
+	jwt.RegisteredClaims
+	Access []RegistryAccess `json:"access"`
+}
+
+// Allows сообщает, что токен разрешает действие action над ресурсом
+func (c *RegistryClaims) Allows(resourceType, name, action string) bool {
+	for _, access := range c.Access {
+		if access.Type != resourceType || access.Name != name {
+			continue
+		}
+		for _, granted := range access.Actions {
+			if granted == action || granted == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RegistryToken - выданный токен и срок его действия
+type RegistryToken struct {
+	Token     string
+	ExpiresIn int
+	IssuedAt  time.Time
+}
+
+type RegistryTokenService struct {
+	keyOnce sync.Once
+	key     []byte
+}
+
+// signingKey возвращает ключ подписи. Без REGISTRY_TOKEN_SECRET ключ генерируется
+// при запуске, и выданные токены перестают действовать после перезапуска.
+func (s *RegistryTokenService) signingKey() []byte {
+	s.keyOnce.Do(func() {
+		if config.Config.RegistryTokenSecret != "" {
+			s.key = []byte(config.Config.RegistryTokenSecret)
+			return
+		}
+
+		s.key = make([]byte, 32)
+		if _, err := rand.Read(s.key); err != nil {
+			i18n.Fatalf("Ошибка генерации ключа подписи токенов: %v", err)
+		}
+		i18n.Logf("REGISTRY_TOKEN_SECRET не задан, токены Docker Registry будут недействительны после перезапуска")
+	})
+	return s.key
+}
+
+// parseRegistryScope разбирает scope вида repository:<имя>:pull,push
+func parseRegistryScope(scope string) (RegistryAccess, bool) {
+	resourceType, rest, ok := strings.Cut(scope, ":")
+	if !ok {
+		return RegistryAccess{}, false
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 {
+		return RegistryAccess{}, false
+	}
+	return RegistryAccess{
+		Type:    resourceType,
+		Name:    rest[:idx],
+		Actions: strings.Split(rest[idx+1:], ","),
+	}, true
+}
+
+// grantedActions оставляет из запрошенных действий те, на которые у пользователя есть права.
+// Имя ресурса - <репозиторий>/<образ>, права проверяются на репозиторий.
+func (s *RegistryTokenService) grantedActions(scope *accessScope, requested RegistryAccess) []string {
+	granted := []string{}
+
+	switch requested.Type {
+	case "registry":
+		// каталог фильтруется по правам при каждом запросе
+		if requested.Name == "catalog" && (scope.unrestricted || scope.user != nil) {
+			granted = append(granted, "*")
+		}
+		return granted
+	case "repository":
+	default:
+		return granted
+	}
+
+	repoName, _, _ := strings.Cut(requested.Name, "/")
+	repo, err := findBaseRepository(FormatDocker, repoName)
+	if err != nil {
+		return granted
+	}
+
+	for _, action := range requested.Actions {
+		required, ok := registryActions[action]
+		if !ok {
+			continue
+		}
+		if scope.check(FormatDocker, repo, required) == nil {
+			granted = append(granted, action)
+		}
+	}
+	return granted
+}
+
+// IssueToken выдает подписанный токен на запрошенные scope. Действия, на которые у пользователя
+// нет прав, в токен не попадают; анонимный пользователь получает токен с правами анонимного чтения.
+func (s *RegistryTokenService) IssueToken(ctx context.Context, scopes []string) (*RegistryToken, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var access []RegistryAccess
+	for _, value := range scopes {
+		requested, ok := parseRegistryScope(value)
+		if !ok {
+			continue
+		}
+
+		actions := s.grantedActions(scope, requested)
+		if len(actions) > 0 {
+			access = append(access, RegistryAccess{Type: requested.Type, Name: requested.Name, Actions: actions})
+		}
+	}
+
+	subject := ""
+	if user := UserFromContext(ctx); user != nil {
+		subject = user.Username
+	}
+
+	ttl := time.Duration(config.Config.RegistryTokenTTL) * time.Minute
+	now := time.Now()
+	claims := RegistryClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    registryTokenIssuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{config.Config.RegistryService},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        newUUID(),
+		},
+		Access: access,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.signingKey())
+	if err != nil {
+		return nil, i18n.Errorf("ошибка подписи токена: %w", err)
+	}
+
+	return &RegistryToken{Token: token, ExpiresIn: int(ttl.Seconds()), IssuedAt: now}, nil
+}
+
+// VerifyToken проверяет подпись и срок действия токена и возвращает пользователя,
+// которому он выдан (nil для анонимного токена), и разрешенные действия
+func (s *RegistryTokenService) VerifyToken(token string) (*models.User, *RegistryClaims, error) {
+	var claims RegistryClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.signingKey(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(registryTokenIssuer),
+		jwt.WithAudience(config.Config.RegistryService),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, nil, i18n.Errorf("%w: %v", ErrRegistryTokenInvalid, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, &claims, nil
+	}
+
+	user, err := (&AuthService{}).GetUser(claims.Subject)
+	if err != nil || !user.Active {
+		return nil, nil, i18n.Errorf("%w: пользователь %s недоступен", ErrRegistryTokenInvalid, claims.Subject)
+	}
+	return user, &claims, nil
+}
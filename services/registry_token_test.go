@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/config"
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistryScope(t *testing.T) {
+	tests := []struct {
+		scope  string
+		want   RegistryAccess
+		wantOK bool
+	}{
+		{"repository:docker-local/app:pull", RegistryAccess{Type: "repository", Name: "docker-local/app", Actions: []string{"pull"}}, true},
+		{"repository:docker-local/team/app:pull,push", RegistryAccess{Type: "repository", Name: "docker-local/team/app", Actions: []string{"pull", "push"}}, true},
+		{"repository:docker-local/app:*", RegistryAccess{Type: "repository", Name: "docker-local/app", Actions: []string{"*"}}, true},
+		{"registry:catalog:*", RegistryAccess{Type: "registry", Name: "catalog", Actions: []string{"*"}}, true},
+		// имя с портом реестра: действия отделяются последним двоеточием
+		{"repository:localhost:5000/app:pull", RegistryAccess{Type: "repository", Name: "localhost:5000/app", Actions: []string{"pull"}}, true},
+		{"repository:docker-local/app:", RegistryAccess{Type: "repository", Name: "docker-local/app", Actions: []string{""}}, true},
+		{"repository", RegistryAccess{}, false},
+		{"repository:docker-local/app", RegistryAccess{}, false},
+		{"repository::pull", RegistryAccess{}, false},
+		{"", RegistryAccess{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			got, ok := parseRegistryScope(tt.scope)
+			if ok != tt.wantOK {
+				t.Fatalf("parseRegistryScope(%q) ok = %v, want %v", tt.scope, ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRegistryScope(%q) = %+v, want %+v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryClaimsAllows(t *testing.T) {
+	claims := &RegistryClaims{Access: []RegistryAccess{
+		{Type: "repository", Name: "docker-local/app", Actions: []string{"pull", "push"}},
+		{Type: "repository", Name: "docker-local/admin", Actions: []string{"*"}},
+		{Type: "registry", Name: "catalog", Actions: []string{"*"}},
+	}}
+
+	tests := []struct {
+		resourceType string
+		name         string
+		action       string
+		want         bool
+	}{
+		{"repository", "docker-local/app", "pull", true},
+		{"repository", "docker-local/app", "push", true},
+		{"repository", "docker-local/app", "delete", false},
+		{"repository", "docker-local/admin", "delete", true},
+		{"repository", "docker-local/other", "pull", false},
+		{"repository", "docker-local", "pull", false},
+		{"registry", "catalog", "*", true},
+		{"registry", "docker-local/app", "pull", false},
+	}
+
+	for _, tt := range tests {
+		if got := claims.Allows(tt.resourceType, tt.name, tt.action); got != tt.want {
+			t.Errorf("Allows(%s, %s, %s) = %v, want %v", tt.resourceType, tt.name, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryTokenRoundTrip(t *testing.T) {
+	saved := config.Config
+	t.Cleanup(func() { config.Config = saved })
+	config.Config.EnableAuth = false
+	config.Config.RegistryService = "larets-test"
+	config.Config.RegistryTokenSecret = "test-secret"
+	config.Config.RegistryTokenTTL = 5
+
+	service := &RegistryTokenService{}
+	token, err := service.IssueToken(context.Background(), []string{"registry:catalog:*", "invalid"})
+	if err != nil {
+		t.Fatalf("IssueToken() error = %v", err)
+	}
+	if token.ExpiresIn != 300 {
+		t.Errorf("ExpiresIn = %d, want 300", token.ExpiresIn)
+	}
+
+	user, claims, err := service.VerifyToken(token.Token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v", err)
+	}
+	if user != nil {
+		t.Errorf("VerifyToken() user = %v, want anonymous", user.Username)
+	}
+	want := []RegistryAccess{{Type: "registry", Name: "catalog", Actions: []string{"*"}}}
+	if !reflect.DeepEqual(claims.Access, want) {
+		t.Errorf("Access = %+v, want %+v", claims.Access, want)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		service *RegistryTokenService
+	}{
+		{"tampered", token.Token[:len(token.Token)-2] + "xx", service},
+		{"other key", token.Token, &RegistryTokenService{key: []byte("other-secret")}},
+		{"not a token", "abc", service},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ключ задан явно и не должен заменяться REGISTRY_TOKEN_SECRET
+			tt.service.keyOnce.Do(func() {})
+			if _, _, err := tt.service.VerifyToken(tt.token); !errors.Is(err, ErrRegistryTokenInvalid) {
+				t.Errorf("VerifyToken() error = %v, want ErrRegistryTokenInvalid", err)
+			}
+		})
+	}
+
+	config.Config.RegistryService = "other-service"
+	if _, _, err := service.VerifyToken(token.Token); !errors.Is(err, ErrRegistryTokenInvalid) {
+		t.Errorf("VerifyToken() with other audience error = %v, want ErrRegistryTokenInvalid", err)
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"gorm.io/gorm"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrRepositoryInGroup = newError(ErrConflict, "REPOSITORY_IN_GROUP", "репозиторий входит в группу")
+
+// DeleteReport описывает, что удалено вместе с репозиторием, а в режиме dry-run - что будет удалено
+type DeleteReport struct {
+	Repository string `json:"repository"`
+	Format     string `json:"format"`
+	DryRun     bool   `json:"dry_run"`
+	// удаление без force будет отклонено, так как репозиторий входит в группы
+	Blocked     bool     `json:"blocked,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	Members     int64    `json:"members,omitempty"`
+	Artifacts   int64    `json:"artifacts"`
+	StoredFiles int64    `json:"stored_files"`
+	Uploads     int64    `json:"uploads,omitempty"`
+	StoragePath string   `json:"storage_path"`
+	StorageSize int64    `json:"storage_size"`
+}
+
+// newDeleteReport собирает общую часть отчета: группы, в которые входит репозиторий,
+// участников, если репозиторий сам является группой, и объем хранилища
+func newDeleteReport(format string, repo *models.BaseRepository, storagePath string, dryRun bool) (*DeleteReport, error) {
+	report := &DeleteReport{
+		Repository:  repo.Name,
+		Format:      format,
+		DryRun:      dryRun,
+		StoragePath: storagePath,
+		StorageSize: dirSize(storagePath),
+	}
+
+	model, err := repositoryModel(format)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.DB.Model(model).
+		Where("id IN (?)", db.DB.Model(&models.GroupMember{}).Select("group_id").
+			Where("member_type = ? AND member_id = ?", format, repo.ID)).
+		Order("name").
+		Pluck("name", &report.Groups).Error
+	if err != nil {
+		return nil, i18n.Errorf("ошибка получения групп репозитория: %w", err)
+	}
+
+	if repo.Type == models.TypeGroup {
+		db.DB.Model(&models.GroupMember{}).Where("group_id = ? AND member_type = ?", repo.ID, format).Count(&report.Members)
+	}
+	return report, nil
+}
+
+// checkGroupMembership отклоняет удаление репозитория, который входит в группы, если не указан force
+func (r *DeleteReport) checkGroupMembership(force bool) error {
+	if len(r.Groups) == 0 || force {
+		return nil
+	}
+
+	r.Blocked = true
+	if r.DryRun {
+		return nil
+	}
+	return i18n.Errorf("%w: %s, для удаления укажите force", ErrRepositoryInGroup, strings.Join(r.Groups, ", "))
+}
+
+// deleteRepositoryRecords удаляет участие репозитория в группах, состав группы, общие записи артефактов и расписания
+func deleteRepositoryRecords(tx *gorm.DB, format string, repoID int) error {
+	err := tx.Where("member_type = ? AND (member_id = ? OR group_id = ?)", format, repoID, repoID).
+		Delete(&models.GroupMember{}).Error
+	if err != nil {
+		return i18n.Errorf("ошибка удаления участия в группах: %w", err)
+	}
+
+	if err := tx.Where("repository_id = ? AND repo_type = ?", repoID, format).Delete(&models.Artifact{}).Error; err != nil {
+		return i18n.Errorf("ошибка удаления артефактов: %w", err)
+	}
+
+	if err := tx.Where("repository_id = ? AND repo_type = ?", repoID, format).Delete(&models.Schedule{}).Error; err != nil {
+		return i18n.Errorf("ошибка удаления расписаний: %w", err)
+	}
+
+	if err := tx.Where("repository_id = ? AND repo_type = ?", repoID, format).Delete(&models.CleanupPolicy{}).Error; err != nil {
+		return i18n.Errorf("ошибка удаления правил очистки: %w", err)
+	}
+
+	if err := tx.Where("repository_id = ? AND repo_type = ?", repoID, format).Delete(&models.DownloadStat{}).Error; err != nil {
+		return i18n.Errorf("ошибка удаления статистики скачиваний: %w", err)
+	}
+	return nil
+}
+
+// removeStorage удаляет директорию репозитория. Удаляются только директории внутри
+// хранилища формата, чтобы ошибочный StoragePath не привел к удалению посторонних данных.
+func removeStorage(root, storagePath string) {
+	if storagePath == "" {
+		return
+	}
+
+	rel, err := filepath.Rel(root, storagePath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		i18n.Logf("Директория %s находится вне хранилища %s и не будет удалена", storagePath, root)
+		return
+	}
+
+	if err := os.RemoveAll(storagePath); err != nil {
+		i18n.Logf("Ошибка удаления директории %s: %v", storagePath, err)
+	}
+}
+
+// removeObjects удаляет объекты хранилища артефактов с ключами, начинающимися с prefix
+func removeObjects(ctx context.Context, prefix string) {
+	var keys []string
+	err := storage.Store.Walk(ctx, prefix, func(info storage.Info) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	if err != nil {
+		i18n.Logf("Ошибка получения объектов %s: %v", prefix, err)
+	}
+
+	for _, key := range keys {
+		if err := storage.Store.Delete(ctx, key); err != nil {
+			i18n.Logf("Ошибка удаления объекта %s: %v", key, err)
+		}
+	}
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
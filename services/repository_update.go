@@ -0,0 +1,109 @@
+package services
+
+import (
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrRepositoryUpdateInvalid = newError(ErrInvalid, "REPOSITORY_UPDATE_INVALID", "недопустимые параметры репозитория")
+
+// RepositoryUpdate - изменяемые настройки репозитория. Поля, равные nil, не изменяются.
+type RepositoryUpdate struct {
+	Description   *string `json:"description"`
+	AnonymousRead *bool   `json:"anonymous_read"`
+	URL           *string `json:"url"`
+	Username      *string `json:"username"`
+	Password      *string `json:"password"`
+	CacheEnabled  *bool   `json:"cache_enabled"`
+	CacheTTL      *int    `json:"cache_ttl"`
+	Branch        *string `json:"branch"`
+	CloneEnabled  *bool   `json:"clone_enabled"`
+	PushEnabled   *bool   `json:"push_enabled"`
+	IndexPath     *string `json:"index_path"`
+}
+
+// validate проверяет, что изменяемые поля есть у репозитория формата format и типа repoType
+func (u *RepositoryUpdate) validate(format string, repoType models.RepositoryType) error {
+	fields := map[string]bool{
+		"username":      u.Username != nil && format != FormatDocker,
+		"password":      u.Password != nil && format != FormatDocker,
+		"cache_enabled": u.CacheEnabled != nil && format == FormatGit,
+		"cache_ttl":     u.CacheTTL != nil && format == FormatGit,
+		"branch":        u.Branch != nil && format != FormatGit,
+		"clone_enabled": u.CloneEnabled != nil && format != FormatGit,
+		"push_enabled":  u.PushEnabled != nil && format != FormatGit,
+		"index_path":    u.IndexPath != nil && format != FormatHelm,
+	}
+	var unsupported []string
+	for field, set := range fields {
+		if set {
+			unsupported = append(unsupported, field)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return i18n.Errorf("%w: поля %s не поддерживаются для %s репозиториев", ErrRepositoryUpdateInvalid, strings.Join(unsupported, ", "), format)
+	}
+
+	if u.URL != nil {
+		if repoType != models.TypeProxy {
+			return i18n.Errorf("%w: URL указывается только для прокси-репозитория", ErrRepositoryUpdateInvalid)
+		}
+		if err := validateUpstreamURL(format, *u.URL); err != nil {
+			return err
+		}
+	}
+
+	if u.CacheTTL != nil && *u.CacheTTL < 0 {
+		return i18n.Errorf("%w: cache_ttl не может быть отрицательным", ErrRepositoryUpdateInvalid)
+	}
+
+	if u.Branch != nil && strings.TrimSpace(*u.Branch) == "" {
+		return i18n.Errorf("%w: имя ветки не может быть пустым", ErrRepositoryUpdateInvalid)
+	}
+
+	if u.PushEnabled != nil && *u.PushEnabled && repoType != models.TypeHosted {
+		return i18n.Errorf("%w: push разрешается только в хостовый репозиторий", ErrRepositoryUpdateInvalid)
+	}
+
+	if u.IndexPath != nil && !filepath.IsLocal(*u.IndexPath) {
+		return i18n.Errorf("%w: index_path должен быть относительным путем внутри хранилища", ErrRepositoryUpdateInvalid)
+	}
+	if u.IndexPath != nil && strings.SplitN(filepath.ToSlash(*u.IndexPath), "/", 2)[0] == "charts" {
+		return i18n.Errorf("%w: index_path не может указывать в директорию архивов чартов", ErrRepositoryUpdateInvalid)
+	}
+	return nil
+}
+
+// validateUpstreamURL проверяет адрес удаленного репозитория. Git поддерживает и другие
+// протоколы (ssh, file), поэтому для него проверяется только, что адрес не пустой.
+func validateUpstreamURL(format, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return i18n.Errorf("%w: URL не может быть пустым", ErrRepositoryUpdateInvalid)
+	}
+	if format == FormatGit {
+		return nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return i18n.Errorf("%w: URL должен быть адресом http или https", ErrRepositoryUpdateInvalid)
+	}
+	return nil
+}
+
+// applyBase применяет общие для всех форматов поля
+func (u *RepositoryUpdate) applyBase(repo *models.BaseRepository) {
+	if u.Description != nil {
+		repo.Description = *u.Description
+	}
+	if u.AnonymousRead != nil {
+		repo.AnonymousRead = *u.AnonymousRead
+	}
+	repo.UpdatedAt = time.Now()
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/robfig/cron/v3"
+	"math/rand"
+	"time"
+)
+
+// период проверки расписаний, которым пора выполняться
+const schedulerTick = 15 * time.Second
+
+// StartScheduler запускает планировщик, который до отмены ctx ставит в очередь задачи по расписаниям
+func StartScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+
+		for {
+			dispatchDueSchedules(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	i18n.Logf("Планировщик задач запущен")
+}
+
+// dispatchDueSchedules ставит в очередь задачи расписаний, время запуска которых наступило.
+// Следующий запуск назначается условным обновлением, поэтому при нескольких экземплярах
+// Larets расписание срабатывает только в одном из них.
+func dispatchDueSchedules(ctx context.Context) {
+	now := time.Now()
+
+	var schedules []models.Schedule
+	err := db.DB.Where("enabled = ? AND next_run_at <= ?", true, now).Order("next_run_at").Find(&schedules).Error
+	if err != nil {
+		i18n.Logf("Ошибка получения расписаний: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+
+		next, err := nextRun(&schedule, now)
+		if err != nil {
+			i18n.Logf("Ошибка расчета следующего запуска расписания %d: %v", schedule.ID, err)
+			continue
+		}
+
+		result := db.DB.Model(&models.Schedule{}).
+			Where("id = ? AND next_run_at = ?", schedule.ID, schedule.NextRunAt).
+			Update("next_run_at", next)
+		if result.Error != nil {
+			i18n.Logf("Ошибка обновления расписания %d: %v", schedule.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if _, err := submitScheduledTask(withSystemAccess(ctx), &schedule); err != nil {
+			i18n.Logf("Ошибка постановки задачи расписания %d в очередь: %v", schedule.ID, err)
+		}
+	}
+}
+
+// submitScheduledTask ставит в очередь задачу расписания. Если предыдущая задача для репозитория
+// еще не завершена, запуск пропускается и отмечается в истории.
+func submitScheduledTask(ctx context.Context, schedule *models.Schedule) (*models.Task, error) {
+	scheduleID := schedule.ID
+	task := models.Task{
+		ScheduleID:     &scheduleID,
+		Type:           schedule.Task,
+		RepoType:       schedule.RepoType,
+		RepositoryID:   schedule.RepositoryID,
+		RepositoryName: schedule.RepositoryName,
+	}
+
+	active, err := activeTask(schedule.Task, schedule.RepoType, schedule.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return submitTask(ctx, task, nil)
+	}
+
+	now := time.Now()
+	task.Status = TaskStatusSkipped
+	task.Error = i18n.Sprintf(i18n.LogLanguage(), "предыдущая задача %d для репозитория еще выполняется", active.ID)
+	task.CreatedAt = now
+	task.FinishedAt = &now
+	if err := db.DB.Create(&task).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения задачи: %w", err)
+	}
+	i18n.Logf("Задача %s для репозитория %s пропущена: предыдущая еще выполняется", schedule.Task, schedule.RepositoryName)
+	return active, nil
+}
+
+// nextRun возвращает время следующего запуска после from с учетом случайной задержки
+func nextRun(schedule *models.Schedule, from time.Time) (time.Time, error) {
+	var next time.Time
+	if schedule.Cron != "" {
+		parsed, err := cron.ParseStandard(schedule.Cron)
+		if err != nil {
+			return time.Time{}, i18n.Errorf("%w: %v", ErrScheduleInvalid, err)
+		}
+		next = parsed.Next(from)
+	} else {
+		next = from.Add(time.Duration(schedule.Interval) * time.Minute)
+	}
+
+	if schedule.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(schedule.Jitter) * int64(time.Second))))
+	}
+	return next, nil
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+var ErrScheduleInvalid = newError(ErrInvalid, "SCHEDULE_INVALID", "недопустимое расписание")
+
+// ScheduleSpec - параметры создаваемого расписания. Указывается cron-выражение
+// (в том числе @hourly, @every 30m) или интервал в минутах.
+type ScheduleSpec struct {
+	Task       string `json:"task"`
+	RepoType   string `json:"repo_type"`
+	Repository string `json:"repository"`
+	Cron       string `json:"cron"`
+	Interval   int    `json:"interval"`
+	Jitter     *int   `json:"jitter"`
+	Enabled    *bool  `json:"enabled"`
+}
+
+// ScheduleUpdate - изменяемые поля расписания. Поля, равные nil, не изменяются.
+type ScheduleUpdate struct {
+	Cron     *string `json:"cron"`
+	Interval *int    `json:"interval"`
+	Jitter   *int    `json:"jitter"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+type ScheduleService struct{}
+
+// validateSchedule проверяет время запуска и то, что задача поддерживается для репозитория
+func validateSchedule(schedule *models.Schedule, repo *models.BaseRepository) error {
+	switch {
+	case schedule.Cron != "" && schedule.Interval != 0:
+		return i18n.Errorf("%w: укажите cron или interval, но не оба", ErrScheduleInvalid)
+	case schedule.Cron == "" && schedule.Interval == 0:
+		return i18n.Errorf("%w: необходимо указать cron или interval", ErrScheduleInvalid)
+	case schedule.Interval < 0:
+		return i18n.Errorf("%w: interval должен быть положительным", ErrScheduleInvalid)
+	case schedule.Jitter < 0:
+		return i18n.Errorf("%w: jitter не может быть отрицательным", ErrScheduleInvalid)
+	}
+
+	if schedule.Cron != "" {
+		if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+			return i18n.Errorf("%w: неверное cron-выражение: %v", ErrScheduleInvalid, err)
+		}
+	}
+
+	switch schedule.Task {
+	case TaskSync:
+		if schedule.RepoType != FormatGit && schedule.RepoType != FormatHelm {
+			return i18n.Errorf("%w: синхронизация не поддерживается для %s репозиториев", ErrScheduleInvalid, schedule.RepoType)
+		}
+		if repo.Type != models.TypeProxy {
+			return i18n.Errorf("%w: синхронизация доступна только для прокси-репозиториев", ErrScheduleInvalid)
+		}
+	case TaskCleanup:
+		if schedule.RepoType != FormatDocker && schedule.RepoType != FormatHelm {
+			return i18n.Errorf("%w: очистка не поддерживается для %s репозиториев", ErrScheduleInvalid, schedule.RepoType)
+		}
+		if repo.Type == models.TypeGroup {
+			return i18n.Errorf("%w: очистка недоступна для групп", ErrScheduleInvalid)
+		}
+	default:
+		return i18n.Errorf("%w: неизвестная задача %s", ErrScheduleInvalid, schedule.Task)
+	}
+	return nil
+}
+
+// scheduleRepository находит репозиторий расписания и проверяет право action на него
+func scheduleRepository(ctx context.Context, format, name, action string) (*models.BaseRepository, error) {
+	repo, err := findBaseRepository(format, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, format, repo, action); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// getScheduleFor находит расписание и проверяет право action на его репозиторий
+func (s *ScheduleService) getScheduleFor(ctx context.Context, id int, action string) (*models.Schedule, *models.BaseRepository, error) {
+	var schedule models.Schedule
+	if err := db.DB.First(&schedule, id).Error; err != nil {
+		return nil, nil, i18n.Errorf("расписание не найдено: %w", err)
+	}
+
+	repo, err := scheduleRepository(ctx, schedule.RepoType, schedule.RepositoryName, action)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &schedule, repo, nil
+}
+
+func (s *ScheduleService) CreateSchedule(ctx context.Context, spec ScheduleSpec) (*models.Schedule, error) {
+	if spec.Task == "" {
+		spec.Task = TaskSync
+	}
+	if _, err := repositoryModel(spec.RepoType); err != nil {
+		return nil, i18n.Errorf("%w: %v", ErrScheduleInvalid, err)
+	}
+
+	repo, err := scheduleRepository(ctx, spec.RepoType, spec.Repository, ActionAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := models.Schedule{
+		Task:           spec.Task,
+		RepoType:       spec.RepoType,
+		RepositoryID:   repo.ID,
+		RepositoryName: repo.Name,
+		Cron:           spec.Cron,
+		Interval:       spec.Interval,
+		Jitter:         config.Config.SchedulerJitter,
+		Enabled:        true,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if spec.Jitter != nil {
+		schedule.Jitter = *spec.Jitter
+	}
+	if spec.Enabled != nil {
+		schedule.Enabled = *spec.Enabled
+	}
+
+	if err := validateSchedule(&schedule, repo); err != nil {
+		return nil, err
+	}
+
+	schedule.NextRunAt, err = nextRun(&schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.DB.Create(&schedule).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения расписания: %w", err)
+	}
+
+	i18n.Logf("Создано расписание %s для %s репозитория %s", schedule.Task, schedule.RepoType, schedule.RepositoryName)
+	return &schedule, nil
+}
+
+// ListSchedules возвращает расписания репозиториев, доступных пользователю на чтение.
+// Если указан format или repoName, выбираются только расписания этих репозиториев.
+func (s *ScheduleService) ListSchedules(ctx context.Context, format, repoName string) ([]models.Schedule, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.DB.Order("id")
+	if format != "" {
+		query = query.Where("repo_type = ?", format)
+	}
+	if repoName != "" {
+		query = query.Where("repository_name = ?", repoName)
+	}
+
+	var schedules []models.Schedule
+	if err := query.Find(&schedules).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения расписаний: %w", err)
+	}
+
+	readable := schedules[:0]
+	for _, schedule := range schedules {
+		repo, err := findBaseRepository(schedule.RepoType, schedule.RepositoryName)
+		if err != nil {
+			continue
+		}
+		if scope.check(schedule.RepoType, repo, ActionRead) == nil {
+			readable = append(readable, schedule)
+		}
+	}
+	return readable, nil
+}
+
+func (s *ScheduleService) GetSchedule(ctx context.Context, id int) (*models.Schedule, error) {
+	schedule, _, err := s.getScheduleFor(ctx, id, ActionRead)
+	return schedule, err
+}
+
+// UpdateSchedule изменяет время запуска расписания. Следующий запуск пересчитывается от текущего времени.
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, id int, update ScheduleUpdate) (*models.Schedule, error) {
+	schedule, repo, err := s.getScheduleFor(ctx, id, ActionAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	// cron и interval взаимоисключающие: указание одного сбрасывает другой
+	if update.Cron != nil {
+		schedule.Cron = *update.Cron
+		if *update.Cron != "" && update.Interval == nil {
+			schedule.Interval = 0
+		}
+	}
+	if update.Interval != nil {
+		schedule.Interval = *update.Interval
+		if *update.Interval != 0 && update.Cron == nil {
+			schedule.Cron = ""
+		}
+	}
+	if update.Jitter != nil {
+		schedule.Jitter = *update.Jitter
+	}
+	if update.Enabled != nil {
+		schedule.Enabled = *update.Enabled
+	}
+
+	if err := validateSchedule(schedule, repo); err != nil {
+		return nil, err
+	}
+
+	schedule.NextRunAt, err = nextRun(schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	schedule.UpdatedAt = time.Now()
+
+	if err := db.DB.Save(schedule).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения расписания: %w", err)
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, id int) error {
+	schedule, _, err := s.getScheduleFor(ctx, id, ActionAdmin)
+	if err != nil {
+		return err
+	}
+
+	if err := db.DB.Delete(schedule).Error; err != nil {
+		return i18n.Errorf("ошибка удаления расписания: %w", err)
+	}
+
+	i18n.Logf("Удалено расписание %d для %s репозитория %s", schedule.ID, schedule.RepoType, schedule.RepositoryName)
+	return nil
+}
+
+// RunSchedule ставит задачу расписания в очередь на немедленное выполнение,
+// время следующего запуска по расписанию не меняется. Очистка требует права delete.
+func (s *ScheduleService) RunSchedule(ctx context.Context, id int) (*models.Task, error) {
+	schedule, repo, err := s.getScheduleFor(ctx, id, ActionWrite)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Task == TaskCleanup {
+		if err := authorize(ctx, schedule.RepoType, repo, ActionDelete); err != nil {
+			return nil, err
+		}
+	}
+
+	scheduleID := schedule.ID
+	return submitTask(ctx, models.Task{
+		ScheduleID:     &scheduleID,
+		Type:           schedule.Task,
+		RepoType:       schedule.RepoType,
+		RepositoryID:   schedule.RepositoryID,
+		RepositoryName: schedule.RepositoryName,
+	}, nil)
+}
@@ -0,0 +1,625 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/metrics"
+	"github.com/Viste/larets/models"
+	"gorm.io/gorm"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	TaskSync    = "sync"
+	TaskMirror  = "mirror"
+	TaskGC      = "gc"
+	TaskCleanup = "cleanup"
+	TaskVerify  = "verify"
+
+	TaskStatusPending   = "pending"
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+	TaskStatusCanceled  = "canceled"
+	TaskStatusSkipped   = "skipped"
+)
+
+const (
+	// период проверки очереди, если о новых задачах не поступало уведомлений
+	taskPollInterval = 5 * time.Second
+	// минимальный интервал между сохранениями прогресса задачи
+	taskProgressInterval = time.Second
+	// период обновления heartbeat_at выполняемых задач
+	taskHeartbeatInterval = 30 * time.Second
+	// через сколько без обновления heartbeat_at задача считается брошенной и возвращается в очередь
+	taskStaleAfter = 2 * time.Minute
+)
+
+var (
+	ErrTaskCanceled      = errors.New("задача отменена")
+	ErrTaskFinished      = newError(ErrConflict, "TASK_FINISHED", "задача уже завершена")
+	ErrTaskNotCancelable = newError(ErrConflict, "TASK_NOT_CANCELABLE", "задачу нельзя отменить")
+	ErrTaskActive        = newError(ErrConflict, "TASK_ACTIVE", "для репозитория уже выполняется задача")
+)
+
+type taskHandler func(ctx context.Context, run *TaskRun) error
+
+func lookupTaskHandler(taskType string) (taskHandler, bool) {
+	switch taskType {
+	case TaskSync:
+		return runSyncTask, true
+	case TaskMirror:
+		return (&GitService{}).mirrorRepository, true
+	case TaskGC:
+		return collectGarbage, true
+	case TaskCleanup:
+		return runCleanupTask, true
+	case TaskVerify:
+		return runVerifyTask, true
+	}
+	return nil, false
+}
+
+func runSyncTask(ctx context.Context, run *TaskRun) error {
+	switch run.Task.RepoType {
+	case FormatGit:
+		return (&GitService{}).syncRepository(ctx, run)
+	case FormatHelm:
+		return (&HelmService{}).syncRepository(ctx, run)
+	}
+	return i18n.Errorf("синхронизация не поддерживается для %s репозиториев", run.Task.RepoType)
+}
+
+// TaskRun - выполняемая задача, через него обработчик пишет журнал и сообщает прогресс.
+// Методы допускают nil, чтобы те же функции можно было вызывать вне задачи.
+type TaskRun struct {
+	Task          *models.Task
+	progressSaved time.Time
+}
+
+// Logf добавляет запись в журнал задачи. Журнал хранится в базе на языке LOG_LANGUAGE.
+func (r *TaskRun) Logf(format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+
+	entry := models.TaskLog{TaskID: r.Task.ID, Message: i18n.Sprintf(i18n.LogLanguage(), format, args...), CreatedAt: time.Now()}
+	if err := db.DB.Create(&entry).Error; err != nil {
+		i18n.Logf("Ошибка записи журнала задачи %d: %v", r.Task.ID, err)
+	}
+}
+
+// SetProgress сохраняет процент выполнения, но не чаще раза в секунду
+func (r *TaskRun) SetProgress(progress int) {
+	if r == nil {
+		return
+	}
+
+	progress = min(max(progress, 0), 100)
+	if progress == r.Task.Progress {
+		return
+	}
+	r.Task.Progress = progress
+	if progress < 100 && time.Since(r.progressSaved) < taskProgressInterval {
+		return
+	}
+
+	r.progressSaved = time.Now()
+	db.DB.Model(&models.Task{}).Where("id = ?", r.Task.ID).Update("progress", progress)
+}
+
+// SetResult сохраняет отчет задачи
+func (r *TaskRun) SetResult(v interface{}) {
+	if r == nil {
+		return
+	}
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		i18n.Logf("Ошибка сериализации результата задачи %d: %v", r.Task.ID, err)
+		return
+	}
+	r.Task.Result = content
+	if err := db.DB.Model(&models.Task{}).Where("id = ?", r.Task.ID).Update("result", content).Error; err != nil {
+		i18n.Logf("Ошибка сохранения результата задачи %d: %v", r.Task.ID, err)
+	}
+}
+
+// Params разбирает параметры задачи в v
+func (r *TaskRun) Params(v interface{}) error {
+	if len(r.Task.Params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Task.Params, v)
+}
+
+// taskManager выполняет задачи из очереди в базе в пуле обработчиков. Задачи одного репозитория
+// выполняются по очереди. Очередь может разбирать несколько экземпляров сервера: задача
+// захватывается одним условным обновлением, а выполняющий ее экземпляр периодически отмечается
+// в heartbeat_at. Задачи, отметка которых устарела, возвращаются в очередь.
+type taskManager struct {
+	id      string
+	wake    chan struct{}
+	mu      sync.Mutex
+	cancels map[int]context.CancelCauseFunc
+}
+
+var taskQueue = &taskManager{
+	id:      newWorkerID(),
+	wake:    make(chan struct{}, 1),
+	cancels: make(map[int]context.CancelCauseFunc),
+}
+
+// errTaskReclaimed - причина прерывания задачи, которую вернули в очередь другие экземпляры
+var errTaskReclaimed = errors.New("задача возвращена в очередь другим экземпляром сервера")
+
+// newWorkerID возвращает идентификатор экземпляра сервера: имя хоста, номер процесса и случайный
+// суффикс, чтобы перезапущенный процесс не считал своими задачи предыдущего
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "larets"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// StartTasks возвращает в очередь брошенные задачи и запускает TASK_WORKERS обработчиков до отмены ctx
+func StartTasks(ctx context.Context) {
+	workers := config.Config.TaskWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	taskQueue.reclaim()
+	go taskQueue.heartbeat(ctx)
+	for i := 0; i < workers; i++ {
+		go taskQueue.worker(ctx)
+	}
+
+	i18n.Logf("Запущено обработчиков фоновых задач: %d (экземпляр %s)", workers, taskQueue.id)
+}
+
+// heartbeat отмечает задачи этого экземпляра выполняемыми и возвращает в очередь брошенные задачи
+func (m *taskManager) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(taskHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.touch()
+		m.reclaim()
+	}
+}
+
+// touch обновляет heartbeat_at выполняемых задач. Задачи, которые за это время вернули в очередь
+// другие экземпляры, прерываются: их выполнит тот, кто захватит их заново.
+func (m *taskManager) touch() {
+	m.mu.Lock()
+	ids := make([]int, 0, len(m.cancels))
+	for id := range m.cancels {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	err := db.DB.Model(&models.Task{}).
+		Where("id IN ? AND status = ? AND worker_id = ?", ids, TaskStatusRunning, m.id).
+		Update("heartbeat_at", time.Now()).Error
+	if err != nil {
+		i18n.Logf("Ошибка обновления отметки выполнения задач: %v", err)
+		return
+	}
+
+	var owned []int
+	err = db.DB.Model(&models.Task{}).
+		Where("id IN ? AND status = ? AND worker_id = ?", ids, TaskStatusRunning, m.id).
+		Pluck("id", &owned).Error
+	if err != nil {
+		i18n.Logf("Ошибка обновления отметки выполнения задач: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if !slices.Contains(owned, id) {
+			m.interrupt(id, errTaskReclaimed)
+		}
+	}
+}
+
+// reclaim возвращает в очередь выполняемые задачи, экземпляр которых не отмечался дольше
+// taskStaleAfter: он остановлен или потерял связь с базой. Обработчики задач идемпотентны,
+// поэтому задача выполняется заново с начала.
+func (m *taskManager) reclaim() {
+	stale := time.Now().Add(-taskStaleAfter)
+	var abandoned []models.Task
+	err := db.DB.Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", TaskStatusRunning, stale).
+		Find(&abandoned).Error
+	if err != nil {
+		i18n.Logf("Ошибка получения брошенных задач: %v", err)
+		return
+	}
+
+	reclaimed := 0
+	for _, task := range abandoned {
+		result := db.DB.Model(&models.Task{}).
+			Where("id = ? AND status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", task.ID, TaskStatusRunning, stale).
+			Updates(map[string]interface{}{"status": TaskStatusPending, "progress": 0, "worker_id": "", "heartbeat_at": nil})
+		if result.Error != nil {
+			i18n.Logf("Ошибка возобновления задачи %d: %v", task.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		(&TaskRun{Task: &task}).Logf("Экземпляр сервера %s перестал отвечать, задача возвращена в очередь", task.WorkerID)
+		reclaimed++
+	}
+
+	if reclaimed > 0 {
+		i18n.Logf("Возвращено в очередь брошенных задач: %d", reclaimed)
+		m.notify()
+	}
+}
+
+// notify будит обработчик, ожидающий новых задач
+func (m *taskManager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *taskManager) worker(ctx context.Context) {
+	for {
+		for ctx.Err() == nil && m.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
+
+// claim захватывает самую старую задачу в очереди, для репозитория которой не выполняется другая
+// задача. Выбор и захват - один условный UPDATE, поэтому задачу получает только один обработчик
+// даже при нескольких экземплярах сервера. Если два экземпляра одновременно захватили задачи одного
+// репозитория, второй получает нарушение индекса idx_tasks_running и не захватывает ничего.
+func (m *taskManager) claim() (*models.Task, error) {
+	// обработчики одного экземпляра не соревнуются друг с другом за одну задачу
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var claimed []models.Task
+	err := db.DB.Raw(`UPDATE tasks SET status = ?, worker_id = ?, started_at = ?, heartbeat_at = ?, progress = 0, updated_at = ?
+		WHERE status = ? AND id = (SELECT queued.id FROM tasks AS queued
+			WHERE queued.status = ? AND NOT EXISTS (SELECT 1 FROM tasks AS active
+				WHERE active.status = ? AND active.repo_type = queued.repo_type AND active.repository_id = queued.repository_id)
+			ORDER BY queued.id LIMIT 1)
+		RETURNING *`,
+		TaskStatusRunning, m.id, now, now, now,
+		TaskStatusPending, TaskStatusPending, TaskStatusRunning).
+		Scan(&claimed).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, i18n.Errorf("ошибка захвата задачи: %w", err)
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+	return &claimed[0], nil
+}
+
+func (m *taskManager) runNext(ctx context.Context) bool {
+	task, err := m.claim()
+	if err != nil {
+		i18n.Logf("Ошибка выбора задачи: %v", err)
+		return false
+	}
+	if task == nil {
+		return false
+	}
+
+	m.execute(ctx, task)
+	return true
+}
+
+// execute выполняет задачу и сохраняет результат. Задачи выполняются с системными правами:
+// права пользователя проверяются при постановке задачи в очередь.
+func (m *taskManager) execute(ctx context.Context, task *models.Task) {
+	runCtx, cancel := context.WithCancelCause(withSystemAccess(ctx))
+
+	m.mu.Lock()
+	m.cancels[task.ID] = cancel
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, task.ID)
+		m.mu.Unlock()
+		cancel(nil)
+	}()
+
+	run := &TaskRun{Task: task}
+	run.Logf("Задача запущена (экземпляр %s)", m.id)
+
+	var err error
+	if handler, ok := lookupTaskHandler(task.Type); ok {
+		err = handler(runCtx, run)
+	} else {
+		err = i18n.Errorf("неизвестный тип задачи: %s", task.Type)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// задачу вернет в очередь другой экземпляр или этот после перезапуска
+		i18n.Logf("Задача %d прервана остановкой сервера", task.ID)
+		return
+	}
+	if errors.Is(context.Cause(runCtx), errTaskReclaimed) {
+		i18n.Logf("Задача %d возвращена в очередь другим экземпляром сервера, выполнение прервано", task.ID)
+		return
+	}
+
+	status, message := TaskStatusSucceeded, ""
+	switch {
+	case err == nil:
+		run.SetProgress(100)
+		run.Logf("Задача выполнена")
+	case errors.Is(context.Cause(runCtx), ErrTaskCanceled):
+		status, message = TaskStatusCanceled, i18n.Localize(i18n.LogLanguage(), ErrTaskCanceled)
+		run.Logf("Задача отменена")
+	default:
+		status, message = TaskStatusFailed, i18n.Localize(i18n.LogLanguage(), err)
+		run.Logf("Ошибка: %v", err)
+		i18n.Logf("Ошибка выполнения задачи %d (%s, репозиторий %s): %v", task.ID, task.Type, task.RepositoryName, err)
+	}
+
+	finished := time.Now()
+	if task.StartedAt != nil {
+		metrics.TaskDuration.WithLabelValues(task.Type, status).Observe(finished.Sub(*task.StartedAt).Seconds())
+	}
+	// результат сохраняется, только если задачу за это время не вернули в очередь
+	result := db.DB.Model(&models.Task{}).Where("id = ? AND status = ? AND worker_id = ?", task.ID, TaskStatusRunning, m.id).
+		Updates(map[string]interface{}{"status": status, "error": message, "progress": task.Progress, "finished_at": finished})
+	if result.Error != nil {
+		i18n.Logf("Ошибка сохранения результата задачи %d: %v", task.ID, result.Error)
+	} else if result.RowsAffected == 0 {
+		i18n.Logf("Задача %d возвращена в очередь другим экземпляром сервера, результат не сохранен", task.ID)
+		return
+	}
+
+	if task.ScheduleID != nil {
+		err = db.DB.Model(&models.Schedule{}).Where("id = ?", *task.ScheduleID).
+			Updates(map[string]interface{}{"last_run_at": finished, "last_status": status}).Error
+		if err != nil {
+			i18n.Logf("Ошибка обновления расписания %d: %v", *task.ScheduleID, err)
+		}
+	}
+}
+
+// interrupt прерывает задачу, выполняемую этим экземпляром сервера, с причиной cause
+func (m *taskManager) interrupt(id int, cause error) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cancel, ok := m.cancels[id]
+	if ok {
+		cancel(cause)
+	}
+	return ok
+}
+
+// activeTask возвращает незавершенную задачу типа taskType для репозитория или nil
+func activeTask(taskType, format string, repoID int) (*models.Task, error) {
+	var task models.Task
+	err := db.DB.Where("type = ? AND repo_type = ? AND repository_id = ? AND status IN ?",
+		taskType, format, repoID, []string{TaskStatusPending, TaskStatusRunning}).
+		First(&task).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, i18n.Errorf("ошибка поиска задачи: %w", err)
+	}
+	return &task, nil
+}
+
+// submitTask ставит задачу в очередь. Если для репозитория уже есть незавершенная задача
+// того же типа, новая не создается и возвращается существующая.
+func submitTask(ctx context.Context, task models.Task, params interface{}) (*models.Task, error) {
+	active, err := activeTask(task.Type, task.RepoType, task.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, nil
+	}
+
+	if params != nil {
+		content, err := json.Marshal(params)
+		if err != nil {
+			return nil, i18n.Errorf("ошибка сериализации параметров задачи: %w", err)
+		}
+		task.Params = content
+	}
+	if user := UserFromContext(ctx); user != nil {
+		task.CreatedBy = user.Username
+	}
+	task.Status = TaskStatusPending
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = time.Now()
+
+	if err := db.DB.Create(&task).Error; err != nil {
+		return nil, i18n.Errorf("ошибка сохранения задачи: %w", err)
+	}
+
+	taskQueue.notify()
+	return &task, nil
+}
+
+// TaskFilter - условия выборки задач
+type TaskFilter struct {
+	Type       string
+	RepoType   string
+	Repository string
+	ScheduleID int
+	Status     string
+	Limit      int
+}
+
+// TaskDetails - задача вместе с журналом выполнения
+type TaskDetails struct {
+	models.Task
+	Logs []models.TaskLog `json:"logs"`
+}
+
+type TaskService struct{}
+
+// checkTask проверяет право action на репозиторий задачи. Задачи удаленных репозиториев
+// доступны только пользователям без ограничений.
+func checkTask(scope *accessScope, task *models.Task, action string) error {
+	repo, err := findBaseRepository(task.RepoType, task.RepositoryName)
+	if err != nil {
+		if scope.unrestricted {
+			return nil
+		}
+		return err
+	}
+	return scope.check(task.RepoType, repo, action)
+}
+
+// ListTasks возвращает задачи репозиториев, доступных пользователю на чтение, от новых к старым
+func (s *TaskService) ListTasks(ctx context.Context, filter TaskFilter) ([]models.Task, error) {
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.DB.Order("id DESC")
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.RepoType != "" {
+		query = query.Where("repo_type = ?", filter.RepoType)
+	}
+	if filter.Repository != "" {
+		query = query.Where("repository_name = ?", filter.Repository)
+	}
+	if filter.ScheduleID != 0 {
+		query = query.Where("schedule_id = ?", filter.ScheduleID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+
+	var tasks []models.Task
+	if err := query.Limit(filter.Limit).Find(&tasks).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения списка задач: %w", err)
+	}
+
+	readable := tasks[:0]
+	for _, task := range tasks {
+		if checkTask(scope, &task, ActionRead) == nil {
+			readable = append(readable, task)
+		}
+	}
+	return readable, nil
+}
+
+// getTaskFor находит задачу и проверяет право action на ее репозиторий
+func (s *TaskService) getTaskFor(ctx context.Context, id int, action string) (*models.Task, error) {
+	var task models.Task
+	if err := db.DB.First(&task, id).Error; err != nil {
+		return nil, i18n.Errorf("задача не найдена: %w", err)
+	}
+
+	scope, err := loadAccessScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTask(scope, &task, action); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetTask возвращает состояние задачи и журнал ее выполнения
+func (s *TaskService) GetTask(ctx context.Context, id int) (*TaskDetails, error) {
+	task, err := s.getTaskFor(ctx, id, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &TaskDetails{Task: *task, Logs: []models.TaskLog{}}
+	if err := db.DB.Where("task_id = ?", id).Order("id").Find(&details.Logs).Error; err != nil {
+		return nil, i18n.Errorf("ошибка получения журнала задачи: %w", err)
+	}
+	return details, nil
+}
+
+// CancelTask отменяет задачу: ожидающая задача снимается с очереди, выполняемая прерывается.
+// Отменить задачу может пользователь с правом записи в репозиторий.
+func (s *TaskService) CancelTask(ctx context.Context, id int) (*models.Task, error) {
+	task, err := s.getTaskFor(ctx, id, ActionWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.Status == TaskStatusPending {
+		finished := time.Now()
+		result := db.DB.Model(&models.Task{}).Where("id = ? AND status = ?", id, TaskStatusPending).
+			Updates(map[string]interface{}{"status": TaskStatusCanceled, "error": i18n.Localize(i18n.LogLanguage(), ErrTaskCanceled), "finished_at": finished})
+		if result.Error != nil {
+			return nil, i18n.Errorf("ошибка отмены задачи: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			run := &TaskRun{Task: task}
+			run.Logf("Задача отменена до запуска")
+			if task.Type == TaskMirror {
+				(&GitService{}).discardMirror(run)
+			}
+			task.Status = TaskStatusCanceled
+			task.FinishedAt = &finished
+			return task, nil
+		}
+
+		// задача успела запуститься
+		if err := db.DB.First(task, id).Error; err != nil {
+			return nil, i18n.Errorf("задача не найдена: %w", err)
+		}
+	}
+
+	if task.Status != TaskStatusRunning {
+		return nil, i18n.Errorf("%w: %s", ErrTaskFinished, task.Status)
+	}
+	if !taskQueue.interrupt(id, ErrTaskCanceled) {
+		return nil, i18n.Errorf("%w: задача выполняется другим экземпляром сервера", ErrTaskNotCancelable)
+	}
+	return task, nil
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/db"
+	"github.com/Viste/larets/i18n"
+	"github.com/Viste/larets/models"
+	"github.com/Viste/larets/storage"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	VerifyMissing    = "missing"
+	VerifyCorrupted  = "corrupted"
+	VerifyUnreadable = "unreadable"
+)
+
+// сколько проблем перечисляется в отчете проверки, остальные только учитываются
+const verifyReportIssues = 1000
+
+// VerifyOptions - параметры проверки целостности. Пустые поля - проверяются все репозитории
+type VerifyOptions struct {
+	RepoType   string `json:"repo_type,omitempty"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// VerifyIssue - файл артефакта, который отсутствует или не совпадает с сохраненным sha256
+type VerifyIssue struct {
+	RepoType   string `json:"repo_type"`
+	Repository string `json:"repository"`
+	ArtifactID int    `json:"artifact_id,omitempty"`
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	Path       string `json:"path"`
+	Problem    string `json:"problem"`
+	Expected   string `json:"expected,omitempty"`
+	Actual     string `json:"actual,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// VerifyReport - результат проверки целостности хранилища
+type VerifyReport struct {
+	Repositories int           `json:"repositories"`
+	Artifacts    int           `json:"artifacts"`
+	Files        int           `json:"files"`
+	Size         int64         `json:"size"`
+	Backfilled   int           `json:"backfilled"` // артефакты, для которых sha256 вычислен впервые
+	Missing      int           `json:"missing"`
+	Corrupted    int           `json:"corrupted"`
+	Issues       []VerifyIssue `json:"issues"`
+	Errors       []string      `json:"errors,omitempty"`
+}
+
+// OK сообщает, что все проверенные артефакты целы
+func (r *VerifyReport) OK() bool {
+	return r.Missing == 0 && r.Corrupted == 0 && len(r.Errors) == 0
+}
+
+func (r *VerifyReport) addIssue(issue VerifyIssue) {
+	if issue.Problem == VerifyMissing {
+		r.Missing++
+	} else {
+		r.Corrupted++
+	}
+	if len(r.Issues) < verifyReportIssues {
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+type VerifyService struct{}
+
+var ErrVerifyInvalid = newError(ErrInvalid, "VERIFY_INVALID", "недопустимые параметры проверки")
+
+// StartVerify ставит в очередь задачу проверки целостности. Отчет сохраняется в результате задачи.
+func (s *VerifyService) StartVerify(ctx context.Context, options VerifyOptions) (*models.Task, error) {
+	if err := validateVerifyOptions(options); err != nil {
+		return nil, err
+	}
+
+	task := models.Task{Type: TaskVerify, RepoType: options.RepoType}
+	if options.Repository != "" {
+		repo, err := findBaseRepository(options.RepoType, options.Repository)
+		if err != nil {
+			return nil, err
+		}
+		task.RepositoryID = repo.ID
+		task.RepositoryName = repo.Name
+	}
+	return submitTask(ctx, task, options)
+}
+
+func validateVerifyOptions(options VerifyOptions) error {
+	if options.RepoType == "" {
+		if options.Repository != "" {
+			return i18n.Errorf("%w: для проверки репозитория укажите repo_type", ErrVerifyInvalid)
+		}
+		return nil
+	}
+	if _, err := repositoryModel(options.RepoType); err != nil {
+		return i18n.Errorf("%w: %v", ErrVerifyInvalid, err)
+	}
+	return nil
+}
+
+// VerifyStorage пересчитывает sha256 файлов артефактов и сверяет их с сохраненными в базе.
+// Используется командой larets verify, которая выполняется без сервера и очереди задач.
+func VerifyStorage(ctx context.Context, options VerifyOptions) (*VerifyReport, error) {
+	return verifyStorage(ctx, options, nil)
+}
+
+func runVerifyTask(ctx context.Context, run *TaskRun) error {
+	var options VerifyOptions
+	if err := run.Params(&options); err != nil {
+		return i18n.Errorf("неверные параметры задачи: %w", err)
+	}
+
+	report, err := verifyStorage(ctx, options, run)
+	if report != nil {
+		run.SetResult(report)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return i18n.Errorf("обнаружены поврежденные артефакты: отсутствует %d, повреждено %d", report.Missing, report.Corrupted)
+	}
+	return nil
+}
+
+type storageVerifier struct {
+	run    *TaskRun
+	report VerifyReport
+	// результаты проверки blob-ов: один blob может входить в несколько образов
+	blobs map[string]*VerifyIssue
+}
+
+func (v *storageVerifier) logf(format string, args ...interface{}) {
+	if v.run == nil {
+		i18n.Logf(format, args...)
+		return
+	}
+	v.run.Logf(format, args...)
+}
+
+func verifyStorage(ctx context.Context, options VerifyOptions, run *TaskRun) (*VerifyReport, error) {
+	if err := validateVerifyOptions(options); err != nil {
+		return nil, err
+	}
+
+	formats := []string{FormatDocker, FormatHelm, FormatGit}
+	if options.RepoType != "" {
+		formats = []string{options.RepoType}
+	}
+
+	type verifyTarget struct {
+		format string
+		repo   gcRepository
+	}
+	var targets []verifyTarget
+	for _, format := range formats {
+		model, _ := repositoryModel(format)
+		query := db.DB.Model(model).Where("type <> ?", models.TypeGroup)
+		if options.Repository != "" {
+			query = query.Where("name = ?", options.Repository)
+		}
+
+		var repos []gcRepository
+		if err := query.Order("name").Find(&repos).Error; err != nil {
+			return nil, i18n.Errorf("ошибка получения репозиториев: %w", err)
+		}
+		for _, repo := range repos {
+			targets = append(targets, verifyTarget{format, repo})
+		}
+	}
+	if options.Repository != "" && len(targets) == 0 {
+		return nil, i18n.Errorf("репозиторий %s не найден", options.Repository)
+	}
+
+	v := &storageVerifier{
+		run:    run,
+		report: VerifyReport{Issues: []VerifyIssue{}},
+		blobs:  make(map[string]*VerifyIssue),
+	}
+	for i, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return &v.report, err
+		}
+
+		v.logf("Проверка %s репозитория %s", target.format, target.repo.Name)
+		var err error
+		switch target.format {
+		case FormatDocker:
+			err = v.verifyDocker(ctx, target.repo)
+		case FormatHelm:
+			err = v.verifyHelm(ctx, target.repo)
+		case FormatGit:
+			err = v.verifyGit(ctx, target.repo)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return &v.report, ctx.Err()
+			}
+			v.report.Errors = append(v.report.Errors, i18n.Sprintf(i18n.LogLanguage(), "%s %s: %v", target.format, target.repo.Name, err))
+		}
+
+		v.report.Repositories++
+		run.SetProgress((i + 1) * 100 / len(targets))
+	}
+
+	v.logf("Проверено артефактов: %d, файлов: %d, отсутствует: %d, повреждено: %d",
+		v.report.Artifacts, v.report.Files, v.report.Missing, v.report.Corrupted)
+	return &v.report, nil
+}
+
+// checkObject сверяет sha256 объекта хранилища артефактов с ожидаемым. Возвращает nil, если объект цел
+func (v *storageVerifier) checkObject(ctx context.Context, key, expectedHex string) *VerifyIssue {
+	actualHex, size, err := hashObject(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &VerifyIssue{Path: key, Problem: VerifyMissing, Expected: expectedHex}
+		}
+		return &VerifyIssue{Path: key, Problem: VerifyUnreadable, Expected: expectedHex, Error: i18n.Localize(i18n.LogLanguage(), err)}
+	}
+
+	v.report.Files++
+	v.report.Size += size
+	if actualHex != expectedHex {
+		return &VerifyIssue{Path: key, Problem: VerifyCorrupted, Expected: expectedHex, Actual: actualHex}
+	}
+	return nil
+}
+
+// checkBlob проверяет blob общего хранилища один раз за проверку
+func (v *storageVerifier) checkBlob(ctx context.Context, digestHex string) *VerifyIssue {
+	if issue, ok := v.blobs[digestHex]; ok {
+		return issue
+	}
+	issue := v.checkObject(ctx, blobStore.Key(digestHex), digestHex)
+	v.blobs[digestHex] = issue
+	return issue
+}
+
+func (v *storageVerifier) verifyDocker(ctx context.Context, repo gcRepository) error {
+	var images []models.DockerImage
+	err := db.DB.Select("id", "name", "version", "sha256").
+		Where("repository_id = ? AND sha256 <> ''", repo.ID).
+		Order("name, version").Find(&images).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения образов: %w", err)
+	}
+
+	for _, image := range images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var digests []string
+		err := db.DB.Model(&models.StoredFile{}).
+			Where("artifact_id = ? AND repo_type = ?", image.ID, FormatDocker).
+			Pluck("sha256", &digests).Error
+		if err != nil {
+			return i18n.Errorf("ошибка получения файлов образа %s:%s: %w", image.Name, image.Version, err)
+		}
+
+		v.report.Artifacts++
+		for _, digestHex := range append([]string{image.SHA256}, digests...) {
+			if issue := v.checkBlob(ctx, digestHex); issue != nil {
+				reported := *issue
+				reported.RepoType = FormatDocker
+				reported.Repository = repo.Name
+				reported.ArtifactID = image.ID
+				reported.Name = image.Name
+				reported.Version = image.Version
+				v.report.addIssue(reported)
+				v.logf("Образ %s:%s репозитория %s: blob sha256:%s %s", image.Name, image.Version, repo.Name, digestHex, issue.Problem)
+			}
+		}
+	}
+	return nil
+}
+
+func (v *storageVerifier) verifyHelm(ctx context.Context, repo gcRepository) error {
+	var charts []models.HelmChart
+	err := db.DB.Select("id", "name", "version", "sha256").
+		Where("repository_id = ?", repo.ID).
+		Order("name, version").Find(&charts).Error
+	if err != nil {
+		return i18n.Errorf("ошибка получения чартов: %w", err)
+	}
+
+	for _, chart := range charts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		v.report.Artifacts++
+		key := chartKey(repo.StoragePath, ChartFileName(chart.Name, chart.Version))
+		if chart.SHA256 == "" {
+			// записи, сохраненные до вычисления sha256: текущее содержимое принимается за эталон
+			if _, err := storage.Store.Stat(ctx, key); err == nil {
+				ensureChartDigest(repo.StoragePath, &chart)
+				if chart.SHA256 != "" {
+					v.report.Backfilled++
+					v.report.Files++
+					continue
+				}
+			}
+		}
+
+		if issue := v.checkObject(ctx, key, chart.SHA256); issue != nil {
+			issue.RepoType = FormatHelm
+			issue.Repository = repo.Name
+			issue.ArtifactID = chart.ID
+			issue.Name = chart.Name
+			issue.Version = chart.Version
+			v.report.addIssue(*issue)
+			v.logf("Чарт %s-%s репозитория %s: %s", chart.Name, chart.Version, repo.Name, issue.Problem)
+		}
+	}
+	return nil
+}
+
+// verifyGit проверяет объекты git репозитория через git fsck: git сам хранит
+// содержимое по хешам, поэтому отдельные sha256 для него не сохраняются
+func (v *storageVerifier) verifyGit(ctx context.Context, repo gcRepository) error {
+	v.report.Artifacts++
+	if _, err := os.Stat(repo.StoragePath); err != nil {
+		v.report.addIssue(VerifyIssue{
+			RepoType: FormatGit, Repository: repo.Name, Name: repo.Name,
+			Path: repo.StoragePath, Problem: VerifyMissing,
+		})
+		v.logf("Git репозиторий %s: директория %s отсутствует", repo.Name, repo.StoragePath)
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "fsck", "--no-progress", "--no-dangling")
+	cmd.Dir = repo.StoragePath
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	v.report.Files++
+	if err != nil {
+		v.report.addIssue(VerifyIssue{
+			RepoType: FormatGit, Repository: repo.Name, Name: repo.Name,
+			Path: repo.StoragePath, Problem: VerifyCorrupted,
+			Error: strings.TrimSpace(string(output)),
+		})
+		v.logf("Git репозиторий %s: git fsck завершился ошибкой: %v", repo.Name, err)
+	}
+	return nil
+}
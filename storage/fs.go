@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"github.com/Viste/larets/i18n"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FSBackend хранит объекты в файлах под корневой директорией: ключ blobs/sha256/ab/<hex>
+// соответствует файлу <root>/blobs/sha256/ab/<hex>
+type FSBackend struct {
+	root string
+}
+
+func NewFSBackend(root string) *FSBackend {
+	return &FSBackend{root: root}
+}
+
+func (b *FSBackend) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", i18n.Errorf("недопустимый ключ объекта: %s", key)
+	}
+	return filepath.Join(b.root, filepath.FromSlash(key)), nil
+}
+
+func notFound(key string, err error) error {
+	if os.IsNotExist(err) {
+		return i18n.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
+
+func (b *FSBackend) Stat(ctx context.Context, key string) (Info, error) {
+	filePath, err := b.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return Info{}, notFound(key, err)
+	}
+	return Info{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (b *FSBackend) Open(ctx context.Context, key string) (io.ReadSeekCloser, Info, error) {
+	filePath, err := b.path(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, Info{}, notFound(key, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Info{}, err
+	}
+	return file, Info{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Put записывает объект во временный файл рядом с целевым и переименовывает его,
+// чтобы читатели никогда не видели частично записанный объект
+func (b *FSBackend) Put(ctx context.Context, key string, reader io.Reader, size int64) error {
+	filePath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return i18n.Errorf("ошибка создания директории: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return i18n.Errorf("ошибка создания файла: %w", err)
+	}
+	tempPath := tempFile.Name()
+
+	_, err = io.Copy(tempFile, reader)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return i18n.Errorf("ошибка записи файла: %w", err)
+	}
+
+	if err := os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath)
+		return i18n.Errorf("ошибка сохранения файла: %w", err)
+	}
+	return nil
+}
+
+// PutFile перемещает файл, а если он на другой файловой системе - копирует
+func (b *FSBackend) PutFile(ctx context.Context, key, srcPath string) error {
+	filePath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return i18n.Errorf("ошибка создания директории: %w", err)
+	}
+
+	if err := os.Rename(srcPath, filePath); err == nil {
+		return nil
+	}
+
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := b.Put(ctx, key, file, -1); err != nil {
+		return err
+	}
+	return os.Remove(srcPath)
+}
+
+func (b *FSBackend) Delete(ctx context.Context, key string) error {
+	filePath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *FSBackend) Walk(ctx context.Context, prefix string, fn func(info Info) error) error {
+	// обход начинается с ближайшей директории префикса, остальное отсекается по ключу
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	root := filepath.Join(b.root, filepath.FromSlash(dir))
+
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return fn(Info{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	})
+	return err
+}
+
+func (b *FSBackend) PresignGet(ctx context.Context, key string) (string, error) {
+	return "", ErrPresignUnsupported
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Viste/larets/i18n"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Options - параметры подключения к S3-совместимому хранилищу (AWS S3, MinIO, Ceph RGW)
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string // префикс ключей внутри бакета
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// Presign включает перенаправление клиентов на подписанные ссылки при скачивании
+	Presign       bool
+	PresignExpiry time.Duration
+}
+
+// S3Backend хранит объекты в бакете S3-совместимого хранилища
+type S3Backend struct {
+	client  *minio.Client
+	options S3Options
+}
+
+func NewS3Backend(options S3Options) (*S3Backend, error) {
+	if options.Endpoint == "" || options.Bucket == "" {
+		return nil, errors.New("для хранилища S3 необходимо указать S3_ENDPOINT и S3_BUCKET")
+	}
+	if options.PresignExpiry <= 0 {
+		options.PresignExpiry = 15 * time.Minute
+	}
+	options.Prefix = strings.Trim(options.Prefix, "/")
+
+	client, err := minio.New(options.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(options.AccessKey, options.SecretKey, ""),
+		Secure: options.UseSSL,
+		Region: options.Region,
+	})
+	if err != nil {
+		return nil, i18n.Errorf("ошибка подключения к S3: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, options.Bucket)
+	if err != nil {
+		return nil, i18n.Errorf("ошибка проверки бакета %s: %w", options.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, options.Bucket, minio.MakeBucketOptions{Region: options.Region}); err != nil {
+			return nil, i18n.Errorf("ошибка создания бакета %s: %w", options.Bucket, err)
+		}
+	}
+
+	return &S3Backend{client: client, options: options}, nil
+}
+
+func (b *S3Backend) objectName(key string) string {
+	if b.options.Prefix == "" {
+		return key
+	}
+	return b.options.Prefix + "/" + key
+}
+
+func (b *S3Backend) mapError(key string, err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" || response.StatusCode == 404 {
+		return i18n.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
+
+func (b *S3Backend) Stat(ctx context.Context, key string) (Info, error) {
+	object, err := b.client.StatObject(ctx, b.options.Bucket, b.objectName(key), minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, b.mapError(key, err)
+	}
+	return Info{Key: key, Size: object.Size, ModTime: object.LastModified}, nil
+}
+
+func (b *S3Backend) Open(ctx context.Context, key string) (io.ReadSeekCloser, Info, error) {
+	object, err := b.client.GetObject(ctx, b.options.Bucket, b.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Info{}, b.mapError(key, err)
+	}
+
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, Info{}, b.mapError(key, err)
+	}
+	return object, Info{Key: key, Size: stat.Size, ModTime: stat.LastModified}, nil
+}
+
+func (b *S3Backend) Put(ctx context.Context, key string, reader io.Reader, size int64) error {
+	_, err := b.client.PutObject(ctx, b.options.Bucket, b.objectName(key), reader, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return i18n.Errorf("ошибка загрузки объекта %s в S3: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3Backend) PutFile(ctx context.Context, key, filePath string) error {
+	_, err := b.client.FPutObject(ctx, b.options.Bucket, b.objectName(key), filePath, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return i18n.Errorf("ошибка загрузки объекта %s в S3: %w", key, err)
+	}
+	return os.Remove(filePath)
+}
+
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	err := b.client.RemoveObject(ctx, b.options.Bucket, b.objectName(key), minio.RemoveObjectOptions{})
+	if err != nil {
+		if errors.Is(b.mapError(key, err), ErrNotFound) {
+			return nil
+		}
+		return i18n.Errorf("ошибка удаления объекта %s из S3: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3Backend) Walk(ctx context.Context, prefix string, fn func(info Info) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := b.client.ListObjects(ctx, b.options.Bucket, minio.ListObjectsOptions{
+		Prefix:    b.objectName(prefix),
+		Recursive: true,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return i18n.Errorf("ошибка получения списка объектов S3: %w", object.Err)
+		}
+
+		key := object.Key
+		if b.options.Prefix != "" {
+			key = strings.TrimPrefix(key, b.options.Prefix+"/")
+		}
+		if err := fn(Info{Key: key, Size: object.Size, ModTime: object.LastModified}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (b *S3Backend) PresignGet(ctx context.Context, key string) (string, error) {
+	if !b.options.Presign {
+		return "", ErrPresignUnsupported
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+	presigned, err := b.client.PresignedGetObject(ctx, b.options.Bucket, b.objectName(key), b.options.PresignExpiry, params)
+	if err != nil {
+		return "", i18n.Errorf("ошибка создания подписанной ссылки: %w", err)
+	}
+	return presigned.String(), nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/Viste/larets/config"
+	"github.com/Viste/larets/i18n"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound           = errors.New("объект не найден в хранилище")
+	ErrPresignUnsupported = errors.New("хранилище не выдает подписанные ссылки")
+)
+
+// Info - сведения об объекте хранилища
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend - хранилище артефактов: blob-ов Docker и архивов чартов Helm.
+// Ключи объектов - пути через "/" относительно корня хранилища, например blobs/sha256/ab/<hex>.
+// Отсутствующий объект возвращается как ошибка, для которой errors.Is(err, ErrNotFound).
+type Backend interface {
+	Stat(ctx context.Context, key string) (Info, error)
+	// Open открывает объект для чтения с поддержкой Seek, что нужно для Range запросов
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, Info, error)
+	// Put сохраняет объект из потока, size -1 - размер не известен
+	Put(ctx context.Context, key string, reader io.Reader, size int64) error
+	// PutFile сохраняет локальный файл под ключом key и удаляет его
+	PutFile(ctx context.Context, key, path string) error
+	// Delete удаляет объект, отсутствие объекта ошибкой не считается
+	Delete(ctx context.Context, key string) error
+	// Walk перебирает объекты с ключами, начинающимися с prefix
+	Walk(ctx context.Context, prefix string, fn func(info Info) error) error
+	// PresignGet возвращает временную ссылку на скачивание объекта напрямую из хранилища
+	// или ErrPresignUnsupported, если хранилище их не выдает
+	PresignGet(ctx context.Context, key string) (string, error)
+}
+
+var Store Backend
+
+// Init создает хранилище, выбранное STORAGE_BACKEND
+func Init() error {
+	switch config.Config.StorageBackend {
+	case "", "fs":
+		Store = NewFSBackend(config.Config.StorageBasePath)
+		i18n.Logf("Артефакты хранятся в файловой системе: %s", config.Config.StorageBasePath)
+	case "s3":
+		backend, err := NewS3Backend(S3Options{
+			Endpoint:      config.Config.S3Endpoint,
+			Region:        config.Config.S3Region,
+			Bucket:        config.Config.S3Bucket,
+			Prefix:        config.Config.S3Prefix,
+			AccessKey:     config.Config.S3AccessKey,
+			SecretKey:     config.Config.S3SecretKey,
+			UseSSL:        config.Config.S3UseSSL,
+			Presign:       config.Config.S3Presign,
+			PresignExpiry: time.Duration(config.Config.S3PresignExpiry) * time.Minute,
+		})
+		if err != nil {
+			return err
+		}
+		Store = backend
+		i18n.Logf("Артефакты хранятся в S3: %s/%s", config.Config.S3Endpoint, config.Config.S3Bucket)
+	default:
+		return i18n.Errorf("неизвестный тип хранилища: %s", config.Config.StorageBackend)
+	}
+	return nil
+}